@@ -0,0 +1,246 @@
+package classroom
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+	"github.com/yourusername/picto-lingua-backend/api/services"
+)
+
+// maxAssignmentWords matches the largest vocabulary a session can practice
+const maxAssignmentWords = 20
+
+// AssignmentRequest describes a new assignment.
+// Vocabulary pins the exact words, when it is empty Count words are generated
+// for the theme and frozen. ImageID selects the image, a random image of the
+// theme is used when it is empty.
+type AssignmentRequest struct {
+	Title      string                  `json:"title"`
+	ThemeID    string                  `json:"theme_id" binding:"required"`
+	Language   string                  `json:"language"`
+	ImageID    string                  `json:"image_id"`
+	Vocabulary []models.VocabularyItem `json:"vocabulary"`
+	Count      int                     `json:"count"`
+	DueDate    string                  `json:"due_date"`
+}
+
+// CreateAssignment creates an assignment with a snapshot of its vocabulary and image
+func (s *Service) CreateAssignment(classroomID string, request AssignmentRequest) (Assignment, error) {
+	if !s.themes.IsValidTheme(request.ThemeID) {
+		return Assignment{}, errors.New("invalid theme")
+	}
+
+	language := strings.ToLower(strings.TrimSpace(request.Language))
+	if language == "" {
+		language = "english"
+	}
+	if _, ok := services.LanguageCode(language); !ok {
+		return Assignment{}, errors.New("unsupported language")
+	}
+
+	if request.DueDate != "" {
+		if _, err := time.Parse("2006-01-02", request.DueDate); err != nil {
+			return Assignment{}, errors.New("invalid due date, expected YYYY-MM-DD")
+		}
+	}
+
+	title := strings.TrimSpace(request.Title)
+	if title == "" {
+		title = request.ThemeID
+	}
+	if len(title) > 100 {
+		return Assignment{}, errors.New("title must be at most 100 characters")
+	}
+
+	vocabulary, err := s.assignmentVocabulary(request, language)
+	if err != nil {
+		return Assignment{}, err
+	}
+
+	image, err := s.assignmentImage(request)
+	if err != nil {
+		return Assignment{}, err
+	}
+
+	id, err := services.NewUUID()
+	if err != nil {
+		return Assignment{}, err
+	}
+
+	assignment := Assignment{
+		ID:          id,
+		ClassroomID: classroomID,
+		Title:       title,
+		ThemeID:     request.ThemeID,
+		Language:    language,
+		Vocabulary:  vocabulary,
+		Image:       image,
+		DueDate:     request.DueDate,
+		CreatedAt:   time.Now().Format(time.RFC3339),
+	}
+	s.store.AddAssignment(assignment)
+
+	return assignment, nil
+}
+
+// assignmentVocabulary validates the pinned vocabulary of a request, or generates it
+func (s *Service) assignmentVocabulary(request AssignmentRequest, language string) ([]models.VocabularyItem, error) {
+	if len(request.Vocabulary) == 0 {
+		count := request.Count
+		if count < 1 || count > maxAssignmentWords {
+			count = 10
+		}
+
+		vocabulary, err := s.content.Vocabulary(request.ThemeID, language, count)
+		if err != nil {
+			return nil, fmt.Errorf("error getting vocabulary: %w", err)
+		}
+		if len(vocabulary) == 0 {
+			return nil, errors.New("no vocabulary available for this theme")
+		}
+
+		// Copy so later changes to the cached vocabulary do not leak into the snapshot
+		return append([]models.VocabularyItem(nil), vocabulary...), nil
+	}
+
+	if len(request.Vocabulary) > maxAssignmentWords {
+		return nil, fmt.Errorf("an assignment can have at most %d words", maxAssignmentWords)
+	}
+
+	vocabulary := make([]models.VocabularyItem, 0, len(request.Vocabulary))
+	seen := make(map[string]bool, len(request.Vocabulary))
+	for _, item := range request.Vocabulary {
+		item.Word = strings.TrimSpace(item.Word)
+		item.Definition = strings.TrimSpace(item.Definition)
+		if item.Word == "" || item.Definition == "" {
+			return nil, errors.New("every word needs a word and a definition")
+		}
+
+		key := strings.ToLower(item.Word)
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate word %q", item.Word)
+		}
+		seen[key] = true
+
+		item.IPA = services.NormalizeIPA(item.IPA)
+		item.DutchIPA = services.NormalizeIPA(item.DutchIPA)
+		if err := services.ValidateIPA(item.IPA); err != nil {
+			return nil, fmt.Errorf("invalid IPA for %q: %w", item.Word, err)
+		}
+		if err := services.ValidateIPA(item.DutchIPA); err != nil {
+			return nil, fmt.Errorf("invalid Dutch IPA for %q: %w", item.Word, err)
+		}
+
+		vocabulary = append(vocabulary, item)
+	}
+
+	return vocabulary, nil
+}
+
+// assignmentImage gets the image selected in a request, or a random image of the theme.
+// A missing image does not block the assignment, students can practice without it.
+func (s *Service) assignmentImage(request AssignmentRequest) (*models.Image, error) {
+	if request.ImageID != "" {
+		image, err := s.content.Image(request.ImageID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting image %s: %w", request.ImageID, err)
+		}
+		return image, nil
+	}
+
+	image, err := s.content.RandomImage(request.ThemeID)
+	if err != nil {
+		log.Printf("Error getting image for assignment: %v", err)
+		return nil, nil
+	}
+	return image, nil
+}
+
+// StartAssignment creates a session for a student that practices an assignment
+func (s *Service) StartAssignment(classroomID, assignmentID string, student *models.User) (*models.SessionData, Assignment, error) {
+	assignment, err := s.store.Assignment(classroomID, assignmentID)
+	if err != nil {
+		return nil, Assignment{}, err
+	}
+
+	imageID := ""
+	if assignment.Image != nil {
+		imageID = assignment.Image.ID
+	}
+
+	sessionID, err := s.sessions.CreateSession(student.ID, services.SessionOptions{
+		ThemeID:      assignment.ThemeID,
+		ImageID:      imageID,
+		Language:     assignment.Language,
+		WordCount:    len(assignment.Vocabulary),
+		AssignmentID: assignment.ID,
+		Vocabulary:   assignment.Vocabulary,
+	})
+	if err != nil {
+		return nil, Assignment{}, err
+	}
+
+	session, err := s.sessions.GetSession(sessionID, student.ID)
+	if err != nil {
+		return nil, Assignment{}, err
+	}
+
+	return session, assignment, nil
+}
+
+// AssignmentContent returns the frozen vocabulary and image of an assignment,
+// it lets resumed sessions practice the same words
+func (s *Service) AssignmentContent(assignmentID string) ([]models.VocabularyItem, *models.Image, bool) {
+	assignment, ok := s.store.AssignmentByID(assignmentID)
+	if !ok {
+		return nil, nil, false
+	}
+	return append([]models.VocabularyItem(nil), assignment.Vocabulary...), assignment.Image, true
+}
+
+// Report returns the completion status and score of every student on an assignment
+func (s *Service) Report(classroomID, assignmentID string) (AssignmentReport, error) {
+	assignment, err := s.store.Assignment(classroomID, assignmentID)
+	if err != nil {
+		return AssignmentReport{}, err
+	}
+
+	report := AssignmentReport{
+		AssignmentID: assignment.ID,
+		Title:        assignment.Title,
+		DueDate:      assignment.DueDate,
+		TotalWords:   len(assignment.Vocabulary),
+		Students:     make([]StudentAssignmentReport, 0),
+	}
+
+	now := time.Now()
+	for _, member := range s.store.Members(classroomID) {
+		if member.Role != RoleStudent {
+			continue
+		}
+
+		student := s.store.AssignmentProgress(member, assignment, now)
+		if student.Status == StatusCompleted {
+			report.Completed++
+		}
+		report.Students = append(report.Students, student)
+	}
+
+	return report, nil
+}
+
+// dueBy returns the end of an assignment's due date (UTC), if it has one
+func dueBy(dueDate string) (time.Time, bool) {
+	if dueDate == "" {
+		return time.Time{}, false
+	}
+	day, err := time.Parse("2006-01-02", dueDate)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return day.Add(24*time.Hour - time.Nanosecond), true
+}
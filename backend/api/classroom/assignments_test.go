@@ -0,0 +1,94 @@
+package classroom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+	"github.com/yourusername/picto-lingua-backend/api/services"
+)
+
+// answerAssignment starts an assignment for the student and answers words in it
+func answerAssignment(t *testing.T, service *Service, sessions *services.SessionService, classroomID, assignmentID string, student *models.User, answers ...models.SessionEvent) {
+	t.Helper()
+	session, _, err := service.StartAssignment(classroomID, assignmentID, student)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessions.UpdateSession(session.SessionID, student.ID, services.SessionUpdate{Answers: answers}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAssignmentReportOutlivesSessions(t *testing.T) {
+	service, sessions, classroom, student := newTestService(t)
+	tomorrow := time.Now().AddDate(0, 0, 1).UTC().Format("2006-01-02")
+	yesterday := time.Now().AddDate(0, 0, -1).UTC().Format("2006-01-02")
+
+	done, err := service.CreateAssignment(classroom.ID, AssignmentRequest{ThemeID: "park", Count: 2, DueDate: tomorrow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	overdue, err := service.CreateAssignment(classroom.ID, AssignmentRequest{ThemeID: "park", Count: 2, DueDate: yesterday})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The student finishes one assignment over two sessions and starts the other
+	answerAssignment(t, service, sessions, classroom.ID, done.ID, student, models.SessionEvent{Word: "bench", Result: "known"})
+	answerAssignment(t, service, sessions, classroom.ID, done.ID, student, models.SessionEvent{Word: "tree", Result: "difficult"})
+	answerAssignment(t, service, sessions, classroom.ID, overdue.ID, student, models.SessionEvent{Word: "tree", Result: "known"})
+	time.Sleep(2 * sessionIdleTimeout)
+
+	report, err := service.Report(classroom.ID, done.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Completed != 1 || len(report.Students) != 1 {
+		t.Fatalf("report = %+v, want one completed student", report)
+	}
+	got := report.Students[0]
+	if got.Status != StatusCompleted || got.Sessions != 2 || got.WordsAnswered != 2 || got.WordsKnown != 1 || got.Score != 50 || got.Late {
+		t.Errorf("completed report = %+v", got)
+	}
+	if got.CompletedAt == "" || got.CompletedAt > time.Now().UTC().Format(time.RFC3339) {
+		t.Errorf("CompletedAt = %q, want the time of the last answer", got.CompletedAt)
+	}
+
+	report, err = service.Report(classroom.ID, overdue.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Students[0]; report.Completed != 0 || got.Status != StatusInProgress || got.WordsAnswered != 1 || got.Score != 50 || !got.Late {
+		t.Errorf("overdue report = %+v", report)
+	}
+}
+
+func TestRemovedAssignmentForgetsProgress(t *testing.T) {
+	service, sessions, classroom, student := newTestService(t)
+
+	assignment, err := service.CreateAssignment(classroom.ID, AssignmentRequest{ThemeID: "park", Count: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _, err := service.StartAssignment(classroom.ID, assignment.ID, student)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !service.store.RemoveAssignment(classroom.ID, assignment.ID) {
+		t.Fatal("assignment not removed")
+	}
+
+	// Answers in the session still count for the theme, not for the removed assignment
+	if _, err := sessions.UpdateSession(session.SessionID, student.ID, services.SessionUpdate{
+		Answers: []models.SessionEvent{{Word: "bench", Result: "known"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(service.store.assignmentProgress); n != 0 {
+		t.Errorf("%d assignment rollups kept, want none", n)
+	}
+	if progress := service.store.ThemeProgress(classroom.ID, Member{UserID: student.ID}, "park"); progress.WordsSeen != 1 {
+		t.Errorf("theme progress = %+v, want the answered word", progress)
+	}
+}
@@ -0,0 +1,284 @@
+package classroom
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/picto-lingua-backend/api/handlers"
+)
+
+var (
+	service *Service
+	store   *Store
+)
+
+// memberContextKey is the gin context key holding the membership checked by RequireRole
+const memberContextKey = "classroom_member"
+
+// Init initializes the classroom handlers with their storage and the services they read from
+func Init(sessions SessionSource, themes ThemeValidator, content ContentSource) {
+	store = NewStore()
+	service = NewService(store, sessions, themes, content)
+	sessions.AddProgressListener(service.RecordProgress)
+
+	// Resumed assignment sessions practice the frozen vocabulary
+	handlers.SetAssignmentContentSource(service)
+}
+
+// RequireRole is a middleware that only lets members of the classroom in the
+// :id path parameter through if they have one of the roles.
+// It must run after handlers.AuthRequired.
+func RequireRole(roles ...Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		classroomID := c.Param("id")
+		if _, err := store.Get(classroomID); err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "classroom not found"})
+			return
+		}
+
+		member, ok := store.Membership(classroomID, handlers.CurrentUser(c).ID)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not a member of this classroom"})
+			return
+		}
+
+		for _, role := range roles {
+			if member.Role == role {
+				c.Set(memberContextKey, member)
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "this action requires the " + string(roles[0]) + " role"})
+	}
+}
+
+// currentMember returns the membership set by RequireRole
+func currentMember(c *gin.Context) Member {
+	member, _ := c.MustGet(memberContextKey).(Member)
+	return member
+}
+
+// CreateClassroom handles the request to create a classroom taught by the authenticated user
+func CreateClassroom(c *gin.Context) {
+	var request struct {
+		Name string `json:"name" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	classroom, err := service.CreateClassroom(handlers.CurrentUser(c), request.Name)
+	if errors.Is(err, ErrAnonymousTeacher) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"classroom": classroom})
+}
+
+// ListClassrooms handles the request to list the classrooms of the authenticated user
+func ListClassrooms(c *gin.Context) {
+	userID := handlers.CurrentUser(c).ID
+
+	type classroomWithRole struct {
+		Classroom
+		Role Role `json:"role"`
+	}
+
+	classrooms := store.ListForUser(userID)
+	result := make([]classroomWithRole, 0, len(classrooms))
+	for _, classroom := range classrooms {
+		member, _ := store.Membership(classroom.ID, userID)
+		if member.Role != RoleTeacher {
+			classroom.JoinCode = ""
+		}
+		result = append(result, classroomWithRole{Classroom: classroom, Role: member.Role})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"classrooms": result})
+}
+
+// JoinClassroom handles the request to join a classroom as a student using its join code
+func JoinClassroom(c *gin.Context) {
+	var request struct {
+		JoinCode string `json:"join_code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	classroom, err := service.Join(handlers.CurrentUser(c), request.JoinCode)
+	switch {
+	case errors.Is(err, ErrInvalidJoinCode):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrAlreadyMember):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Error joining classroom: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to join classroom"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"classroom": classroom,
+		"role":      RoleStudent,
+	})
+}
+
+// GetClassroom handles the request to get a classroom and its assigned themes.
+// Teachers also get the join code and member list.
+func GetClassroom(c *gin.Context) {
+	classroom, err := store.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "classroom not found"})
+		return
+	}
+
+	member := currentMember(c)
+	response := gin.H{
+		"classroom": classroom,
+		"role":      member.Role,
+		"themes":    store.Themes(classroom.ID),
+	}
+	if member.Role == RoleTeacher {
+		response["members"] = store.Members(classroom.ID)
+	} else {
+		classroom.JoinCode = ""
+		response["classroom"] = classroom
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AssignTheme handles the request to assign a theme with an optional due date to a classroom
+func AssignTheme(c *gin.Context) {
+	var request struct {
+		ThemeID string `json:"theme_id" binding:"required"`
+		DueDate string `json:"due_date"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	theme, err := service.AssignTheme(c.Param("id"), request.ThemeID, request.DueDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"theme":  theme,
+		"status": "success",
+	})
+}
+
+// UnassignTheme handles the request to remove an assigned theme from a classroom
+func UnassignTheme(c *gin.Context) {
+	if !store.RemoveTheme(c.Param("id"), c.Param("theme_id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "theme is not assigned to this classroom"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// GetProgress handles the request to roll up every student's progress per assigned theme
+func GetProgress(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"classroom_id": c.Param("id"),
+		"themes":       service.Progress(c.Param("id")),
+	})
+}
+
+// CreateAssignment handles the request to create an assignment with a frozen word list and image
+func CreateAssignment(c *gin.Context) {
+	var request AssignmentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	assignment, err := service.CreateAssignment(c.Param("id"), request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"assignment": assignment})
+}
+
+// ListAssignments handles the request to list the assignments of a classroom
+func ListAssignments(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"assignments": store.Assignments(c.Param("id"))})
+}
+
+// GetAssignment handles the request to get an assignment with its vocabulary and image
+func GetAssignment(c *gin.Context) {
+	assignment, err := store.Assignment(c.Param("id"), c.Param("assignment_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"assignment": assignment})
+}
+
+// DeleteAssignment handles the request to remove an assignment from a classroom
+func DeleteAssignment(c *gin.Context) {
+	if !store.RemoveAssignment(c.Param("id"), c.Param("assignment_id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrAssignmentNotFound.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// StartAssignment handles the request of a student to start a session on an assignment.
+// Answers are then saved through the regular session endpoints.
+func StartAssignment(c *gin.Context) {
+	session, assignment, err := service.StartAssignment(c.Param("id"), c.Param("assignment_id"), handlers.CurrentUser(c))
+	if errors.Is(err, ErrAssignmentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error starting assignment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start assignment"})
+		return
+	}
+
+	c.Header("ETag", `"`+strconv.Itoa(session.Version)+`"`)
+	c.JSON(http.StatusCreated, gin.H{
+		"session":    session,
+		"vocabulary": assignment.Vocabulary,
+		"image":      assignment.Image,
+	})
+}
+
+// GetAssignmentReport handles the request to get every student's completion status and score on an assignment
+func GetAssignmentReport(c *gin.Context) {
+	report, err := service.Report(c.Param("id"), c.Param("assignment_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,106 @@
+package classroom
+
+import "github.com/yourusername/picto-lingua-backend/api/models"
+
+// Role is a member's role in a classroom
+type Role string
+
+const (
+	// RoleTeacher manages the classroom and sees every student's progress
+	RoleTeacher Role = "teacher"
+	// RoleStudent practices the themes assigned to the classroom
+	RoleStudent Role = "student"
+)
+
+// Classroom represents a class of students led by a teacher
+type Classroom struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	TeacherID string `json:"teacher_id"`
+	JoinCode  string `json:"join_code,omitempty"` // only shown to teachers
+	CreatedAt string `json:"created_at"`
+}
+
+// Member represents a user's membership in a classroom
+type Member struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Role     Role   `json:"role"`
+	JoinedAt string `json:"joined_at"`
+}
+
+// AssignedTheme represents a theme a teacher assigned to a classroom
+type AssignedTheme struct {
+	ThemeID    string `json:"theme_id"`
+	DueDate    string `json:"due_date,omitempty"` // YYYY-MM-DD
+	AssignedAt string `json:"assigned_at"`
+}
+
+// StudentProgress represents one student's rolled up progress on a theme
+type StudentProgress struct {
+	UserID       string  `json:"user_id"`
+	Username     string  `json:"username"`
+	Sessions     int     `json:"sessions"`
+	WordsSeen    int     `json:"words_seen"`
+	WordsKnown   int     `json:"words_known"` // words whose latest status is "known"
+	TotalReviews int     `json:"total_reviews"`
+	KnownRatio   float64 `json:"known_ratio"`
+	LastActive   string  `json:"last_active,omitempty"`
+}
+
+// ThemeProgress represents the progress of every student on an assigned theme
+type ThemeProgress struct {
+	AssignedTheme
+	Students []StudentProgress `json:"students"`
+}
+
+// Assignment represents a fixed set of words and an image a teacher assigned to a classroom.
+// The vocabulary and image are snapshots taken when the assignment was created,
+// so every student practices exactly the same words.
+type Assignment struct {
+	ID          string                  `json:"id"`
+	ClassroomID string                  `json:"classroom_id"`
+	Title       string                  `json:"title"`
+	ThemeID     string                  `json:"theme_id"`
+	Language    string                  `json:"language"`
+	Vocabulary  []models.VocabularyItem `json:"vocabulary"`
+	Image       *models.Image           `json:"image,omitempty"`
+	DueDate     string                  `json:"due_date,omitempty"` // YYYY-MM-DD
+	CreatedAt   string                  `json:"created_at"`
+}
+
+// AssignmentStatus is a student's completion status on an assignment
+type AssignmentStatus string
+
+const (
+	// StatusNotStarted means the student has not answered any assigned word
+	StatusNotStarted AssignmentStatus = "not_started"
+	// StatusInProgress means the student answered some but not all assigned words
+	StatusInProgress AssignmentStatus = "in_progress"
+	// StatusCompleted means the student answered every assigned word
+	StatusCompleted AssignmentStatus = "completed"
+)
+
+// StudentAssignmentReport represents one student's completion and score on an assignment
+type StudentAssignmentReport struct {
+	UserID        string           `json:"user_id"`
+	Username      string           `json:"username"`
+	Status        AssignmentStatus `json:"status"`
+	Sessions      int              `json:"sessions"`
+	WordsAnswered int              `json:"words_answered"`
+	WordsKnown    int              `json:"words_known"` // assigned words whose latest status is "known"
+	Score         int              `json:"score"`       // percentage of assigned words known
+	CompletedAt   string           `json:"completed_at,omitempty"`
+	Late          bool             `json:"late"` // completed after the due date, or overdue and not completed
+	LastActive    string           `json:"last_active,omitempty"`
+}
+
+// AssignmentReport represents the completion and scores of every student on an assignment
+type AssignmentReport struct {
+	AssignmentID string                    `json:"assignment_id"`
+	Title        string                    `json:"title"`
+	DueDate      string                    `json:"due_date,omitempty"`
+	TotalWords   int                       `json:"total_words"`
+	Completed    int                       `json:"completed"`
+	Students     []StudentAssignmentReport `json:"students"`
+}
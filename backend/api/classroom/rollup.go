@@ -0,0 +1,125 @@
+package classroom
+
+import (
+	"slices"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+	"github.com/yourusername/picto-lingua-backend/api/services"
+)
+
+// rollupKey identifies the progress of a user on a theme or assignment of a classroom
+type rollupKey struct {
+	classroomID string
+	userID      string
+	scope       string
+}
+
+// progressRollup is a student's progress, updated as it happens so it
+// outlives the sessions it was recorded in
+type progressRollup struct {
+	sessions   map[string]bool
+	statuses   map[string]string // word to its latest status
+	reviews    int
+	known      int
+	lastActive string
+	// completedAt is when every assigned word was answered, for assignments
+	completedAt string
+}
+
+// newProgressRollup creates an empty rollup
+func newProgressRollup() *progressRollup {
+	return &progressRollup{
+		sessions: make(map[string]bool),
+		statuses: make(map[string]string),
+	}
+}
+
+// add applies a progress update to the rollup, counters never go down
+func (r *progressRollup) add(update services.ProgressUpdate) {
+	var previous models.ProgressItem
+	if update.Previous != nil {
+		previous = *update.Previous
+	}
+
+	r.sessions[update.SessionID] = true
+	r.reviews += max(update.Current.SeenCount-previous.SeenCount, 0)
+	r.known += max(update.Current.KnownCount-previous.KnownCount, 0)
+	r.statuses[update.Current.Word] = update.Current.Status
+	r.lastActive = update.RecordedAt.Format(time.RFC3339)
+}
+
+// studentProgress builds the API representation of a member's rollup
+func (r *progressRollup) studentProgress(member Member) StudentProgress {
+	student := StudentProgress{
+		UserID:       member.UserID,
+		Username:     member.Username,
+		Sessions:     len(r.sessions),
+		WordsSeen:    len(r.statuses),
+		TotalReviews: r.reviews,
+		LastActive:   r.lastActive,
+	}
+	for _, status := range r.statuses {
+		if status == "known" {
+			student.WordsKnown++
+		}
+	}
+	if r.reviews > 0 {
+		student.KnownRatio = float64(r.known) / float64(r.reviews)
+	}
+	return student
+}
+
+// addAssignment applies a progress update on an assignment to the rollup and
+// records when its last assigned word was answered
+func (r *progressRollup) addAssignment(assignment Assignment, update services.ProgressUpdate) {
+	if !slices.ContainsFunc(assignment.Vocabulary, func(item models.VocabularyItem) bool {
+		return item.Word == update.Current.Word
+	}) {
+		return
+	}
+
+	r.add(update)
+	if r.completedAt == "" && len(r.statuses) == len(assignment.Vocabulary) {
+		r.completedAt = update.RecordedAt.UTC().Format(time.RFC3339)
+	}
+}
+
+// assignmentReport scores a member's rollup on an assignment
+func (r *progressRollup) assignmentReport(member Member, assignment Assignment, now time.Time) StudentAssignmentReport {
+	student := StudentAssignmentReport{
+		UserID:        member.UserID,
+		Username:      member.Username,
+		Status:        StatusNotStarted,
+		Sessions:      len(r.sessions),
+		WordsAnswered: len(r.statuses),
+		LastActive:    r.lastActive,
+	}
+	for _, status := range r.statuses {
+		if status == "known" {
+			student.WordsKnown++
+		}
+	}
+	if len(assignment.Vocabulary) > 0 {
+		student.Score = student.WordsKnown * 100 / len(assignment.Vocabulary)
+	}
+
+	switch {
+	case r.completedAt != "":
+		student.Status = StatusCompleted
+		student.CompletedAt = r.completedAt
+	case student.WordsAnswered > 0:
+		student.Status = StatusInProgress
+	}
+
+	if due, ok := dueBy(assignment.DueDate); ok {
+		if student.Status == StatusCompleted {
+			completedAt, err := time.Parse(time.RFC3339, student.CompletedAt)
+			student.Late = err == nil && completedAt.After(due)
+		} else {
+			student.Late = now.After(due)
+		}
+	}
+
+	return student
+}
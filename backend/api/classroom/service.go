@@ -0,0 +1,195 @@
+package classroom
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+	"github.com/yourusername/picto-lingua-backend/api/services"
+)
+
+// ErrAnonymousTeacher is returned when an anonymous device account tries to create a classroom
+var ErrAnonymousTeacher = errors.New("anonymous users cannot create classrooms")
+
+// joinCodeAlphabet leaves out characters that are easily confused, such as 0 and O
+const joinCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const joinCodeLength = 6
+
+// SessionSource creates the learning sessions of users and reports the
+// progress made in them
+type SessionSource interface {
+	AddProgressListener(listener services.ProgressListener)
+	CreateSession(userID string, options services.SessionOptions) (string, error)
+	GetSession(sessionID, userID string) (*models.SessionData, error)
+}
+
+// ThemeValidator checks theme IDs
+type ThemeValidator interface {
+	IsValidTheme(id string) bool
+}
+
+// ContentSource provides the vocabulary and images that assignments snapshot
+type ContentSource interface {
+	Vocabulary(themeID, language string, count int) ([]models.VocabularyItem, error)
+	Image(imageID string) (*models.Image, error)
+	RandomImage(themeID string) (*models.Image, error)
+}
+
+// Service implements classroom management on top of the store
+type Service struct {
+	store    *Store
+	sessions SessionSource
+	themes   ThemeValidator
+	content  ContentSource
+}
+
+// NewService creates a new classroom service
+func NewService(store *Store, sessions SessionSource, themes ThemeValidator, content ContentSource) *Service {
+	return &Service{
+		store:    store,
+		sessions: sessions,
+		themes:   themes,
+		content:  content,
+	}
+}
+
+// CreateClassroom creates a classroom with the user as its teacher
+func (s *Service) CreateClassroom(teacher *models.User, name string) (Classroom, error) {
+	if teacher.Anonymous {
+		return Classroom{}, ErrAnonymousTeacher
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return Classroom{}, errors.New("name must be between 1 and 100 characters")
+	}
+
+	id, err := services.NewUUID()
+	if err != nil {
+		return Classroom{}, err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	member := Member{
+		UserID:   teacher.ID,
+		Username: teacher.Username,
+		Role:     RoleTeacher,
+		JoinedAt: now,
+	}
+
+	// Join codes are short, retry the rare collision with a new code
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := newJoinCode()
+		if err != nil {
+			return Classroom{}, err
+		}
+
+		classroom := Classroom{
+			ID:        id,
+			Name:      name,
+			TeacherID: teacher.ID,
+			JoinCode:  code,
+			CreatedAt: now,
+		}
+		if err := s.store.Create(classroom, member); err == nil {
+			return classroom, nil
+		}
+	}
+
+	return Classroom{}, errors.New("failed to generate a unique join code")
+}
+
+// Join adds the user to the classroom with the join code as a student
+func (s *Service) Join(student *models.User, joinCode string) (Classroom, error) {
+	member := Member{
+		UserID:   student.ID,
+		Username: student.Username,
+		Role:     RoleStudent,
+		JoinedAt: time.Now().Format(time.RFC3339),
+	}
+
+	classroom, err := s.store.Join(strings.ToUpper(strings.TrimSpace(joinCode)), member)
+	if err != nil {
+		return Classroom{}, err
+	}
+
+	classroom.JoinCode = ""
+	return classroom, nil
+}
+
+// AssignTheme assigns a theme to a classroom with an optional due date (YYYY-MM-DD)
+func (s *Service) AssignTheme(classroomID, themeID, dueDate string) (AssignedTheme, error) {
+	if !s.themes.IsValidTheme(themeID) {
+		return AssignedTheme{}, errors.New("invalid theme")
+	}
+	if dueDate != "" {
+		if _, err := time.Parse("2006-01-02", dueDate); err != nil {
+			return AssignedTheme{}, errors.New("invalid due date, expected YYYY-MM-DD")
+		}
+	}
+
+	theme := AssignedTheme{
+		ThemeID:    themeID,
+		DueDate:    dueDate,
+		AssignedAt: time.Now().Format(time.RFC3339),
+	}
+	s.store.SetTheme(classroomID, theme)
+
+	return theme, nil
+}
+
+// RecordProgress keeps the progress of classroom members, it is a
+// ProgressListener. Sessions expire, so their progress is rolled up as it
+// happens rather than when a teacher asks for it.
+func (s *Service) RecordProgress(update services.ProgressUpdate) {
+	if !s.store.IsMember(update.UserID) {
+		return
+	}
+	s.store.RecordThemeProgress(update)
+	if update.AssignmentID != "" {
+		s.store.RecordAssignmentProgress(update)
+	}
+}
+
+// Progress returns every student's rolled up progress on each assigned theme
+func (s *Service) Progress(classroomID string) []ThemeProgress {
+	themes := s.store.Themes(classroomID)
+	members := s.store.Members(classroomID)
+
+	rollup := make([]ThemeProgress, 0, len(themes))
+	for _, theme := range themes {
+		progress := ThemeProgress{
+			AssignedTheme: theme,
+			Students:      make([]StudentProgress, 0, len(members)),
+		}
+
+		for _, member := range members {
+			if member.Role != RoleStudent {
+				continue
+			}
+			progress.Students = append(progress.Students, s.store.ThemeProgress(classroomID, member, theme.ThemeID))
+		}
+
+		rollup = append(rollup, progress)
+	}
+
+	return rollup
+}
+
+// newJoinCode generates a random join code
+func newJoinCode() (string, error) {
+	var code strings.Builder
+	max := big.NewInt(int64(len(joinCodeAlphabet)))
+	for i := 0; i < joinCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("error generating join code: %w", err)
+		}
+		code.WriteByte(joinCodeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
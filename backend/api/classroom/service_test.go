@@ -0,0 +1,144 @@
+package classroom
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+	"github.com/yourusername/picto-lingua-backend/api/services"
+)
+
+// parkVocabulary is the vocabulary the fake content source serves
+var parkVocabulary = []models.VocabularyItem{
+	{Word: "bench", Definition: "A long seat"},
+	{Word: "tree", Definition: "A tall plant"},
+	{Word: "pond", Definition: "A small lake"},
+}
+
+// fakeContent serves the park theme without images
+type fakeContent struct{}
+
+func (fakeContent) IsValidTheme(id string) bool {
+	return id == "park"
+}
+
+func (fakeContent) Vocabulary(themeID, language string, count int) ([]models.VocabularyItem, error) {
+	return parkVocabulary[:min(count, len(parkVocabulary))], nil
+}
+
+func (fakeContent) Image(imageID string) (*models.Image, error) {
+	return nil, errors.New("no images")
+}
+
+func (fakeContent) RandomImage(themeID string) (*models.Image, error) {
+	return nil, errors.New("no images")
+}
+
+// sessionIdleTimeout is short so tests can outlive their sessions
+const sessionIdleTimeout = 100 * time.Millisecond
+
+// newTestService creates a classroom service on a session service whose
+// sessions expire quickly, with a teacher and a student in one classroom
+func newTestService(t *testing.T) (*Service, *services.SessionService, Classroom, *models.User) {
+	t.Helper()
+	sessions := services.NewSessionService(sessionIdleTimeout, time.Hour)
+	service := NewService(NewStore(), sessions, fakeContent{}, fakeContent{})
+	sessions.AddProgressListener(service.RecordProgress)
+
+	classroom, err := service.CreateClassroom(&models.User{ID: "teacher", Username: "ms-hopper"}, "Class 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	student := &models.User{ID: "student", Username: "ada"}
+	if _, err := service.Join(student, classroom.JoinCode); err != nil {
+		t.Fatal(err)
+	}
+	return service, sessions, classroom, student
+}
+
+// practice answers words in a new park session of the user
+func practice(t *testing.T, sessions *services.SessionService, userID string, answers ...models.SessionEvent) {
+	t.Helper()
+	id, err := sessions.CreateSession(userID, services.SessionOptions{ThemeID: "park", Vocabulary: parkVocabulary})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessions.UpdateSession(id, userID, services.SessionUpdate{Answers: answers}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProgressOutlivesSessions(t *testing.T) {
+	service, sessions, classroom, student := newTestService(t)
+	if _, err := service.AssignTheme(classroom.ID, "park", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	practice(t, sessions, student.ID,
+		models.SessionEvent{Word: "bench", Result: "difficult"},
+		models.SessionEvent{Word: "tree", Result: "known"})
+	practice(t, sessions, student.ID, models.SessionEvent{Word: "bench", Result: "known"})
+	// Non-members are not rolled up
+	practice(t, sessions, "stranger", models.SessionEvent{Word: "pond", Result: "known"})
+
+	// The sessions are gone, their progress is not
+	time.Sleep(2 * sessionIdleTimeout)
+	if live := sessions.ListSessions(student.ID, services.SessionFilter{}); len(live) != 0 {
+		t.Fatalf("%d live sessions, want none", len(live))
+	}
+
+	progress := service.Progress(classroom.ID)
+	if len(progress) != 1 || len(progress[0].Students) != 1 {
+		t.Fatalf("progress = %+v, want one theme with one student", progress)
+	}
+	got := progress[0].Students[0]
+	want := StudentProgress{UserID: "student", Username: "ada", Sessions: 2, WordsSeen: 2, WordsKnown: 2, TotalReviews: 3, KnownRatio: 2.0 / 3, LastActive: got.LastActive}
+	if got != want || got.LastActive == "" {
+		t.Errorf("student progress = %+v, want %+v", got, want)
+	}
+	if service.store.IsMember("stranger") {
+		t.Error("stranger is a member")
+	}
+}
+
+func TestProgressIsKeptPerClassroom(t *testing.T) {
+	service, sessions, classroom, student := newTestService(t)
+	other, err := service.CreateClassroom(&models.User{ID: "teacher-2", Username: "mr-knuth"}, "Class 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Join(student, other.JoinCode); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{classroom.ID, other.ID} {
+		if _, err := service.AssignTheme(id, "park", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Free practice counts in both classrooms
+	practice(t, sessions, student.ID, models.SessionEvent{Word: "bench", Result: "known"})
+
+	// An assignment's session only counts in the assignment's classroom
+	assignment, err := service.CreateAssignment(other.ID, AssignmentRequest{ThemeID: "park", Count: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _, err := service.StartAssignment(other.ID, assignment.ID, student)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessions.UpdateSession(session.SessionID, student.ID, services.SessionUpdate{
+		Answers: []models.SessionEvent{{Word: "tree", Result: "known"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, seen := range map[string]int{classroom.ID: 1, other.ID: 2} {
+		progress := service.Progress(id)
+		if len(progress) != 1 || len(progress[0].Students) != 1 || progress[0].Students[0].WordsSeen != seen {
+			t.Errorf("progress in %s = %+v, want %d words seen", id, progress, seen)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package classroom
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/services"
+)
+
+var (
+	// ErrNotFound is returned when a classroom does not exist
+	ErrNotFound = errors.New("classroom not found")
+	// ErrInvalidJoinCode is returned when no classroom uses a join code
+	ErrInvalidJoinCode = errors.New("invalid join code")
+	// ErrAlreadyMember is returned when a user joins a classroom twice
+	ErrAlreadyMember = errors.New("already a member of this classroom")
+	// ErrAssignmentNotFound is returned when an assignment does not exist in a classroom
+	ErrAssignmentNotFound = errors.New("assignment not found")
+)
+
+// Store keeps classrooms, their members, assigned themes and the progress of
+// their members in memory
+type Store struct {
+	classrooms             map[string]Classroom
+	members                map[string]map[string]Member  // classroom ID to members by user ID
+	themes                 map[string][]AssignedTheme    // classroom ID to assigned themes
+	joinCodes              map[string]string             // join code to classroom ID
+	byUser                 map[string]map[string]bool    // user ID to classroom IDs
+	assignments            map[string]Assignment         // assignment ID to assignment
+	assignmentsByClassroom map[string][]string           // classroom ID to assignment IDs in creation order
+	themeProgress          map[rollupKey]*progressRollup // keyed by classroom, user and theme ID
+	assignmentProgress     map[rollupKey]*progressRollup // keyed by classroom, user and assignment ID
+	mu                     sync.RWMutex
+}
+
+// NewStore creates a new classroom store
+func NewStore() *Store {
+	return &Store{
+		classrooms:             make(map[string]Classroom),
+		members:                make(map[string]map[string]Member),
+		themes:                 make(map[string][]AssignedTheme),
+		joinCodes:              make(map[string]string),
+		byUser:                 make(map[string]map[string]bool),
+		assignments:            make(map[string]Assignment),
+		assignmentsByClassroom: make(map[string][]string),
+		themeProgress:          make(map[rollupKey]*progressRollup),
+		assignmentProgress:     make(map[rollupKey]*progressRollup),
+	}
+}
+
+// Create stores a new classroom with its teacher as the first member.
+// It fails if the join code is already taken.
+func (s *Store) Create(classroom Classroom, teacher Member) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, taken := s.joinCodes[classroom.JoinCode]; taken {
+		return errors.New("join code already in use")
+	}
+
+	s.classrooms[classroom.ID] = classroom
+	s.joinCodes[classroom.JoinCode] = classroom.ID
+	s.members[classroom.ID] = make(map[string]Member)
+	s.addMember(classroom.ID, teacher)
+
+	return nil
+}
+
+// addMember adds a member to a classroom, the caller must hold the lock
+func (s *Store) addMember(classroomID string, member Member) {
+	s.members[classroomID][member.UserID] = member
+	if s.byUser[member.UserID] == nil {
+		s.byUser[member.UserID] = make(map[string]bool)
+	}
+	s.byUser[member.UserID][classroomID] = true
+}
+
+// Get returns a classroom by its ID
+func (s *Store) Get(classroomID string) (Classroom, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	classroom, ok := s.classrooms[classroomID]
+	if !ok {
+		return Classroom{}, ErrNotFound
+	}
+	return classroom, nil
+}
+
+// Join adds a member to the classroom using the join code and returns the classroom
+func (s *Store) Join(joinCode string, member Member) (Classroom, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	classroomID, ok := s.joinCodes[joinCode]
+	if !ok {
+		return Classroom{}, ErrInvalidJoinCode
+	}
+	if _, ok := s.members[classroomID][member.UserID]; ok {
+		return Classroom{}, ErrAlreadyMember
+	}
+
+	s.addMember(classroomID, member)
+	return s.classrooms[classroomID], nil
+}
+
+// Membership returns a user's membership in a classroom
+func (s *Store) Membership(classroomID, userID string) (Member, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	member, ok := s.members[classroomID][userID]
+	return member, ok
+}
+
+// IsMember reports whether a user is a member of any classroom
+func (s *Store) IsMember(userID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.byUser[userID]) > 0
+}
+
+// RecordThemeProgress adds a progress update to the user's rollups on its
+// theme. Practice in an assignment's session counts in the assignment's
+// classroom only, other practice in every classroom the user is a member of.
+func (s *Store) RecordThemeProgress(update services.ProgressUpdate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	classroomIDs := s.byUser[update.UserID]
+	if assignment, ok := s.assignments[update.AssignmentID]; ok {
+		if !classroomIDs[assignment.ClassroomID] {
+			return
+		}
+		classroomIDs = map[string]bool{assignment.ClassroomID: true}
+	}
+
+	for classroomID := range classroomIDs {
+		key := rollupKey{classroomID: classroomID, userID: update.UserID, scope: update.ThemeID}
+		rollup, ok := s.themeProgress[key]
+		if !ok {
+			rollup = newProgressRollup()
+			s.themeProgress[key] = rollup
+		}
+		rollup.add(update)
+	}
+}
+
+// RecordAssignmentProgress adds a progress update to the user's rollup on the
+// assignment of its session, if the assignment still exists
+func (s *Store) RecordAssignmentProgress(update services.ProgressUpdate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	assignment, ok := s.assignments[update.AssignmentID]
+	if !ok {
+		return
+	}
+
+	key := rollupKey{classroomID: assignment.ClassroomID, userID: update.UserID, scope: update.AssignmentID}
+	rollup, ok := s.assignmentProgress[key]
+	if !ok {
+		rollup = newProgressRollup()
+		s.assignmentProgress[key] = rollup
+	}
+	rollup.addAssignment(assignment, update)
+}
+
+// AssignmentProgress returns a member's completion and score on an assignment
+func (s *Store) AssignmentProgress(member Member, assignment Assignment, now time.Time) StudentAssignmentReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rollup, ok := s.assignmentProgress[rollupKey{classroomID: assignment.ClassroomID, userID: member.UserID, scope: assignment.ID}]
+	if !ok {
+		rollup = newProgressRollup()
+	}
+	return rollup.assignmentReport(member, assignment, now)
+}
+
+// ThemeProgress returns a member's rolled up progress on a theme in a classroom
+func (s *Store) ThemeProgress(classroomID string, member Member, themeID string) StudentProgress {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rollup, ok := s.themeProgress[rollupKey{classroomID: classroomID, userID: member.UserID, scope: themeID}]
+	if !ok {
+		rollup = newProgressRollup()
+	}
+	return rollup.studentProgress(member)
+}
+
+// Members returns the members of a classroom sorted by username
+func (s *Store) Members(classroomID string) []Member {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	members := make([]Member, 0, len(s.members[classroomID]))
+	for _, member := range s.members[classroomID] {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Username < members[j].Username
+	})
+	return members
+}
+
+// ListForUser returns the classrooms a user is a member of
+func (s *Store) ListForUser(userID string) []Classroom {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	classrooms := make([]Classroom, 0, len(s.byUser[userID]))
+	for classroomID := range s.byUser[userID] {
+		classrooms = append(classrooms, s.classrooms[classroomID])
+	}
+	sort.Slice(classrooms, func(i, j int) bool {
+		return classrooms[i].CreatedAt < classrooms[j].CreatedAt
+	})
+	return classrooms
+}
+
+// SetTheme assigns a theme to a classroom, replacing an earlier assignment of the same theme
+func (s *Store) SetTheme(classroomID string, theme AssignedTheme) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	themes := s.themes[classroomID]
+	for i, existing := range themes {
+		if existing.ThemeID == theme.ThemeID {
+			themes[i] = theme
+			return
+		}
+	}
+	s.themes[classroomID] = append(themes, theme)
+}
+
+// RemoveTheme unassigns a theme from a classroom and reports whether it was assigned
+func (s *Store) RemoveTheme(classroomID, themeID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	themes := s.themes[classroomID]
+	for i, existing := range themes {
+		if existing.ThemeID == themeID {
+			s.themes[classroomID] = append(themes[:i:i], themes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Themes returns the themes assigned to a classroom
+func (s *Store) Themes(classroomID string) []AssignedTheme {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	themes := make([]AssignedTheme, len(s.themes[classroomID]))
+	copy(themes, s.themes[classroomID])
+	return themes
+}
+
+// AddAssignment stores a new assignment
+func (s *Store) AddAssignment(assignment Assignment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.assignments[assignment.ID] = assignment
+	s.assignmentsByClassroom[assignment.ClassroomID] = append(s.assignmentsByClassroom[assignment.ClassroomID], assignment.ID)
+}
+
+// Assignment returns an assignment of a classroom by its ID
+func (s *Store) Assignment(classroomID, assignmentID string) (Assignment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	assignment, ok := s.assignments[assignmentID]
+	if !ok || assignment.ClassroomID != classroomID {
+		return Assignment{}, ErrAssignmentNotFound
+	}
+	return assignment, nil
+}
+
+// AssignmentByID returns an assignment by its ID regardless of its classroom
+func (s *Store) AssignmentByID(assignmentID string) (Assignment, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	assignment, ok := s.assignments[assignmentID]
+	return assignment, ok
+}
+
+// Assignments returns the assignments of a classroom in creation order
+func (s *Store) Assignments(classroomID string) []Assignment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	assignments := make([]Assignment, 0, len(s.assignmentsByClassroom[classroomID]))
+	for _, assignmentID := range s.assignmentsByClassroom[classroomID] {
+		assignments = append(assignments, s.assignments[assignmentID])
+	}
+	return assignments
+}
+
+// RemoveAssignment deletes an assignment and the progress on it from a
+// classroom and reports whether it existed. Sessions linked to it keep their
+// progress and vocabulary.
+func (s *Store) RemoveAssignment(classroomID, assignmentID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	assignment, ok := s.assignments[assignmentID]
+	if !ok || assignment.ClassroomID != classroomID {
+		return false
+	}
+
+	delete(s.assignments, assignmentID)
+	for key := range s.assignmentProgress {
+		if key.scope == assignmentID {
+			delete(s.assignmentProgress, key)
+		}
+	}
+	ids := s.assignmentsByClassroom[classroomID]
+	for i, id := range ids {
+		if id == assignmentID {
+			s.assignmentsByClassroom[classroomID] = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	return true
+}
@@ -0,0 +1,248 @@
+package fakes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// openAIModel is the model the fake reports completions were generated with
+const openAIModel = "gpt-3.5-turbo-0125"
+
+// wordCountPattern finds the number of words a vocabulary prompt asks for
+var wordCountPattern = regexp.MustCompile(`Generate (\d+) vocabulary words`)
+
+// DefaultVocabulary is the vocabulary the fake OpenAI API answers with
+var DefaultVocabulary = []models.VocabularyItem{
+	{Word: "bench", Definition: "A long seat for two or more people", Example: "We sat on the bench in the park.", IPA: "/bɛntʃ/",
+		DutchWord: "bank", DutchDefinition: "Een lange zitplaats", DutchExample: "We zaten op de bank in het park.", DutchIPA: "/bɑŋk/"},
+	{Word: "tree", Definition: "A tall plant with a trunk and branches", Example: "The tree gives us shade.", IPA: "/triː/",
+		DutchWord: "boom", DutchDefinition: "Een hoge plant met een stam", DutchExample: "De boom geeft ons schaduw.", DutchIPA: "/boːm/"},
+	{Word: "pond", Definition: "A small area of still water", Example: "Ducks swim in the pond.", IPA: "/pɒnd/",
+		DutchWord: "vijver", DutchDefinition: "Een klein stuk stilstaand water", DutchExample: "Eenden zwemmen in de vijver.", DutchIPA: "/ˈvɛivər/"},
+	{Word: "grass", Definition: "Short green plants that cover the ground", Example: "The children run on the grass.", IPA: "/ɡrɑːs/",
+		DutchWord: "gras", DutchDefinition: "Korte groene planten op de grond", DutchExample: "De kinderen rennen op het gras.", DutchIPA: "/ɣrɑs/"},
+	{Word: "swing", Definition: "A seat hanging from ropes", Example: "She goes high on the swing.", IPA: "/swɪŋ/",
+		DutchWord: "schommel", DutchDefinition: "Een zitje dat aan touwen hangt", DutchExample: "Ze gaat hoog op de schommel.", DutchIPA: "/ˈsxɔməl/"},
+}
+
+// OpenAI emulates the chat completions, moderations and speech endpoints of
+// the OpenAI API. Chat completions answer vocabulary prompts with as many
+// words of the configured vocabulary as the prompt asks for, streamed or not,
+// and report their token usage.
+type OpenAI struct {
+	*httptest.Server
+
+	vocabulary []models.VocabularyItem
+	content    string // raw completion that replaces the vocabulary when set
+	status     int    // status of every response when set
+	retryAfter time.Duration
+	flagged    []string
+	requests   []openai.ChatCompletionRequest
+	mu         sync.Mutex
+}
+
+// NewOpenAI starts a fake OpenAI API. Close it when done.
+func NewOpenAI() *OpenAI {
+	o := &OpenAI{vocabulary: DefaultVocabulary}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", o.api(o.chatCompletion))
+	mux.HandleFunc("POST /v1/moderations", o.api(o.moderation))
+	mux.HandleFunc("POST /v1/audio/speech", o.api(o.speech))
+	o.Server = httptest.NewServer(mux)
+	return o
+}
+
+// BaseURL returns the base URL to configure OpenAI clients with
+func (o *OpenAI) BaseURL() string {
+	return o.URL + "/v1"
+}
+
+// SetVocabulary replaces the vocabulary completions answer with
+func (o *OpenAI) SetVocabulary(vocabulary []models.VocabularyItem) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.vocabulary = vocabulary
+}
+
+// SetContent makes completions answer with content as is, such as invalid
+// JSON, until it is called with an empty string
+func (o *OpenAI) SetContent(content string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.content = content
+}
+
+// FailWith makes every request fail with status, until it is called with zero
+func (o *OpenAI) FailWith(status int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.status = status
+}
+
+// RateLimit rejects every request with 429 and a Retry-After header, until it
+// is called with zero
+func (o *OpenAI) RateLimit(retryAfter time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.retryAfter = retryAfter
+}
+
+// Flag makes the moderation endpoint flag texts that contain one of the terms
+func (o *OpenAI) Flag(terms ...string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.flagged = terms
+}
+
+// ChatRequests returns the chat completion requests received so far
+func (o *OpenAI) ChatRequests() []openai.ChatCompletionRequest {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]openai.ChatCompletionRequest(nil), o.requests...)
+}
+
+// api wraps an endpoint with authentication, rate limiting and failures
+func (o *OpenAI) api(handler func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		o.mu.Lock()
+		status, retryAfter := o.status, o.retryAfter
+		o.mu.Unlock()
+
+		switch {
+		case !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "):
+			openAIError(w, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", "Incorrect API key provided")
+		case retryAfter > 0:
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			w.Header().Set("X-Ratelimit-Remaining-Requests", "0")
+			openAIError(w, http.StatusTooManyRequests, "requests", "rate_limit_exceeded", "Rate limit reached for requests")
+		case status != 0:
+			openAIError(w, status, "server_error", nil, http.StatusText(status))
+		default:
+			handler(w, r)
+		}
+	}
+}
+
+// chatCompletion answers a chat completion request, streamed when asked
+func (o *OpenAI) chatCompletion(w http.ResponseWriter, r *http.Request) {
+	var request openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		openAIError(w, http.StatusBadRequest, "invalid_request_error", nil, err.Error())
+		return
+	}
+
+	o.mu.Lock()
+	o.requests = append(o.requests, request)
+	content := o.content
+	vocabulary := o.vocabulary
+	o.mu.Unlock()
+
+	if content == "" {
+		content = completionContent(request, vocabulary)
+	}
+	usage := openai.Usage{PromptTokens: 150, CompletionTokens: 10 * len(content) / 4}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+
+	if !request.Stream {
+		writeJSON(w, openai.ChatCompletionResponse{
+			ID:      "chatcmpl-fake",
+			Object:  "chat.completion",
+			Created: time.Now().Unix(),
+			Model:   openAIModel,
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+				FinishReason: openai.FinishReasonStop,
+			}},
+			Usage: usage,
+		})
+		return
+	}
+
+	// Stream the content in small chunks, like tokens
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	send := func(chunk openai.ChatCompletionStreamResponse) {
+		chunk.ID, chunk.Object, chunk.Model = "chatcmpl-fake", "chat.completion.chunk", openAIModel
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	for start := 0; start < len(content); start += 16 {
+		send(openai.ChatCompletionStreamResponse{
+			Choices: []openai.ChatCompletionStreamChoice{{
+				Delta: openai.ChatCompletionStreamChoiceDelta{Content: content[start:min(start+16, len(content))]},
+			}},
+		})
+	}
+	if request.StreamOptions != nil && request.StreamOptions.IncludeUsage {
+		send(openai.ChatCompletionStreamResponse{Choices: []openai.ChatCompletionStreamChoice{}, Usage: &usage})
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// completionContent answers a vocabulary prompt with the number of words it asks for
+func completionContent(request openai.ChatCompletionRequest, vocabulary []models.VocabularyItem) string {
+	count := len(vocabulary)
+	for _, message := range request.Messages {
+		if match := wordCountPattern.FindStringSubmatch(message.Content); match != nil {
+			n, _ := strconv.Atoi(match[1])
+			count = min(n, count)
+		}
+	}
+
+	data, _ := json.MarshalIndent(vocabulary[:count], "", "  ")
+	return string(data)
+}
+
+// moderation flags inputs that contain one of the flagged terms
+func (o *OpenAI) moderation(w http.ResponseWriter, r *http.Request) {
+	var request openai.ModerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		openAIError(w, http.StatusBadRequest, "invalid_request_error", nil, err.Error())
+		return
+	}
+
+	o.mu.Lock()
+	var result openai.Result
+	for _, term := range o.flagged {
+		if strings.Contains(strings.ToLower(request.Input), strings.ToLower(term)) {
+			result.Flagged = true
+			result.Categories.Violence = true
+		}
+	}
+	o.mu.Unlock()
+
+	writeJSON(w, openai.ModerationResponse{ID: "modr-fake", Model: request.Model, Results: []openai.Result{result}})
+}
+
+// speech answers with a few bytes that stand in for MP3 audio of the input
+func (o *OpenAI) speech(w http.ResponseWriter, r *http.Request) {
+	var request openai.CreateSpeechRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		openAIError(w, http.StatusBadRequest, "invalid_request_error", nil, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/mpeg")
+	fmt.Fprintf(w, "ID3 fake speech: %s", request.Input)
+}
+
+// openAIError writes an error in the format of the OpenAI API
+func openAIError(w http.ResponseWriter, status int, errorType string, code any, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(openai.ErrorResponse{Error: &openai.APIError{Type: errorType, Code: code, Message: message}})
+}
@@ -0,0 +1,302 @@
+// Package fakes provides httptest servers that emulate the external APIs the
+// backend depends on, so the whole application can be tested without network
+// access. The fakes answer like the real APIs, including their error and rate
+// limit responses, and record what they were asked.
+package fakes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UnsplashPhoto is a photo served by the fake Unsplash API
+type UnsplashPhoto struct {
+	ID          string
+	Description string
+	Tags        []string
+	Color       color.RGBA
+}
+
+// defaultUnsplashPhotos are the photos every search matches
+var defaultUnsplashPhotos = []UnsplashPhoto{
+	{ID: "fake-bench", Description: "A wooden bench under a tree", Tags: []string{"bench", "park"}, Color: color.RGBA{96, 128, 64, 255}},
+	{ID: "fake-pond", Description: "Ducks on a pond", Tags: []string{"pond", "duck"}, Color: color.RGBA{64, 112, 160, 255}},
+	{ID: "fake-path", Description: "A path through the grass", Tags: []string{"path", "grass"}, Color: color.RGBA{128, 160, 80, 255}},
+	{ID: "fake-kite", Description: "A red kite in the sky", Tags: []string{"kite", "sky"}, Color: color.RGBA{200, 48, 48, 255}},
+	{ID: "fake-swing", Description: "A swing on a playground", Tags: []string{"swing", "playground"}, Color: color.RGBA{224, 176, 64, 255}},
+	{ID: "fake-tree", Description: "An old oak tree", Tags: []string{"tree", "oak"}, Color: color.RGBA{48, 96, 48, 255}},
+}
+
+// Unsplash emulates the search, random photo, photo and download tracking
+// endpoints of the Unsplash API, and serves the photo files themselves. Every
+// API request counts against an hourly rate limit that is reported in the
+// X-Ratelimit headers, as Unsplash does.
+type Unsplash struct {
+	*httptest.Server
+	accessKey string
+
+	photos    []UnsplashPhoto
+	limit     int
+	remaining int
+	status    int // status of every API response when set
+	requests  map[string]int
+	downloads map[string]int
+	mu        sync.Mutex
+}
+
+// NewUnsplash starts a fake Unsplash API that accepts accessKey, with a rate
+// limit of 50 requests, the limit of demo applications. Close it when done.
+func NewUnsplash(accessKey string) *Unsplash {
+	u := &Unsplash{
+		accessKey: accessKey,
+		photos:    defaultUnsplashPhotos,
+		limit:     50,
+		remaining: 50,
+		requests:  make(map[string]int),
+		downloads: make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /search/photos", u.api(u.search))
+	mux.HandleFunc("GET /photos/random", u.api(u.random))
+	mux.HandleFunc("GET /photos/{id}", u.api(u.photo))
+	mux.HandleFunc("GET /photos/{id}/download", u.api(u.download))
+	mux.HandleFunc("GET /files/{id}", u.file)
+	u.Server = httptest.NewServer(mux)
+	return u
+}
+
+// SetPhotos replaces the photos searches and random photos are picked from
+func (u *Unsplash) SetPhotos(photos []UnsplashPhoto) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.photos = photos
+}
+
+// SetRateLimit sets the hourly limit and the requests left in it. Once none
+// are left, API requests are rejected with 403 like Unsplash does.
+func (u *Unsplash) SetRateLimit(limit, remaining int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.limit, u.remaining = limit, remaining
+}
+
+// FailWith makes every API request fail with status, until it is called with zero
+func (u *Unsplash) FailWith(status int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.status = status
+}
+
+// Requests returns how many API requests were made to an endpoint, such as "/search/photos"
+func (u *Unsplash) Requests(endpoint string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.requests[endpoint]
+}
+
+// Downloads returns how many downloads of a photo were tracked
+func (u *Unsplash) Downloads(id string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.downloads[id]
+}
+
+// api wraps an API endpoint with authentication, rate limiting and failures
+func (u *Unsplash) api(handler func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u.mu.Lock()
+		endpoint := r.Pattern[len("GET "):]
+		u.requests[endpoint]++
+		status := u.status
+		exhausted := u.remaining <= 0
+		if !exhausted {
+			u.remaining--
+		}
+		w.Header().Set("X-Ratelimit-Limit", strconv.Itoa(u.limit))
+		w.Header().Set("X-Ratelimit-Remaining", strconv.Itoa(max(u.remaining, 0)))
+		u.mu.Unlock()
+
+		switch {
+		case r.Header.Get("Authorization") != "Client-ID "+u.accessKey:
+			unsplashError(w, http.StatusUnauthorized, "OAuth error: The access token is invalid")
+		case exhausted:
+			// Unsplash answers with plain text once the limit is used up
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "Rate Limit Exceeded")
+		case status != 0:
+			unsplashError(w, status, http.StatusText(status))
+		default:
+			handler(w, r)
+		}
+	}
+}
+
+// search answers a photo search with the first per_page photos
+func (u *Unsplash) search(w http.ResponseWriter, r *http.Request) {
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = 10
+	}
+
+	u.mu.Lock()
+	photos := u.photos[:min(perPage, len(u.photos))]
+	results := make([]map[string]any, 0, len(photos))
+	for _, photo := range photos {
+		results = append(results, u.photoJSON(photo))
+	}
+	total := len(u.photos)
+	u.mu.Unlock()
+
+	writeJSON(w, map[string]any{"total": total, "total_pages": 1, "results": results})
+}
+
+// random answers with random photos, a list when a count is given
+func (u *Unsplash) random(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if len(u.photos) == 0 {
+		unsplashError(w, http.StatusNotFound, "No photos found.")
+		return
+	}
+	offset := int(time.Now().UnixNano() % int64(len(u.photos)))
+
+	raw := r.URL.Query().Get("count")
+	if raw == "" {
+		writeJSON(w, u.photoJSON(u.photos[offset]))
+		return
+	}
+	count, _ := strconv.Atoi(raw)
+	results := make([]map[string]any, 0, count)
+	for i := 0; i < count; i++ {
+		results = append(results, u.photoJSON(u.photos[(offset+i)%len(u.photos)]))
+	}
+	writeJSON(w, results)
+}
+
+// photo answers with a photo by its ID
+func (u *Unsplash) photo(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	photo, ok := u.find(r.PathValue("id"))
+	if !ok {
+		unsplashError(w, http.StatusNotFound, "Couldn't find Photo")
+		return
+	}
+	writeJSON(w, u.photoJSON(photo))
+}
+
+// download tracks a download of a photo
+func (u *Unsplash) download(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	photo, ok := u.find(r.PathValue("id"))
+	if !ok {
+		unsplashError(w, http.StatusNotFound, "Couldn't find Photo")
+		return
+	}
+	u.downloads[photo.ID]++
+	writeJSON(w, map[string]string{"url": u.fileURL(photo)})
+}
+
+// file serves a photo as a JPEG filled with its color, at the size in the w
+// query parameter like the Unsplash image CDN
+func (u *Unsplash) file(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	photo, ok := u.find(strings.TrimSuffix(r.PathValue("id"), ".jpg"))
+	u.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	width := 1200
+	if requested, err := strconv.Atoi(r.URL.Query().Get("w")); err == nil && requested > 0 && requested < width {
+		width = requested
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, width*3/4))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = photo.Color.R, photo.Color.G, photo.Color.B, 255
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(buf.Bytes())
+}
+
+// find returns a photo by its ID, the caller must hold the lock
+func (u *Unsplash) find(id string) (UnsplashPhoto, bool) {
+	for _, photo := range u.photos {
+		if photo.ID == id {
+			return photo, true
+		}
+	}
+	return UnsplashPhoto{}, false
+}
+
+// fileURL returns the URL of a photo's file, with a query like Unsplash image URLs have
+func (u *Unsplash) fileURL(photo UnsplashPhoto) string {
+	return u.URL + "/files/" + photo.ID + ".jpg?ixid=fake"
+}
+
+// photoJSON returns a photo as the Unsplash API encodes it
+func (u *Unsplash) photoJSON(photo UnsplashPhoto) map[string]any {
+	tags := make([]map[string]string, 0, len(photo.Tags))
+	for _, tag := range photo.Tags {
+		tags = append(tags, map[string]string{"title": tag})
+	}
+	file := u.fileURL(photo)
+	return map[string]any{
+		"id":              photo.ID,
+		"description":     photo.Description,
+		"alt_description": strings.ToLower(photo.Description),
+		"width":           4000,
+		"height":          3000,
+		"created_at":      "2024-05-01T12:00:00Z",
+		"color":           fmt.Sprintf("#%02x%02x%02x", photo.Color.R, photo.Color.G, photo.Color.B),
+		"tags":            tags,
+		"urls": map[string]string{
+			"raw":     file,
+			"regular": file + "&w=1080",
+			"small":   file + "&w=400",
+		},
+		"links": map[string]string{
+			"html":     "https://unsplash.com/photos/" + photo.ID,
+			"download": u.URL + "/photos/" + photo.ID + "/download",
+		},
+		"user": map[string]any{
+			"name":  "Fake Photographer",
+			"links": map[string]string{"html": "https://unsplash.com/@fake"},
+		},
+	}
+}
+
+// unsplashError writes an error in the format of the Unsplash API
+func unsplashError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]string{"errors": {message}})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/picto-lingua-backend/config"
+)
+
+var (
+	adminAPIKey string
+)
+
+// InitAdminHandler initializes the admin handler with the key that protects it
+func InitAdminHandler(cfg *config.Config) {
+	adminAPIKey = cfg.AdminAPIKey
+}
+
+// AdminRequired is a middleware that only lets requests with the admin key in
+// the X-Admin-Key header through. Admin endpoints are disabled without a key.
+func AdminRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminAPIKey == "" {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "admin API is disabled"})
+			return
+		}
+
+		key := c.GetHeader("X-Admin-Key")
+		if subtle.ConstantTimeCompare([]byte(key), []byte(adminAPIKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin key"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/picto-lingua-backend/api/services"
+	"github.com/yourusername/picto-lingua-backend/config"
+)
+
+var (
+	audioService *services.AudioService
+)
+
+// InitAudioHandler initializes the audio handler with necessary services
+func InitAudioHandler(cfg *config.Config) {
+	audioService = services.NewAudioService(newSpeechSynthesizer(cfg), cfg.AudioCacheDir)
+}
+
+// newSpeechSynthesizer picks the speech synthesizer based on the configuration
+func newSpeechSynthesizer(cfg *config.Config) services.SpeechSynthesizer {
+	provider := strings.ToLower(cfg.TTSProvider)
+	if provider == "" {
+		provider = "mock"
+		if cfg.OpenAIAPIKey != "" {
+			provider = "openai"
+		}
+	}
+
+	switch provider {
+	case "openai":
+		if cfg.OpenAIAPIKey != "" {
+			return services.NewOpenAISpeechSynthesizer(cfg.OpenAIAPIKey, cfg.OpenAIBaseURL)
+		}
+		log.Printf("WARNING: No OpenAI API key provided, using mock speech synthesizer")
+	case "command":
+		synthesizer, err := services.NewCommandSpeechSynthesizer(cfg.TTSCommand)
+		if err == nil {
+			return synthesizer
+		}
+		log.Printf("WARNING: Invalid text-to-speech command, using mock speech synthesizer: %v", err)
+	case "mock":
+	default:
+		log.Printf("WARNING: Unknown text-to-speech provider %q, using mock speech synthesizer", provider)
+	}
+
+	return services.MockSpeechSynthesizer{}
+}
+
+// GetAudio handles the request to get pronunciation audio for a word
+func GetAudio(c *gin.Context) {
+	// Get the word from the query parameters
+	word := strings.TrimSpace(c.Query("word"))
+	if word == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "word is required"})
+		return
+	}
+	if len(word) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "word is too long"})
+		return
+	}
+
+	// Get the language parameter, default to "english"
+	language := strings.ToLower(c.DefaultQuery("language", "english"))
+	if _, ok := services.LanguageCode(language); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported language"})
+		return
+	}
+
+	// Get the audio from the service (with caching)
+	audio, err := audioService.GetAudio(c.Request.Context(), word, language)
+	if err != nil {
+		log.Printf("Error getting audio: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get audio"})
+		return
+	}
+
+	// The URL names a word, not its audio, which changes with the voice or
+	// synthesizer. Browsers revalidate with the hash of the audio and get a
+	// 304 while it is unchanged.
+	c.Header("Content-Type", audio.ContentType)
+	c.Header("Cache-Control", "public, no-cache")
+	c.Header("ETag", `"`+audio.Hash+`"`)
+	c.File(audio.Path)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/picto-lingua-backend/api/models"
+	"github.com/yourusername/picto-lingua-backend/api/services"
+	"github.com/yourusername/picto-lingua-backend/config"
+)
+
+var (
+	authService *services.AuthService
+)
+
+// userContextKey is the gin context key holding the authenticated user
+const userContextKey = "user"
+
+// InitAuthHandler initializes the auth handler with necessary services
+func InitAuthHandler(cfg *config.Config) {
+	authService = services.NewAuthService(cfg.AuthTokenTTL)
+	authService.StartJanitor(cfg.AuthJanitorInterval)
+}
+
+// CloseAuthHandler stops the background work of the auth handler
+func CloseAuthHandler() {
+	authService.Close()
+}
+
+// credentialsRequest is the request body for registration and login
+type credentialsRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Register handles the request to create a new user account
+func Register(c *gin.Context) {
+	var request credentialsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := authService.Register(request.Username, request.Password)
+	if errors.Is(err, services.ErrUsernameTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"user":   user,
+		"status": "success",
+	})
+}
+
+// Login handles the request to exchange credentials for an access token
+func Login(c *gin.Context) {
+	var request credentialsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, user, err := authService.Login(request.Username, request.Password)
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error logging in: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log in"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"token_type": "Bearer",
+		"user":       user,
+	})
+}
+
+// LoginAnonymous handles the request to create a device account and get its access token
+func LoginAnonymous(c *gin.Context) {
+	token, user, err := authService.CreateAnonymous()
+	if err != nil {
+		log.Printf("Error creating anonymous user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create anonymous user"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":      token,
+		"token_type": "Bearer",
+		"user":       user,
+	})
+}
+
+// Logout handles the request to revoke the current access token
+func Logout(c *gin.Context) {
+	authService.Logout(bearerToken(c))
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// GetMe handles the request to get the authenticated user
+func GetMe(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"user": CurrentUser(c)})
+}
+
+// AuthRequired is a middleware that rejects requests without a valid bearer token
+func AuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c)
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+
+		user, err := authService.Authenticate(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(userContextKey, user)
+		c.Next()
+	}
+}
+
+// bearerToken extracts the token from the Authorization header
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// CurrentUser returns the user set by AuthRequired
+func CurrentUser(c *gin.Context) *models.User {
+	user, _ := c.MustGet(userContextKey).(*models.User)
+	return user
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/picto-lingua-backend/api/services"
+	"github.com/yourusername/picto-lingua-backend/config"
+)
+
+var (
+	responseCache *services.Cache
+)
+
+// InitCacheHandler initializes the cache shared by the vocabulary and images.
+// It must be called before the image and vocabulary handlers are initialized.
+func InitCacheHandler(cfg *config.Config) {
+	if cfg.CacheDir == "" {
+		log.Printf("CACHE_DIR is empty, vocabulary and images are only cached in memory")
+	}
+	responseCache = services.NewCache(cfg.CacheDir)
+}
+
+// GetCacheStats handles the request to show the size and hit rate of the caches
+func GetCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"namespaces": responseCache.Stats()})
+}
+
+// PurgeCache handles the request to empty one cache namespace, or all of them
+// when no namespace is given
+func PurgeCache(c *gin.Context) {
+	namespace := c.Query("namespace")
+
+	purged, err := responseCache.Purge(namespace)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownCacheNamespace) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown cache namespace"})
+			return
+		}
+		log.Printf("Error purging cache: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to purge cache"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// AssignmentContentSource resolves the vocabulary and image frozen into an assignment
+type AssignmentContentSource interface {
+	AssignmentContent(assignmentID string) ([]models.VocabularyItem, *models.Image, bool)
+}
+
+var assignmentContent AssignmentContentSource
+
+// SetAssignmentContentSource sets where sessions linked to an assignment get their
+// image when they are resumed
+func SetAssignmentContentSource(source AssignmentContentSource) {
+	assignmentContent = source
+}
+
+// ContentProvider gives packages that build on the handlers access to the
+// vocabulary and images served by the API
+type ContentProvider struct{}
+
+// Content returns the content provider, it is usable once the image and
+// vocabulary handlers have been initialized
+func Content() ContentProvider {
+	return ContentProvider{}
+}
+
+// Vocabulary returns the vocabulary of a theme in a language, with pronunciation overrides applied
+func (ContentProvider) Vocabulary(themeID, language string, count int) ([]models.VocabularyItem, error) {
+	vocabulary, err := openAIService.GetVocabularyForLanguage(themeID, count, language)
+	if err != nil {
+		return nil, err
+	}
+	return pronunciationService.Apply(vocabulary), nil
+}
+
+// Image returns an image by its ID
+func (ContentProvider) Image(imageID string) (*models.Image, error) {
+	return imageProviders.GetImage(imageID)
+}
+
+// RandomImage returns a random image for a theme
+func (ContentProvider) RandomImage(themeID string) (*models.Image, error) {
+	return imageProviders.GetRandomImage(themeID)
+}
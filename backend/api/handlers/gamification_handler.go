@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/picto-lingua-backend/api/services"
+)
+
+var (
+	gamificationService *services.GamificationService
+)
+
+// InitGamificationHandler initializes the gamification handler with necessary services.
+// It must be called after InitSessionHandler.
+func InitGamificationHandler() {
+	gamificationService = services.NewGamificationService()
+	sessionService.AddProgressListener(gamificationService.RecordProgress)
+}
+
+// GetGamification handles the request to get the XP, streak and goal of the authenticated user
+func GetGamification(c *gin.Context) {
+	c.JSON(http.StatusOK, gamificationService.GetStatus(CurrentUser(c).ID))
+}
+
+// UpdateGamification handles the request to change the daily goal or timezone of the authenticated user
+func UpdateGamification(c *gin.Context) {
+	var request struct {
+		DailyGoal int    `json:"daily_goal"`
+		Timezone  string `json:"timezone"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := gamificationService.UpdateSettings(CurrentUser(c).ID, request.DailyGoal, request.Timezone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
@@ -1,23 +1,55 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/yourusername/picto-lingua-backend/api/services"
 	"github.com/yourusername/picto-lingua-backend/config"
 )
 
+// imagesPerTheme is the number of images shown for a theme
+const imagesPerTheme = 5
+
 var (
 	unsplashService *services.UnsplashService
+	imageProviders  *services.ImageChain
 	themeService    *services.ThemeService
+	imageProxy      *services.ImageProxy
 )
 
 // InitImageHandler initializes the image handler with necessary services
 func InitImageHandler(cfg *config.Config) {
-	unsplashService = services.NewUnsplashService(cfg.UnsplashAccessKey)
+	unsplashService = services.NewUnsplashService(cfg.UnsplashAccessKey, cfg.UnsplashBaseURL, contentBlocklist)
+
+	var providers []services.ImageProvider
+	for _, name := range cfg.ImageProviders {
+		switch strings.ToLower(name) {
+		case "unsplash":
+			providers = append(providers, unsplashService)
+		case "pexels":
+			providers = append(providers, services.NewPexelsService(cfg.PexelsAPIKey, cfg.PexelsBaseURL, contentBlocklist))
+		case "wikimedia":
+			providers = append(providers, services.NewWikimediaService(cfg.WikimediaBaseURL, contentBlocklist))
+		default:
+			log.Printf("WARNING: Unknown image provider %q, ignoring it", name)
+		}
+	}
+	imageProviders = services.NewImageChain(responseCache.Namespace("images", cfg.ImageCacheTTL), cfg.ImageQuotaThreshold, providers...)
+	if !imageProviders.Configured() {
+		log.Printf("WARNING: No image provider is configured, themes will have no images")
+	}
+
 	themeService = services.NewThemeService()
+	imageProxy = services.NewImageProxy(imageProviders, cfg.ImageDir)
 }
 
 // GetImages handles the request to get images for a theme
@@ -35,20 +67,139 @@ func GetImages(c *gin.Context) {
 		return
 	}
 
-	// Get the count parameter, default to 5
-	count := 5
-
-	// Get images from the service
-	images, err := unsplashService.SearchImages(theme, count)
+	// Get images from the first provider that has them (with caching)
+	images, err := imageProviders.SearchImages(theme, imagesPerTheme)
 	if err != nil {
+		if services.IsRateLimited(err) {
+			respondRateLimited(c, err)
+			return
+		}
 		log.Printf("Error getting images: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get images"})
 		return
 	}
 
+	// Images from providers without placeholders get the ones we computed
+	imageProxy.FillPlaceholders(images)
+
 	// Return the images
 	c.JSON(http.StatusOK, gin.H{
 		"theme":  theme,
 		"images": images,
 	})
 }
+
+// CloseImageHandler waits for the image handler's background requests to finish
+func CloseImageHandler() {
+	unsplashService.Close()
+}
+
+// TrackImageDownload handles the request to report to Unsplash that the learner
+// picked an image. Repeated selections of the same image are reported once,
+// and only images we have shown to learners are reported. Other providers do
+// not track downloads.
+func TrackImageDownload(c *gin.Context) {
+	imageID := c.Param("id")
+	if !services.ValidImageID(imageID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image id"})
+		return
+	}
+
+	// Selections are deduplicated per user, or per address for anonymous learners
+	selector := "ip:" + c.ClientIP()
+	if token := bearerToken(c); token != "" {
+		if user, err := authService.Authenticate(token); err == nil {
+			selector = "user:" + user.ID
+		}
+	}
+
+	tracked, err := imageProviders.TrackDownload(imageID, selector)
+	if err != nil {
+		respondImageError(c, imageID, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"tracked": tracked})
+}
+
+// GetImageFile handles the request to get an image file, resized to the w and
+// h query parameters and encoded as the format query parameter (jpeg or webp).
+// Images are served from our own cache, so their URLs are stable.
+func GetImageFile(c *gin.Context) {
+	variant := services.ImageVariant{Format: c.Query("format")}
+	for param, value := range map[string]*int{"w": &variant.Width, "h": &variant.Height} {
+		if raw := c.Query(param); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a number"})
+				return
+			}
+			*value = n
+		}
+	}
+
+	id := c.Param("id")
+	file, err := imageProxy.Get(c.Request.Context(), id, variant)
+	if err != nil {
+		respondImageError(c, id, err)
+		return
+	}
+
+	f, err := os.Open(file.Path)
+	if err != nil {
+		log.Printf("Error opening image file %s: %v", file.Path, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get image"})
+		return
+	}
+	defer f.Close()
+
+	// A variant never changes once it has been created
+	c.Header("Content-Type", file.ContentType)
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", fmt.Sprintf(`"%s-%dx%d-%s"`, id, variant.Width, variant.Height, file.ContentType[len("image/"):]))
+	http.ServeContent(c.Writer, c.Request, "", file.ModTime, f)
+}
+
+// GetImagePlaceholder handles the request to get the BlurHash and dominant
+// color of an image, for images whose provider does not supply them
+func GetImagePlaceholder(c *gin.Context) {
+	id := c.Param("id")
+	placeholder, err := imageProxy.Placeholder(c.Request.Context(), id)
+	if err != nil {
+		respondImageError(c, id, err)
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.JSON(http.StatusOK, placeholder)
+}
+
+// respondImageError responds with the status that matches an image proxy error
+func respondImageError(c *gin.Context, id string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidImageVariant):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrImageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+	case services.IsRateLimited(err):
+		respondRateLimited(c, err)
+	default:
+		log.Printf("Error getting image %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get image"})
+	}
+}
+
+// respondRateLimited responds with 503 and a Retry-After header telling when
+// an image provider is expected to accept requests again
+func respondRateLimited(c *gin.Context, err error) {
+	retryAfter, ok := services.RetryAfter(err)
+	if !ok {
+		retryAfter = time.Minute
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "image provider is rate limited, try again later"})
+}
+
+// GetImageQuotas handles the request to show the rate limit quotas of the image providers
+func GetImageQuotas(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"quotas": imageProviders.Quotas()})
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+
+	"github.com/yourusername/picto-lingua-backend/api/services"
+	"github.com/yourusername/picto-lingua-backend/config"
+)
+
+var (
+	contentBlocklist  *services.Blocklist
+	moderationService *services.ModerationService
+)
+
+// InitModerationHandler initializes the moderation of generated vocabulary and images.
+// It must be called before the image and vocabulary handlers are initialized.
+func InitModerationHandler(cfg *config.Config) {
+	contentBlocklist = services.NewBlocklist(cfg.ModerationBlocklist)
+	moderator := newContentModerator(cfg, contentBlocklist)
+	log.Printf("Moderating generated vocabulary with %s", moderator.Name())
+	moderationService = services.NewModerationService(moderator, contentBlocklist)
+}
+
+// newContentModerator picks the content moderator based on the configuration
+func newContentModerator(cfg *config.Config, blocklist *services.Blocklist) services.ContentModerator {
+	provider := strings.ToLower(cfg.ModerationProvider)
+	if provider == "" {
+		provider = "blocklist"
+		if cfg.OpenAIAPIKey != "" {
+			provider = "openai"
+		}
+	}
+
+	switch provider {
+	case "openai":
+		if cfg.OpenAIAPIKey != "" {
+			return services.NewOpenAIContentModerator(cfg.OpenAIAPIKey, cfg.OpenAIBaseURL)
+		}
+		log.Printf("WARNING: No OpenAI API key provided, moderating with the blocklist")
+	case "blocklist":
+	case "mock":
+		return services.MockContentModerator{}
+	default:
+		log.Printf("WARNING: Unknown moderation provider %q, moderating with the blocklist", provider)
+	}
+
+	return services.NewBlocklistContentModerator(blocklist)
+}
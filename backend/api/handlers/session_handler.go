@@ -1,11 +1,17 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/yourusername/picto-lingua-backend/api/models"
 	"github.com/yourusername/picto-lingua-backend/api/services"
+	"github.com/yourusername/picto-lingua-backend/config"
 )
 
 var (
@@ -13,8 +19,20 @@ var (
 )
 
 // InitSessionHandler initializes the session handler with necessary services
-func InitSessionHandler() {
-	sessionService = services.NewSessionService()
+func InitSessionHandler(cfg *config.Config) {
+	sessionService = services.NewSessionService(cfg.SessionIdleTimeout, cfg.SessionMaxLifetime)
+	sessionService.StartJanitor(cfg.SessionJanitorInterval)
+}
+
+// Sessions returns the session service for packages that build on sessions.
+// It is nil until InitSessionHandler has been called.
+func Sessions() *services.SessionService {
+	return sessionService
+}
+
+// CloseSessionHandler stops the background work of the session handler
+func CloseSessionHandler() {
+	sessionService.Close()
 }
 
 // SaveSession handles the request to save a user's session data
@@ -24,7 +42,10 @@ func SaveSession(c *gin.Context) {
 		ThemeID   string                         `json:"theme_id" binding:"required"`
 		ImageID   string                         `json:"image_id" binding:"required"`
 		Progress  map[string]models.ProgressItem `json:"progress"`
+		Answers   []models.SessionEvent          `json:"answers"`
 		SessionID string                         `json:"session_id"`
+		Language  string                         `json:"language"`
+		WordCount int                            `json:"word_count"`
 	}
 
 	if err := c.ShouldBindJSON(&sessionRequest); err != nil {
@@ -38,33 +59,117 @@ func SaveSession(c *gin.Context) {
 		return
 	}
 
-	var sessionID string
+	userID := CurrentUser(c).ID
+
+	var session *models.SessionData
 	var err error
 
 	// If no session ID is provided, create a new session
 	if sessionRequest.SessionID == "" {
-		sessionID, err = sessionService.CreateSession(sessionRequest.ThemeID, sessionRequest.ImageID)
+		// Remember the language and word count so the session can be resumed
+		language := strings.ToLower(sessionRequest.Language)
+		if language == "" {
+			language = "english"
+		}
+		if _, ok := services.LanguageCode(language); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported language"})
+			return
+		}
+		wordCount := sessionRequest.WordCount
+		if wordCount < 1 || wordCount > 20 {
+			wordCount = 10
+		}
+
+		// The session practices the vocabulary the learner is shown now
+		var vocabulary []models.VocabularyItem
+		vocabulary, err = Content().Vocabulary(sessionRequest.ThemeID, language, wordCount)
+		if err != nil {
+			log.Printf("Error getting vocabulary: %v", err)
+			respondSessionError(c, err, "failed to get vocabulary")
+			return
+		}
+
+		var sessionID string
+		sessionID, err = sessionService.CreateSession(userID, services.SessionOptions{
+			ThemeID:    sessionRequest.ThemeID,
+			ImageID:    sessionRequest.ImageID,
+			Language:   language,
+			WordCount:  wordCount,
+			Vocabulary: vocabulary,
+		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
 			return
 		}
+		session, err = sessionService.GetSession(sessionID, userID)
+		if err != nil {
+			respondSessionError(c, err, "failed to create session")
+			return
+		}
 	} else {
-		// Otherwise update the existing session
-		sessionID = sessionRequest.SessionID
-		err = sessionService.UpdateSession(sessionID, sessionRequest.Progress)
+		// Otherwise record the answers and progress in the existing session,
+		// If-Match makes the update conditional on the version the client last saw
+		expectedVersion, ok := parseIfMatch(c.GetHeader("If-Match"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid If-Match header"})
+			return
+		}
+
+		session, err = sessionService.UpdateSession(sessionRequest.SessionID, userID, services.SessionUpdate{
+			ExpectedVersion: expectedVersion,
+			Answers:         sessionRequest.Answers,
+			Progress:        sessionRequest.Progress,
+		})
+		if errors.Is(err, services.ErrVersionConflict) {
+			// Return the current state so the client can merge and retry
+			current, getErr := sessionService.GetSession(sessionRequest.SessionID, userID)
+			if getErr != nil {
+				respondSessionError(c, getErr, "failed to update session")
+				return
+			}
+			c.Header("ETag", sessionETag(current))
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   err.Error(),
+				"session": current,
+			})
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update session"})
+			respondSessionError(c, err, "failed to update session")
 			return
 		}
 	}
 
-	// Return the session ID
+	// Return the session ID and version
+	c.Header("ETag", sessionETag(session))
 	c.JSON(http.StatusOK, gin.H{
-		"session_id": sessionID,
+		"session_id": session.SessionID,
+		"version":    session.Version,
 		"status":     "success",
 	})
 }
 
+// sessionETag returns the ETag header value for a session version
+func sessionETag(session *models.SessionData) string {
+	return `"` + strconv.Itoa(session.Version) + `"`
+}
+
+// parseIfMatch parses an If-Match header holding a session ETag.
+// It returns zero for a missing header or "*", which match any version.
+func parseIfMatch(header string) (int, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, true
+	}
+
+	header = strings.TrimPrefix(header, "W/")
+	version, err := strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
 // GetSession handles the request to get a user's session data
 func GetSession(c *gin.Context) {
 	// Get the session ID from the query parameters
@@ -75,12 +180,147 @@ func GetSession(c *gin.Context) {
 	}
 
 	// Get the session from the service
-	session, err := sessionService.GetSession(sessionID)
+	session, err := sessionService.GetSession(sessionID, CurrentUser(c).ID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		respondSessionError(c, err, "failed to get session")
 		return
 	}
 
 	// Return the session data
+	c.Header("ETag", sessionETag(session))
 	c.JSON(http.StatusOK, session)
 }
+
+// GetSessionEvents handles the request to replay the answer log of a user's session
+func GetSessionEvents(c *gin.Context) {
+	// Get the session ID from the query parameters
+	sessionID := c.Query("session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "session_id is required"})
+		return
+	}
+
+	// Only return events after this sequence number, default to all events
+	after, err := strconv.Atoi(c.DefaultQuery("after", "0"))
+	if err != nil || after < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after parameter"})
+		return
+	}
+
+	events, err := sessionService.GetEvents(sessionID, CurrentUser(c).ID, after)
+	if err != nil {
+		respondSessionError(c, err, "failed to get session events")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": sessionID,
+		"events":     events,
+	})
+}
+
+// ListSessions handles the request to list the authenticated user's sessions
+func ListSessions(c *gin.Context) {
+	var filter services.SessionFilter
+
+	// Get the optional theme filter from the query parameters
+	filter.ThemeID = c.Query("theme")
+	if filter.ThemeID != "" && !themeService.IsValidTheme(filter.ThemeID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid theme"})
+		return
+	}
+
+	// Get the optional date range, both bounds are inclusive days
+	if from := c.Query("from"); from != "" {
+		day, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from parameter, expected YYYY-MM-DD"})
+			return
+		}
+		filter.From = day
+	}
+	if to := c.Query("to"); to != "" {
+		day, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to parameter, expected YYYY-MM-DD"})
+			return
+		}
+		filter.To = day.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	sessions := sessionService.ListSessions(CurrentUser(c).ID, filter)
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":    len(sessions),
+		"sessions": sessions,
+	})
+}
+
+// ResumeSession handles the request to continue a session where the learner left off.
+// It returns the session with the vocabulary and image needed to pick it up again.
+func ResumeSession(c *gin.Context) {
+	session, vocabulary, err := sessionService.ResumeSession(c.Param("id"), CurrentUser(c).ID)
+	if err != nil {
+		respondSessionError(c, err, "failed to resume session")
+		return
+	}
+	image := sessionImage(session)
+
+	// Continue with the first word the learner has not answered yet
+	nextIndex := len(vocabulary)
+	remaining := make([]string, 0, len(vocabulary))
+	for i, item := range vocabulary {
+		if _, seen := session.Progress[item.Word]; seen {
+			continue
+		}
+		if len(remaining) == 0 {
+			nextIndex = i
+		}
+		remaining = append(remaining, item.Word)
+	}
+
+	c.Header("ETag", sessionETag(session))
+	c.JSON(http.StatusOK, gin.H{
+		"session":         session,
+		"vocabulary":      vocabulary,
+		"image":           image,
+		"next_index":      nextIndex,
+		"remaining_words": remaining,
+		"completed":       len(remaining) == 0,
+	})
+}
+
+// sessionImage returns the image a session practices with, nil when it is
+// not available. Sessions linked to an assignment use its frozen snapshot.
+func sessionImage(session *models.SessionData) *models.Image {
+	if session.AssignmentID != "" && assignmentContent != nil {
+		if _, image, ok := assignmentContent.AssignmentContent(session.AssignmentID); ok {
+			return image
+		}
+	}
+
+	// The image is optional, the learner can still practice without it
+	image, err := imageProviders.GetImage(session.ImageID)
+	if err != nil {
+		log.Printf("Error getting image %s: %v", session.ImageID, err)
+	}
+	return image
+}
+
+// respondSessionError maps session service errors to HTTP responses
+func respondSessionError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+	case errors.Is(err, services.ErrSessionExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "session expired"})
+	case errors.Is(err, services.ErrInvalidAnswer), errors.Is(err, services.ErrInvalidProgress):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSessionForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "access to this session is not allowed"})
+	case errors.Is(err, services.ErrBudgetExceeded):
+		respondBudgetExceeded(c)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/picto-lingua-backend/api/services"
+)
+
+var (
+	statsService *services.StatsService
+)
+
+// InitStatsHandler initializes the stats handler with necessary services.
+// It must be called after InitSessionHandler.
+func InitStatsHandler() {
+	statsService = services.NewStatsService()
+	sessionService.AddProgressListener(statsService.RecordProgress)
+}
+
+// GetStats handles the request to get the learning statistics of the authenticated user
+func GetStats(c *gin.Context) {
+	// Get the optional theme filter from the query parameters
+	theme := c.Query("theme")
+	if theme != "" && !themeService.IsValidTheme(theme) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid theme"})
+		return
+	}
+
+	stats := statsService.GetStats(CurrentUser(c).ID, theme)
+
+	c.JSON(http.StatusOK, stats)
+}
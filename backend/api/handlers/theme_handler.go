@@ -4,8 +4,15 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yourusername/picto-lingua-backend/api/services"
 )
 
+// Themes returns the theme service for packages that build on themes.
+// It is nil until InitImageHandler has been called.
+func Themes() *services.ThemeService {
+	return themeService
+}
+
 // GetThemes handles the request to get all available themes
 func GetThemes(c *gin.Context) {
 	// Get all themes from the service
@@ -1,37 +1,64 @@
 package handlers
 
 import (
+	"errors"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yourusername/picto-lingua-backend/api/models"
 	"github.com/yourusername/picto-lingua-backend/api/services"
 	"github.com/yourusername/picto-lingua-backend/config"
 )
 
 var (
-	openAIService *services.OpenAIService
+	openAIService        *services.OpenAIService
+	pronunciationService *services.PronunciationService
+	usageTracker         *services.UsageTracker
+	promptLibrary        *services.PromptLibrary
 )
 
 // InitVocabularyHandler initializes the vocabulary handler with necessary services
 func InitVocabularyHandler(cfg *config.Config) {
-	openAIService = services.NewOpenAIService(cfg.OpenAIAPIKey)
+	usageTracker = services.NewUsageTracker(cfg.UsageFile, cfg.OpenAIPricing, cfg.DailyBudget, cfg.OverBudgetMode)
+	if cfg.DailyBudget > 0 {
+		log.Printf("OpenAI daily budget is $%.2f, once it is spent vocabulary is served %s", cfg.DailyBudget, usageTracker.OverBudgetMode())
+	}
+
+	var err error
+	promptLibrary, err = services.NewPromptLibrary(cfg.PromptDir)
+	if err != nil {
+		log.Printf("WARNING: Invalid prompt templates in %s, using the built-in ones: %v", cfg.PromptDir, err)
+		promptLibrary, _ = services.NewPromptLibrary("")
+	}
+	promptLibrary.Watch(cfg.PromptReloadInterval)
+
+	openAIService = services.NewOpenAIService(cfg.OpenAIAPIKey, cfg.OpenAIBaseURL, responseCache.Namespace("vocabulary", cfg.VocabularyCacheTTL), promptLibrary, moderationService, usageTracker)
+	pronunciationService = services.NewPronunciationService()
 }
 
-// GetVocabulary handles the request to get vocabulary for a theme
-func GetVocabulary(c *gin.Context) {
+// CloseVocabularyHandler stops watching the prompt templates for changes
+func CloseVocabularyHandler() {
+	promptLibrary.Close()
+}
+
+// vocabularyQuery reads the theme, count and language of a vocabulary request.
+// It responds with an error and returns false if they are invalid.
+func vocabularyQuery(c *gin.Context) (string, int, string, bool) {
 	// Get the theme from the query parameters
 	theme := c.Query("theme")
 	if theme == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "theme is required"})
-		return
+		return "", 0, "", false
 	}
 
 	// Validate the theme
 	if !themeService.IsValidTheme(theme) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid theme"})
-		return
+		return "", 0, "", false
 	}
 
 	// Get the count parameter, default to 10
@@ -39,7 +66,7 @@ func GetVocabulary(c *gin.Context) {
 	count, err := strconv.Atoi(countStr)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid count parameter"})
-		return
+		return "", 0, "", false
 	}
 
 	// Limit count to reasonable bounds
@@ -49,20 +76,39 @@ func GetVocabulary(c *gin.Context) {
 		count = 20
 	}
 
-	// Get the language parameter, default to "english"
-	language := c.DefaultQuery("language", "english")
+	// Get the language parameter, default to "english". Every language is
+	// part of the cache key, so unsupported ones never reach the generator.
+	language := strings.ToLower(c.DefaultQuery("language", "english"))
+	if _, ok := services.LanguageCode(language); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported language"})
+		return "", 0, "", false
+	}
 
-	// Set the language in the OpenAI service
-	openAIService.SetLanguage(language)
+	return theme, count, language, true
+}
+
+// GetVocabulary handles the request to get vocabulary for a theme
+func GetVocabulary(c *gin.Context) {
+	theme, count, language, ok := vocabularyQuery(c)
+	if !ok {
+		return
+	}
 
 	// Get vocabulary from the service (with caching)
-	vocabulary, err := openAIService.GetVocabularyWithCache(theme, count)
+	vocabulary, err := openAIService.GetVocabularyForLanguage(theme, count, language)
 	if err != nil {
+		if errors.Is(err, services.ErrBudgetExceeded) {
+			respondBudgetExceeded(c)
+			return
+		}
 		log.Printf("Error getting vocabulary: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get vocabulary"})
 		return
 	}
 
+	// Apply pronunciation overrides set by admins
+	vocabulary = pronunciationService.Apply(vocabulary)
+
 	// Return the vocabulary
 	c.JSON(http.StatusOK, gin.H{
 		"theme":      theme,
@@ -71,3 +117,89 @@ func GetVocabulary(c *gin.Context) {
 		"vocabulary": vocabulary,
 	})
 }
+
+// StreamVocabulary handles the request to stream vocabulary for a theme as
+// Server-Sent Events. Every item is sent as a "vocabulary" event as soon as it
+// has been generated, followed by a "done" event, or an "error" event if
+// generation fails.
+func StreamVocabulary(c *gin.Context) {
+	theme, count, language, ok := vocabularyQuery(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // stop proxies from buffering the stream
+
+	// Generation stops when the client goes away
+	index := 0
+	vocabulary, err := openAIService.StreamVocabulary(c.Request.Context(), theme, count, language, func(item models.VocabularyItem) error {
+		// Apply pronunciation overrides set by admins
+		item = pronunciationService.Apply([]models.VocabularyItem{item})[0]
+
+		c.SSEvent("vocabulary", gin.H{
+			"index": index,
+			"item":  item,
+		})
+		c.Writer.Flush()
+		index++
+		return c.Request.Context().Err()
+	})
+	if err != nil {
+		if c.Request.Context().Err() == nil {
+			message := "failed to get vocabulary"
+			if errors.Is(err, services.ErrBudgetExceeded) {
+				message = budgetExceededMessage
+			} else {
+				log.Printf("Error streaming vocabulary: %v", err)
+			}
+			c.SSEvent("error", gin.H{"error": message})
+			c.Writer.Flush()
+		}
+		return
+	}
+
+	c.SSEvent("done", gin.H{
+		"theme":    theme,
+		"count":    len(vocabulary),
+		"language": language,
+	})
+	c.Writer.Flush()
+}
+
+// SetPronunciation handles the request to override the IPA transcription of a word
+func SetPronunciation(c *gin.Context) {
+	var override services.PronunciationOverride
+	if err := c.ShouldBindJSON(&override); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saved, err := pronunciationService.SetOverride(override)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pronunciation": saved,
+		"status":        "success",
+	})
+}
+
+// budgetExceededMessage tells learners that new vocabulary is not generated today
+const budgetExceededMessage = "vocabulary for this theme is not available until tomorrow, try another theme"
+
+// respondBudgetExceeded responds with 503 and a Retry-After header telling
+// when the daily OpenAI budget is reset
+func respondBudgetExceeded(c *gin.Context) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(usageTracker.BudgetResetIn().Seconds()))))
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": budgetExceededMessage})
+}
+
+// GetUsage handles the request to show the OpenAI tokens used for vocabulary, their cost and the daily budget
+func GetUsage(c *gin.Context) {
+	c.JSON(http.StatusOK, usageTracker.Report())
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/picto-lingua-backend/api/services"
+	"github.com/yourusername/picto-lingua-backend/config"
+)
+
+var (
+	warmer *services.Warmer
+)
+
+// InitWarmerHandler initializes the cache warmer and starts it unless it is disabled.
+// It must be called after the image and vocabulary handlers have been initialized.
+func InitWarmerHandler(cfg *config.Config) {
+	warmer = services.NewWarmer(themeService, openAIService, imageProviders, services.WarmerOptions{
+		Languages:      cfg.WarmerLanguages,
+		Levels:         cfg.WarmerLevels,
+		ImagesPerTheme: imagesPerTheme,
+		Concurrency:    cfg.WarmerConcurrency,
+		Interval:       cfg.WarmerInterval,
+	})
+
+	if cfg.WarmerInterval <= 0 {
+		log.Printf("Cache warmer is disabled")
+		return
+	}
+	warmer.Start()
+}
+
+// CloseWarmerHandler stops the cache warmer
+func CloseWarmerHandler() {
+	warmer.Close()
+}
+
+// GetWarmerStatus handles the request to show which themes have warm caches
+func GetWarmerStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, warmer.Status())
+}
@@ -1,6 +1,6 @@
 package models
 
-// Image represents an image from Unsplash
+// Image represents an image from one of the image providers
 type Image struct {
 	ID          string `json:"id"`
 	URL         string `json:"url"`
@@ -9,6 +9,13 @@ type Image struct {
 	Width       int    `json:"width"`
 	Height      int    `json:"height"`
 	CreatedAt   string `json:"created_at"`
+	// Placeholder shown while the image loads
+	BlurHash string `json:"blur_hash,omitempty"`
+	Color    string `json:"color,omitempty"` // dominant color, e.g. "#a0c4e2"
+	// Where the image comes from
+	Provider  string `json:"provider"`          // "unsplash", "pexels" or "wikimedia"
+	SourceURL string `json:"source_url"`        // page of the image at the provider
+	License   string `json:"license,omitempty"` // for images that are not free to use without attribution
 	// Attribution information
 	Photographer      string `json:"photographer"`
 	PhotographerURL   string `json:"photographer_url"`
@@ -16,14 +23,22 @@ type Image struct {
 	AttributionString string `json:"attribution_string"`
 }
 
+// ImagePlaceholder represents what is shown while an image loads
+type ImagePlaceholder struct {
+	BlurHash string `json:"blur_hash"`
+	Color    string `json:"color"`
+}
+
 // VocabularyItem represents a vocabulary word and its definition
 type VocabularyItem struct {
 	Word            string `json:"word"`
 	Definition      string `json:"definition"`
 	Example         string `json:"example,omitempty"`
+	IPA             string `json:"ipa,omitempty"` // IPA transcription of Word
 	DutchWord       string `json:"dutch_word,omitempty"`
 	DutchDefinition string `json:"dutch_definition,omitempty"`
 	DutchExample    string `json:"dutch_example,omitempty"`
+	DutchIPA        string `json:"dutch_ipa,omitempty"` // IPA transcription of DutchWord
 }
 
 // Theme represents a learning theme
@@ -33,14 +48,40 @@ type Theme struct {
 	Description string `json:"description,omitempty"`
 }
 
+// User represents a registered learner
+type User struct {
+	ID           string `json:"id"`
+	Username     string `json:"username"`
+	PasswordHash string `json:"-"`
+	Anonymous    bool   `json:"anonymous"` // device account without a password
+	CreatedAt    string `json:"created_at"`
+}
+
 // SessionData represents a user's learning session data
 type SessionData struct {
-	ThemeID     string                  `json:"theme_id"`
-	ImageID     string                  `json:"image_id"`
-	Progress    map[string]ProgressItem `json:"progress"`
-	SessionID   string                  `json:"session_id"`
-	StartedAt   string                  `json:"started_at"`
-	LastUpdated string                  `json:"last_updated"`
+	UserID  string `json:"user_id"`
+	ThemeID string `json:"theme_id"`
+	ImageID string `json:"image_id"`
+	// AssignmentID links the session to the classroom assignment it practices, if any
+	AssignmentID string                  `json:"assignment_id,omitempty"`
+	Language     string                  `json:"language,omitempty"`
+	WordCount    int                     `json:"word_count,omitempty"`
+	Progress     map[string]ProgressItem `json:"progress"`
+	SessionID    string                  `json:"session_id"`
+	StartedAt    string                  `json:"started_at"`
+	LastUpdated  string                  `json:"last_updated"`
+	ExpiresAt    string                  `json:"expires_at"`
+	Version      int                     `json:"version"` // incremented on every update, exposed as the ETag
+}
+
+// SessionEvent represents a single flashcard answer recorded in a session
+type SessionEvent struct {
+	Sequence   int    `json:"sequence"` // position in the session's event log, starting at 1
+	Word       string `json:"word"`
+	Result     string `json:"result"` // "known", "learning", "difficult"
+	DurationMs int    `json:"duration_ms,omitempty"`
+	Timestamp  string `json:"timestamp"`   // when the learner answered
+	RecordedAt string `json:"recorded_at"` // when the server stored the answer
 }
 
 // ProgressItem represents a user's progress on a specific vocabulary item
@@ -51,3 +92,144 @@ type ProgressItem struct {
 	SeenCount  int    `json:"seen_count"`
 	KnownCount int    `json:"known_count"`
 }
+
+// UserStats represents a learner's aggregated progress across all themes
+type UserStats struct {
+	UserID        string       `json:"user_id"`
+	WordsSeen     int          `json:"words_seen"`
+	TotalReviews  int          `json:"total_reviews"`
+	KnownRatio    float64      `json:"known_ratio"`
+	AverageTimeMs float64      `json:"average_time_ms"`
+	Themes        []ThemeStats `json:"themes"`
+}
+
+// ThemeStats represents a learner's aggregated progress on one theme
+type ThemeStats struct {
+	ThemeID       string       `json:"theme_id"`
+	WordsSeen     int          `json:"words_seen"`
+	TotalReviews  int          `json:"total_reviews"`
+	KnownRatio    float64      `json:"known_ratio"`
+	AverageTimeMs float64      `json:"average_time_ms"`
+	HardestWords  []WordStats  `json:"hardest_words"`
+	Timeline      []DailyStats `json:"timeline"`
+}
+
+// WordStats represents a learner's aggregated progress on one word
+type WordStats struct {
+	Word       string  `json:"word"`
+	SeenCount  int     `json:"seen_count"`
+	KnownCount int     `json:"known_count"`
+	KnownRatio float64 `json:"known_ratio"`
+}
+
+// DailyStats represents a learner's activity on one day
+type DailyStats struct {
+	Date     string `json:"date"` // YYYY-MM-DD in UTC
+	Reviews  int    `json:"reviews"`
+	Known    int    `json:"known"`
+	NewWords int    `json:"new_words"`
+}
+
+// GamificationStatus represents a learner's XP, streak and daily goal progress
+type GamificationStatus struct {
+	XP             int    `json:"xp"`
+	Level          int    `json:"level"`
+	CurrentStreak  int    `json:"current_streak"`
+	LongestStreak  int    `json:"longest_streak"`
+	StreakFreezes  int    `json:"streak_freezes"`
+	DailyGoal      int    `json:"daily_goal"`
+	WordsToday     int    `json:"words_today"`
+	GoalMetToday   bool   `json:"goal_met_today"`
+	Timezone       string `json:"timezone"`
+	LastActiveDate string `json:"last_active_date,omitempty"` // YYYY-MM-DD in Timezone
+}
+
+// WarmerStatus represents the state of the background cache warmer
+type WarmerStatus struct {
+	Running      bool          `json:"running"`
+	LastStarted  string        `json:"last_started,omitempty"`
+	LastFinished string        `json:"last_finished,omitempty"`
+	NextRun      string        `json:"next_run,omitempty"`
+	Themes       []ThemeWarmth `json:"themes"`
+}
+
+// ThemeWarmth represents whether the vocabulary and images of a theme are cached
+type ThemeWarmth struct {
+	ThemeID    string             `json:"theme_id"`
+	Warm       bool               `json:"warm"` // every language, level and the images are cached
+	Vocabulary []VocabularyWarmth `json:"vocabulary"`
+	Images     ImageWarmth        `json:"images"`
+}
+
+// VocabularyWarmth represents whether the vocabulary of a theme is cached for a language and level
+type VocabularyWarmth struct {
+	Language string `json:"language"`
+	Level    int    `json:"level"` // number of words
+	Warm     bool   `json:"warm"`
+	Error    string `json:"error,omitempty"` // why the last attempt to warm it failed
+}
+
+// ImageWarmth represents whether the image search of a theme is cached
+type ImageWarmth struct {
+	Warm  bool   `json:"warm"`
+	Error string `json:"error,omitempty"`
+}
+
+// CacheStats represents the size and hit rate of a cache namespace
+type CacheStats struct {
+	Namespace string `json:"namespace"`
+	Entries   int    `json:"entries"`
+	Hits      int64  `json:"hits"`
+	Misses    int64  `json:"misses"`
+	TTL       string `json:"ttl,omitempty"` // empty when entries do not expire
+	Persisted bool   `json:"persisted"`     // entries are written to disk
+}
+
+// ProviderQuota represents the rate limit quota of an image provider
+type ProviderQuota struct {
+	Provider  string `json:"provider"`
+	Reported  bool   `json:"reported"` // the provider reported its quota, Limit and Remaining are zero until then
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	ResetAt   string `json:"reset_at,omitempty"` // when the quota is expected to be refilled
+	UpdatedAt string `json:"updated_at,omitempty"`
+	// Threshold is the number of requests below which the provider is no
+	// longer asked, so cached and fallback images are served instead
+	Threshold int  `json:"threshold"`
+	Throttled bool `json:"throttled"`
+}
+
+// ModelPrice is the price of a model in US dollars per million tokens
+type ModelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// TokenUsage represents the OpenAI tokens used by a number of requests and their cost
+type TokenUsage struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"` // in US dollars
+}
+
+// ThemeUsage represents the tokens used to generate the vocabulary of a theme in a language
+type ThemeUsage struct {
+	Theme    string `json:"theme"`
+	Language string `json:"language"`
+	TokenUsage
+}
+
+// UsageReport represents the OpenAI tokens used for vocabulary and the daily budget
+type UsageReport struct {
+	Total  TokenUsage            `json:"total"`
+	Today  TokenUsage            `json:"today"`
+	Days   map[string]TokenUsage `json:"days"`   // by UTC date, YYYY-MM-DD
+	Models map[string]TokenUsage `json:"models"` // by model
+	Themes []ThemeUsage          `json:"themes"`
+	// DailyBudget is the spend allowed per UTC day in US dollars, zero when there is no budget
+	DailyBudget    float64 `json:"daily_budget"`
+	BudgetExceeded bool    `json:"budget_exceeded"`
+	// OverBudgetMode is how vocabulary is served once the budget is exceeded, "cache-only" or "mock"
+	OverBudgetMode string `json:"over_budget_mode,omitempty"`
+}
@@ -0,0 +1,159 @@
+package race
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeTimeout is how long a single write to a client may take
+	writeTimeout = 10 * time.Second
+	// pongTimeout is how long a client may stay silent before it is dropped
+	pongTimeout = 60 * time.Second
+	// pingInterval must be shorter than pongTimeout
+	pingInterval = pongTimeout * 9 / 10
+	// maxMessageSize limits the size of client messages
+	maxMessageSize = 4096
+	// sendBuffer is how many messages may queue up for a slow client before it is dropped
+	sendBuffer = 64
+)
+
+// client is a host or player connected over a WebSocket
+type client struct {
+	conn *websocket.Conn
+	send chan any
+	done chan struct{}
+	once sync.Once
+
+	// Only used by the read loop
+	room *room
+}
+
+// newClient wraps a WebSocket connection
+func newClient(conn *websocket.Conn) *client {
+	return &client{
+		conn: conn,
+		send: make(chan any, sendBuffer),
+		done: make(chan struct{}),
+	}
+}
+
+// queue sends a message to the client without blocking.
+// A client that does not keep up is disconnected.
+func (c *client) queue(message any) {
+	select {
+	case <-c.done:
+	case c.send <- message:
+	default:
+		c.close()
+	}
+}
+
+// close disconnects the client after the queued messages have been written
+func (c *client) close() {
+	c.once.Do(func() {
+		close(c.done)
+	})
+}
+
+// writeLoop writes queued messages and keepalive pings until the client is closed
+func (c *client) writeLoop() {
+	ticker := time.NewTicker(pingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message := <-c.send:
+			if err := c.write(message); err != nil {
+				c.close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			// Flush what is queued, such as the final leaderboard, before closing
+			for {
+				select {
+				case message := <-c.send:
+					if err := c.write(message); err != nil {
+						return
+					}
+				default:
+					c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+					c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+					return
+				}
+			}
+		}
+	}
+}
+
+// write writes a single JSON message
+func (c *client) write(message any) error {
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.conn.WriteJSON(message)
+}
+
+// readLoop reads client messages until the connection fails or is closed.
+// Messages before joining a room are handled here, later ones go to the room.
+func (c *client) readLoop(m *Manager) {
+	defer func() {
+		if c.room != nil {
+			c.room.leave(c)
+		}
+		c.close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		// Malformed messages are rejected without ending the connection
+		var message ClientMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			c.queue(ErrorMessage{Type: TypeError, Error: "invalid message"})
+			continue
+		}
+		c.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+
+		if c.room != nil {
+			if err := c.room.handle(c, message); err != nil {
+				c.queue(ErrorMessage{Type: TypeError, Error: err.Error()})
+			}
+			continue
+		}
+
+		var joined *room
+		switch message.Type {
+		case TypeCreate:
+			joined, err = m.create(c, message)
+		case TypeJoin:
+			joined, err = m.join(c, message)
+		default:
+			err = errNotInRoom
+		}
+		if err != nil {
+			c.queue(ErrorMessage{Type: TypeError, Error: err.Error()})
+			continue
+		}
+		c.room = joined
+	}
+}
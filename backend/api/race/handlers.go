@@ -0,0 +1,54 @@
+package race
+
+import (
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	manager  *Manager
+	upgrader websocket.Upgrader
+)
+
+// Init initializes the race handler with the vocabulary questions are built from.
+// WebSocket connections are only accepted from the allowed origins, or
+// from clients that do not send an Origin header.
+func Init(vocabulary VocabularySource, themes ThemeValidator, allowedOrigins []string) {
+	manager = NewManager(vocabulary, themes)
+	upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || slices.Contains(allowedOrigins, origin)
+		},
+	}
+}
+
+// Close closes every running race
+func Close() {
+	manager.Close()
+}
+
+// ServeWS handles the WebSocket connection of a race host or player
+func ServeWS(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader already responded with an error
+		log.Printf("Error upgrading race connection: %v", err)
+		return
+	}
+
+	serve(manager, conn)
+}
+
+// serve runs a client connection until it is closed
+func serve(m *Manager, conn *websocket.Conn) {
+	c := newClient(conn)
+	go c.writeLoop()
+	c.readLoop(m)
+}
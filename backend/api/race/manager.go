@@ -0,0 +1,281 @@
+package race
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	mathrand "math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+	"github.com/yourusername/picto-lingua-backend/api/services"
+)
+
+const (
+	// codeAlphabet leaves out characters that are easily confused, such as 0 and O
+	codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	codeLength   = 5
+
+	// maxRooms limits how many races run at the same time
+	maxRooms = 500
+	// choicesPerQuestion is the number of answers to pick from, when the vocabulary allows it
+	choicesPerQuestion = 4
+
+	defaultQuestions       = 10
+	maxQuestions           = 20
+	defaultQuestionSeconds = 15
+	minQuestionSeconds     = 5
+	maxQuestionSeconds     = 60
+)
+
+// VocabularySource provides the vocabulary questions are built from
+type VocabularySource interface {
+	Vocabulary(themeID, language string, count int) ([]models.VocabularyItem, error)
+}
+
+// ThemeValidator checks theme IDs
+type ThemeValidator interface {
+	IsValidTheme(id string) bool
+}
+
+// Manager keeps track of the running rooms by their join codes
+type Manager struct {
+	vocabulary VocabularySource
+	themes     ThemeValidator
+	rooms      map[string]*room
+	closed     bool
+	mu         sync.Mutex
+	running    sync.WaitGroup
+
+	// resultPause is how long the answer is shown before the next question
+	resultPause time.Duration
+	// lobbyTimeout closes rooms that are never started
+	lobbyTimeout time.Duration
+}
+
+// NewManager creates a new race manager
+func NewManager(vocabulary VocabularySource, themes ThemeValidator) *Manager {
+	return &Manager{
+		vocabulary:   vocabulary,
+		themes:       themes,
+		rooms:        make(map[string]*room),
+		resultPause:  3 * time.Second,
+		lobbyTimeout: 30 * time.Minute,
+	}
+}
+
+// create opens a room hosted by the client
+func (m *Manager) create(host *client, message ClientMessage) (*room, error) {
+	if !m.themes.IsValidTheme(message.ThemeID) {
+		return nil, errors.New("invalid theme")
+	}
+
+	language := strings.ToLower(strings.TrimSpace(message.Language))
+	if language == "" {
+		language = "english"
+	}
+	if _, ok := services.LanguageCode(language); !ok {
+		return nil, errors.New("unsupported language")
+	}
+
+	count := message.Questions
+	if count < 1 || count > maxQuestions {
+		count = defaultQuestions
+	}
+	seconds := message.QuestionSeconds
+	if seconds == 0 {
+		seconds = defaultQuestionSeconds
+	}
+	if seconds < minQuestionSeconds || seconds > maxQuestionSeconds {
+		return nil, fmt.Errorf("question_seconds must be between %d and %d", minQuestionSeconds, maxQuestionSeconds)
+	}
+
+	hostName := strings.TrimSpace(message.Name)
+	if hostName == "" {
+		hostName = "host"
+	}
+	if len(hostName) > maxNameLength {
+		return nil, errors.New("name must be between 1 and 30 characters")
+	}
+
+	vocabulary, err := m.vocabulary.Vocabulary(message.ThemeID, language, count)
+	if err != nil {
+		return nil, errors.New("failed to get vocabulary")
+	}
+	questions := buildQuestions(vocabulary, language, count)
+	if len(questions) == 0 {
+		return nil, errors.New("not enough vocabulary for this theme")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, errRoomClosed
+	}
+	if len(m.rooms) >= maxRooms {
+		return nil, errors.New("too many races are running, try again later")
+	}
+
+	code, err := m.newCode()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &room{
+		code:             code,
+		themeID:          message.ThemeID,
+		language:         language,
+		hostName:         hostName,
+		questions:        questions,
+		questionDuration: time.Duration(seconds) * time.Second,
+		resultPause:      m.resultPause,
+		lobbyTimeout:     m.lobbyTimeout,
+		events:           make(chan roomEvent),
+		stop:             make(chan struct{}),
+		done:             make(chan struct{}),
+		host:             host,
+		players:          make(map[*client]*player),
+		state:            StateLobby,
+	}
+	m.rooms[code] = r
+
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		r.run()
+		m.remove(code)
+	}()
+
+	return r, nil
+}
+
+// join adds the client to the room with the code in the message
+func (m *Manager) join(c *client, message ClientMessage) (*room, error) {
+	code := strings.ToUpper(strings.TrimSpace(message.Code))
+
+	m.mu.Lock()
+	r, ok := m.rooms[code]
+	m.mu.Unlock()
+	if !ok {
+		return nil, errors.New("invalid room code")
+	}
+
+	if err := r.handle(c, message); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// remove forgets a closed room
+func (m *Manager) remove(code string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.rooms, code)
+}
+
+// RoomCount returns the number of open rooms
+func (m *Manager) RoomCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.rooms)
+}
+
+// Close closes every room and waits for them to finish.
+// No rooms can be created afterwards.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	for _, r := range m.rooms {
+		r.shutdown()
+	}
+	m.mu.Unlock()
+
+	m.running.Wait()
+}
+
+// newCode generates a join code that is not in use, the caller must hold the lock
+func (m *Manager) newCode() (string, error) {
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for attempt := 0; attempt < 10; attempt++ {
+		var code strings.Builder
+		for i := 0; i < codeLength; i++ {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", fmt.Errorf("error generating room code: %w", err)
+			}
+			code.WriteByte(codeAlphabet[n.Int64()])
+		}
+		if _, taken := m.rooms[code.String()]; !taken {
+			return code.String(), nil
+		}
+	}
+	return "", errors.New("failed to generate a unique room code")
+}
+
+// buildQuestions turns vocabulary into shuffled multiple choice questions.
+// Each question shows a word and asks for its definition in the race language,
+// the other choices are definitions of other words.
+func buildQuestions(vocabulary []models.VocabularyItem, language string, count int) []question {
+	type card struct {
+		prompt string
+		answer string
+	}
+
+	cards := make([]card, 0, len(vocabulary))
+	seen := make(map[string]bool, len(vocabulary))
+	for _, item := range vocabulary {
+		prompt, answer := item.Word, item.Definition
+		if language == "dutch" && item.DutchWord != "" && item.DutchDefinition != "" {
+			prompt, answer = item.DutchWord, item.DutchDefinition
+		}
+		if prompt == "" || answer == "" || seen[answer] {
+			continue
+		}
+		seen[answer] = true
+		cards = append(cards, card{prompt: prompt, answer: answer})
+	}
+
+	// A question needs at least one wrong choice
+	if len(cards) < 2 {
+		return nil
+	}
+
+	mathrand.Shuffle(len(cards), func(i, j int) {
+		cards[i], cards[j] = cards[j], cards[i]
+	})
+
+	questions := make([]question, 0, min(count, len(cards)))
+	for i := 0; i < len(cards) && len(questions) < count; i++ {
+		choices := []string{cards[i].answer}
+		for _, j := range mathrand.Perm(len(cards)) {
+			if len(choices) == choicesPerQuestion {
+				break
+			}
+			if j != i {
+				choices = append(choices, cards[j].answer)
+			}
+		}
+		mathrand.Shuffle(len(choices), func(a, b int) {
+			choices[a], choices[b] = choices[b], choices[a]
+		})
+
+		correct := 0
+		for k, choice := range choices {
+			if choice == cards[i].answer {
+				correct = k
+			}
+		}
+
+		questions = append(questions, question{
+			prompt:  cards[i].prompt,
+			choices: choices,
+			correct: correct,
+		})
+	}
+
+	return questions
+}
@@ -0,0 +1,110 @@
+package race
+
+// Message types sent by clients
+const (
+	TypeCreate = "create" // host creates a room for a theme
+	TypeJoin   = "join"   // player joins a room with its code
+	TypeStart  = "start"  // host starts the race
+	TypeAnswer = "answer" // player answers the current question
+)
+
+// Message types sent by the server
+const (
+	TypeRoom           = "room"            // room state after creating, joining or a player change
+	TypeQuestion       = "question"        // the next question, pushed to everyone at the same time
+	TypeAnswerResult   = "answer_result"   // the outcome of a player's own answer
+	TypeQuestionResult = "question_result" // the correct answer once a question is over
+	TypeLeaderboard    = "leaderboard"     // live scores after every answer
+	TypeFinished       = "finished"        // final scores, the room closes afterwards
+	TypeClosed         = "closed"          // the room was closed before the race finished
+	TypeError          = "error"           // a rejected message, the connection stays open
+)
+
+// ClientMessage is a message sent by a host or player
+type ClientMessage struct {
+	Type string `json:"type"`
+
+	// create and join
+	Name string `json:"name,omitempty"`
+
+	// create
+	ThemeID         string `json:"theme_id,omitempty"`
+	Language        string `json:"language,omitempty"`
+	Questions       int    `json:"questions,omitempty"`
+	QuestionSeconds int    `json:"question_seconds,omitempty"`
+
+	// join
+	Code string `json:"code,omitempty"`
+
+	// answer
+	Question int `json:"question"`
+	Choice   int `json:"choice"`
+}
+
+// RoomMessage describes a room and who is in it
+type RoomMessage struct {
+	Type      string   `json:"type"`
+	Code      string   `json:"code"`
+	ThemeID   string   `json:"theme_id"`
+	Language  string   `json:"language"`
+	State     string   `json:"state"`
+	Host      string   `json:"host"`
+	Players   []string `json:"players"`
+	Questions int      `json:"questions"`
+	You       string   `json:"you"`
+}
+
+// QuestionMessage asks every player the same question
+type QuestionMessage struct {
+	Type     string   `json:"type"`
+	Index    int      `json:"index"` // starting at 0
+	Total    int      `json:"total"`
+	Prompt   string   `json:"prompt"`
+	Choices  []string `json:"choices"`
+	Seconds  int      `json:"seconds"`
+	Deadline string   `json:"deadline"` // RFC 3339 with fractional seconds
+}
+
+// AnswerResultMessage tells a player how their answer scored
+type AnswerResultMessage struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Correct bool   `json:"correct"`
+	Points  int    `json:"points"`
+	Score   int    `json:"score"`
+}
+
+// QuestionResultMessage reveals the answer to a question
+type QuestionResultMessage struct {
+	Type          string `json:"type"`
+	Index         int    `json:"index"`
+	CorrectChoice int    `json:"correct_choice"`
+	Answer        string `json:"answer"`
+}
+
+// LeaderboardEntry is one player's standing
+type LeaderboardEntry struct {
+	Rank     int    `json:"rank"`
+	Name     string `json:"name"`
+	Score    int    `json:"score"`
+	Correct  int    `json:"correct"`
+	Answered int    `json:"answered"`
+}
+
+// LeaderboardMessage ranks the players, it is also sent as the final result
+type LeaderboardMessage struct {
+	Type    string             `json:"type"`
+	Players []LeaderboardEntry `json:"players"`
+}
+
+// ClosedMessage tells the clients why a room was closed
+type ClosedMessage struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// ErrorMessage rejects a client message
+type ErrorMessage struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
@@ -0,0 +1,393 @@
+package race
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// fakeVocabulary serves the same words for every theme
+type fakeVocabulary struct{}
+
+var testWords = map[string]string{
+	"bench":    "A long seat",
+	"tree":     "A tall plant",
+	"lake":     "A body of water",
+	"path":     "A way for walking",
+	"fountain": "Sends water into the air",
+}
+
+func (fakeVocabulary) Vocabulary(themeID, language string, count int) ([]models.VocabularyItem, error) {
+	vocabulary := make([]models.VocabularyItem, 0, len(testWords))
+	for word, definition := range testWords {
+		vocabulary = append(vocabulary, models.VocabularyItem{Word: word, Definition: definition})
+	}
+	return vocabulary, nil
+}
+
+// fakeThemes only knows the park theme
+type fakeThemes struct{}
+
+func (fakeThemes) IsValidTheme(id string) bool {
+	return id == "park"
+}
+
+// newTestManager creates a manager with short pauses so races finish quickly
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m := NewManager(fakeVocabulary{}, fakeThemes{})
+	m.resultPause = 10 * time.Millisecond
+	t.Cleanup(m.Close)
+	return m
+}
+
+// newTestServer serves race WebSockets for the manager on a test server
+func newTestServer(t *testing.T, m *Manager) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/ws", func(c *gin.Context) {
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return
+		}
+		serve(m, conn)
+	})
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+// testClient is a WebSocket client of a test server
+type testClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func dial(t *testing.T, url string) *testClient {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn}
+}
+
+func (c *testClient) send(message ClientMessage) {
+	c.t.Helper()
+	if err := c.conn.WriteJSON(message); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+// expect reads messages until one of the type arrives and decodes it into v
+func (c *testClient) expect(messageType string, v any) {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.t.Fatalf("waiting for %q: %v", messageType, err)
+		}
+
+		var envelope struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			c.t.Fatalf("invalid message %s: %v", data, err)
+		}
+		if envelope.Type != messageType {
+			continue
+		}
+		if v != nil {
+			if err := json.Unmarshal(data, v); err != nil {
+				c.t.Fatalf("invalid %q message %s: %v", messageType, data, err)
+			}
+		}
+		return
+	}
+}
+
+// expectError reads messages until an error arrives and checks its text
+func (c *testClient) expectError(want error) {
+	c.t.Helper()
+	var message ErrorMessage
+	c.expect(TypeError, &message)
+	if message.Error != want.Error() {
+		c.t.Errorf("error = %q, want %q", message.Error, want.Error())
+	}
+}
+
+// expectDisconnect waits for the server to close the connection
+func (c *testClient) expectDisconnect() {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				c.t.Errorf("expected a close frame, got %v", err)
+			}
+			return
+		}
+	}
+}
+
+// createRoom creates a room as host and returns its code
+func createRoom(t *testing.T, host *testClient, questions int) string {
+	t.Helper()
+	host.send(ClientMessage{Type: TypeCreate, ThemeID: "park", Questions: questions, Name: "teacher"})
+
+	var room RoomMessage
+	host.expect(TypeRoom, &room)
+	if room.State != StateLobby || room.Questions != questions || room.Code == "" {
+		t.Fatalf("unexpected room %+v", room)
+	}
+	return room.Code
+}
+
+// joinRoom joins a room as a player and waits until the player is in it
+func joinRoom(t *testing.T, player *testClient, code, name string) {
+	t.Helper()
+	player.send(ClientMessage{Type: TypeJoin, Code: strings.ToLower(code), Name: name})
+
+	var room RoomMessage
+	player.expect(TypeRoom, &room)
+	if room.You != name {
+		t.Fatalf("joined as %q, want %q", room.You, name)
+	}
+}
+
+// choiceFor returns the index of the correct answer to a question
+func choiceFor(t *testing.T, q QuestionMessage) int {
+	t.Helper()
+	for i, choice := range q.Choices {
+		if choice == testWords[q.Prompt] {
+			return i
+		}
+	}
+	t.Fatalf("no correct choice for %q in %v", q.Prompt, q.Choices)
+	return -1
+}
+
+func TestRaceScoresAndFinishes(t *testing.T) {
+	m := newTestManager(t)
+	url := newTestServer(t, m)
+
+	host := dial(t, url)
+	alice := dial(t, url)
+	bob := dial(t, url)
+
+	code := createRoom(t, host, 2)
+	joinRoom(t, alice, code, "alice")
+	joinRoom(t, bob, code, "bob")
+
+	host.send(ClientMessage{Type: TypeStart})
+
+	for index := 0; index < 2; index++ {
+		// Every client gets the same question
+		var q, qBob, qHost QuestionMessage
+		alice.expect(TypeQuestion, &q)
+		bob.expect(TypeQuestion, &qBob)
+		host.expect(TypeQuestion, &qHost)
+		if q.Index != index || q.Total != 2 || qBob.Prompt != q.Prompt || qHost.Prompt != q.Prompt {
+			t.Fatalf("question %d: alice got %+v, bob %+v, host %+v", index, q, qBob, qHost)
+		}
+		if len(q.Choices) != choicesPerQuestion {
+			t.Errorf("got %d choices, want %d", len(q.Choices), choicesPerQuestion)
+		}
+
+		// Alice answers correctly, Bob picks a wrong answer
+		correct := choiceFor(t, q)
+		alice.send(ClientMessage{Type: TypeAnswer, Question: index, Choice: correct})
+		var aliceResult AnswerResultMessage
+		alice.expect(TypeAnswerResult, &aliceResult)
+		if !aliceResult.Correct || aliceResult.Points <= maxPoints/2 || aliceResult.Points > maxPoints {
+			t.Errorf("alice result = %+v", aliceResult)
+		}
+
+		alice.send(ClientMessage{Type: TypeAnswer, Question: index, Choice: correct})
+		alice.expectError(errAlreadyAnswer)
+
+		bob.send(ClientMessage{Type: TypeAnswer, Question: index, Choice: (correct + 1) % len(q.Choices)})
+		var bobResult AnswerResultMessage
+		bob.expect(TypeAnswerResult, &bobResult)
+		if bobResult.Correct || bobResult.Points != 0 {
+			t.Errorf("bob result = %+v", bobResult)
+		}
+
+		// Everyone answered, so the answer is revealed without waiting for the deadline
+		var result QuestionResultMessage
+		host.expect(TypeQuestionResult, &result)
+		if result.Index != index || result.CorrectChoice != correct {
+			t.Errorf("question result = %+v, want choice %d", result, correct)
+		}
+	}
+
+	var final LeaderboardMessage
+	host.expect(TypeFinished, &final)
+	if len(final.Players) != 2 {
+		t.Fatalf("final leaderboard = %+v", final)
+	}
+	first, second := final.Players[0], final.Players[1]
+	if first.Name != "alice" || first.Rank != 1 || first.Correct != 2 || first.Answered != 2 {
+		t.Errorf("first place = %+v", first)
+	}
+	if second.Name != "bob" || second.Rank != 2 || second.Score != 0 || second.Answered != 2 {
+		t.Errorf("second place = %+v", second)
+	}
+
+	// Finished rooms disconnect their clients and are removed
+	alice.expect(TypeFinished, nil)
+	alice.expectDisconnect()
+	waitForRooms(t, m, 0)
+}
+
+func TestRaceRejectsInvalidMessages(t *testing.T) {
+	m := newTestManager(t)
+	url := newTestServer(t, m)
+
+	host := dial(t, url)
+	player := dial(t, url)
+	late := dial(t, url)
+
+	host.send(ClientMessage{Type: TypeStart})
+	host.expectError(errNotInRoom)
+
+	host.send(ClientMessage{Type: TypeCreate, ThemeID: "space"})
+	host.expectError(errors.New("invalid theme"))
+
+	code := createRoom(t, host, 3)
+
+	host.send(ClientMessage{Type: TypeStart})
+	host.expectError(errNoPlayers)
+
+	player.send(ClientMessage{Type: TypeJoin, Code: "NOPE1", Name: "alice"})
+	player.expectError(errors.New("invalid room code"))
+
+	player.send(ClientMessage{Type: TypeJoin, Code: code, Name: "Teacher"})
+	player.expectError(errNameTaken)
+
+	joinRoom(t, player, code, "alice")
+
+	player.send(ClientMessage{Type: TypeStart})
+	player.expectError(errNotHost)
+
+	host.send(ClientMessage{Type: TypeStart})
+	var q QuestionMessage
+	player.expect(TypeQuestion, &q)
+
+	player.send(ClientMessage{Type: TypeAnswer, Question: q.Index + 1, Choice: 0})
+	player.expectError(errWrongQuestion)
+
+	player.send(ClientMessage{Type: TypeAnswer, Question: q.Index, Choice: len(q.Choices)})
+	player.expectError(errInvalidChoice)
+
+	late.send(ClientMessage{Type: TypeJoin, Code: code, Name: "bob"})
+	late.expectError(errAlreadyStarted)
+}
+
+func TestRaceClosesWhenHostLeaves(t *testing.T) {
+	m := newTestManager(t)
+	url := newTestServer(t, m)
+
+	host := dial(t, url)
+	player := dial(t, url)
+
+	code := createRoom(t, host, 2)
+	joinRoom(t, player, code, "alice")
+
+	host.conn.Close()
+
+	var closed ClosedMessage
+	player.expect(TypeClosed, &closed)
+	if closed.Reason != "the host left" {
+		t.Errorf("reason = %q", closed.Reason)
+	}
+	player.expectDisconnect()
+	waitForRooms(t, m, 0)
+}
+
+func TestRaceClosesIdleLobby(t *testing.T) {
+	m := newTestManager(t)
+	m.lobbyTimeout = 50 * time.Millisecond
+	url := newTestServer(t, m)
+
+	host := dial(t, url)
+	createRoom(t, host, 2)
+
+	var closed ClosedMessage
+	host.expect(TypeClosed, &closed)
+	if closed.Reason != "the race was not started in time" {
+		t.Errorf("reason = %q", closed.Reason)
+	}
+	waitForRooms(t, m, 0)
+}
+
+func TestRaceRejectsUnknownOrigins(t *testing.T) {
+	Init(fakeVocabulary{}, fakeThemes{}, []string{"http://localhost:3000"})
+	t.Cleanup(Close)
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/ws", ServeWS)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	header := http.Header{"Origin": []string{"http://evil.example"}}
+	if _, resp, err := websocket.DefaultDialer.Dial(url, header); err == nil {
+		t.Fatal("connection from an unknown origin was accepted")
+	} else if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unexpected response %v: %v", resp, err)
+	}
+
+	header.Set("Origin", "http://localhost:3000")
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("connection from an allowed origin was rejected: %v", err)
+	}
+	conn.Close()
+}
+
+func TestScoreRewardsSpeed(t *testing.T) {
+	duration := 10 * time.Second
+	tests := []struct {
+		remaining time.Duration
+		want      int
+	}{
+		{duration, maxPoints},
+		{duration / 2, maxPoints * 3 / 4},
+		{0, maxPoints / 2},
+		{-time.Second, maxPoints / 2},
+	}
+	for _, tt := range tests {
+		if got := score(tt.remaining, duration); got != tt.want {
+			t.Errorf("score(%v) = %d, want %d", tt.remaining, got, tt.want)
+		}
+	}
+}
+
+// waitForRooms waits until the manager has the number of open rooms
+func waitForRooms(t *testing.T, m *Manager, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for m.RoomCount() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("open rooms = %d, want %d", m.RoomCount(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
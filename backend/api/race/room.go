@@ -0,0 +1,459 @@
+package race
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Room states
+const (
+	StateLobby    = "lobby"    // waiting for players and for the host to start
+	StateQuestion = "question" // a question is open for answers
+	StateReveal   = "reveal"   // the answer is shown before the next question
+	StateClosed   = "closed"   // finished or closed, the room is removed
+)
+
+const (
+	// maxPlayers limits the size of a room
+	maxPlayers = 50
+	// maxNameLength limits player names
+	maxNameLength = 30
+	// maxPoints is awarded for a correct answer given instantly,
+	// half of it is the base score for a correct answer at the deadline
+	maxPoints = 1000
+)
+
+var (
+	errRoomClosed     = errors.New("the room is closed")
+	errNotInRoom      = errors.New("create or join a room first")
+	errAlreadyInRoom  = errors.New("already in a room")
+	errAlreadyStarted = errors.New("the race has already started")
+	errNameTaken      = errors.New("that name is already taken in this room")
+	errRoomFull       = errors.New("the room is full")
+	errNotHost        = errors.New("only the host can start the race")
+	errNoPlayers      = errors.New("at least one player must join before starting")
+	errNotAnswering   = errors.New("no question is open")
+	errWrongQuestion  = errors.New("that question is no longer open")
+	errAlreadyAnswer  = errors.New("already answered this question")
+	errInvalidChoice  = errors.New("invalid choice")
+	errHostCannotPlay = errors.New("the host cannot answer")
+)
+
+// typeLeave is an internal event for a client that disconnected
+const typeLeave = "leave"
+
+// question is a multiple choice question built from a vocabulary item
+type question struct {
+	prompt  string
+	choices []string
+	correct int
+}
+
+// player is a participant's score in a room
+type player struct {
+	name      string
+	score     int
+	correct   int
+	answered  int
+	connected bool
+}
+
+// roomEvent is a client message handled by the room's goroutine
+type roomEvent struct {
+	client  *client
+	message ClientMessage
+	reply   chan error
+}
+
+// room runs one race. Its state is only touched by its own goroutine,
+// clients talk to it through events.
+type room struct {
+	code             string
+	themeID          string
+	language         string
+	hostName         string
+	questions        []question
+	questionDuration time.Duration
+	resultPause      time.Duration
+	lobbyTimeout     time.Duration
+
+	events   chan roomEvent
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	// Owned by run
+	host     *client
+	players  map[*client]*player
+	order    []*player // join order, breaks leaderboard ties
+	state    string
+	current  int
+	deadline time.Time
+	answered map[*client]bool
+	timer    *time.Timer
+}
+
+// handle passes a client message to the room and waits for the outcome
+func (r *room) handle(c *client, message ClientMessage) error {
+	event := roomEvent{client: c, message: message, reply: make(chan error, 1)}
+
+	select {
+	case r.events <- event:
+	case <-r.done:
+		return errRoomClosed
+	}
+
+	select {
+	case err := <-event.reply:
+		return err
+	case <-r.done:
+		return errRoomClosed
+	}
+}
+
+// leave tells the room a client disconnected
+func (r *room) leave(c *client) {
+	r.handle(c, ClientMessage{Type: typeLeave})
+}
+
+// shutdown closes the room from outside, such as when the server stops
+func (r *room) shutdown() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
+
+// run processes events and timers until the room closes
+func (r *room) run() {
+	defer close(r.done)
+
+	r.timer = time.NewTimer(r.lobbyTimeout)
+	defer r.timer.Stop()
+
+	r.broadcastRoom()
+
+	for r.state != StateClosed {
+		select {
+		case event := <-r.events:
+			event.reply <- r.apply(event.client, event.message)
+		case <-r.timer.C:
+			r.advance()
+		case <-r.stop:
+			r.close("the server is shutting down")
+		}
+	}
+}
+
+// apply handles a client message
+func (r *room) apply(c *client, message ClientMessage) error {
+	switch message.Type {
+	case TypeJoin:
+		return r.join(c, message.Name)
+	case typeLeave:
+		r.remove(c)
+		return nil
+	case TypeStart:
+		return r.start(c)
+	case TypeAnswer:
+		return r.answer(c, message.Question, message.Choice)
+	case TypeCreate:
+		return errAlreadyInRoom
+	default:
+		return errors.New("unknown message type")
+	}
+}
+
+// join adds a player in the lobby
+func (r *room) join(c *client, name string) error {
+	if c == r.host || r.players[c] != nil {
+		return errAlreadyInRoom
+	}
+	if r.state != StateLobby {
+		return errAlreadyStarted
+	}
+	if len(r.players) >= maxPlayers {
+		return errRoomFull
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxNameLength {
+		return errors.New("name must be between 1 and 30 characters")
+	}
+	if strings.EqualFold(name, r.hostName) {
+		return errNameTaken
+	}
+	for _, p := range r.players {
+		if strings.EqualFold(name, p.name) {
+			return errNameTaken
+		}
+	}
+
+	p := &player{name: name, connected: true}
+	r.players[c] = p
+	r.order = append(r.order, p)
+	r.broadcastRoom()
+
+	return nil
+}
+
+// remove handles a disconnected client.
+// The room closes without its host, or when every player has left a running race.
+func (r *room) remove(c *client) {
+	if c == r.host {
+		r.close("the host left")
+		return
+	}
+
+	p := r.players[c]
+	if p == nil {
+		return
+	}
+	delete(r.players, c)
+
+	if r.state == StateLobby {
+		// Players who leave the lobby do not show up on the leaderboard
+		for i, other := range r.order {
+			if other == p {
+				r.order = append(r.order[:i:i], r.order[i+1:]...)
+				break
+			}
+		}
+		r.broadcastRoom()
+		return
+	}
+
+	// Players who leave a running race keep their score
+	p.connected = false
+	if len(r.players) == 0 {
+		r.close("all players left")
+		return
+	}
+	r.broadcastRoom()
+	if r.state == StateQuestion && r.allAnswered() {
+		r.reveal()
+	}
+}
+
+// start begins the race with the first question
+func (r *room) start(c *client) error {
+	if c != r.host {
+		return errNotHost
+	}
+	if r.state != StateLobby {
+		return errAlreadyStarted
+	}
+	if len(r.players) == 0 {
+		return errNoPlayers
+	}
+
+	r.ask(0)
+	return nil
+}
+
+// answer scores a player's answer by correctness and speed
+func (r *room) answer(c *client, index, choice int) error {
+	if c == r.host {
+		return errHostCannotPlay
+	}
+	p := r.players[c]
+	if p == nil {
+		return errNotInRoom
+	}
+	if r.state != StateQuestion {
+		return errNotAnswering
+	}
+	if index != r.current {
+		return errWrongQuestion
+	}
+	if r.answered[c] {
+		return errAlreadyAnswer
+	}
+
+	q := r.questions[r.current]
+	if choice < 0 || choice >= len(q.choices) {
+		return errInvalidChoice
+	}
+
+	r.answered[c] = true
+	p.answered++
+
+	points := 0
+	correct := choice == q.correct
+	if correct {
+		p.correct++
+		points = score(time.Until(r.deadline), r.questionDuration)
+		p.score += points
+	}
+
+	c.queue(AnswerResultMessage{
+		Type:    TypeAnswerResult,
+		Index:   r.current,
+		Correct: correct,
+		Points:  points,
+		Score:   p.score,
+	})
+	r.broadcast(r.leaderboard(TypeLeaderboard))
+
+	if r.allAnswered() {
+		r.reveal()
+	}
+	return nil
+}
+
+// score returns the points for a correct answer with the remaining time.
+// Half the points are for being correct, the other half shrink with the time taken.
+func score(remaining, duration time.Duration) int {
+	if remaining < 0 {
+		remaining = 0
+	}
+	if remaining > duration {
+		remaining = duration
+	}
+	return maxPoints/2 + int(int64(maxPoints/2)*int64(remaining)/int64(duration))
+}
+
+// allAnswered reports whether every connected player answered the current question
+func (r *room) allAnswered() bool {
+	for c := range r.players {
+		if !r.answered[c] {
+			return false
+		}
+	}
+	return true
+}
+
+// ask pushes a question to everyone
+func (r *room) ask(index int) {
+	r.state = StateQuestion
+	r.current = index
+	r.answered = make(map[*client]bool, len(r.players))
+	r.deadline = time.Now().Add(r.questionDuration)
+	r.timer.Reset(r.questionDuration)
+
+	q := r.questions[index]
+	r.broadcast(QuestionMessage{
+		Type:     TypeQuestion,
+		Index:    index,
+		Total:    len(r.questions),
+		Prompt:   q.prompt,
+		Choices:  q.choices,
+		Seconds:  int(r.questionDuration / time.Second),
+		Deadline: r.deadline.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// reveal closes the current question and shows its answer
+func (r *room) reveal() {
+	r.state = StateReveal
+	r.timer.Reset(r.resultPause)
+
+	q := r.questions[r.current]
+	r.broadcast(QuestionResultMessage{
+		Type:          TypeQuestionResult,
+		Index:         r.current,
+		CorrectChoice: q.correct,
+		Answer:        q.choices[q.correct],
+	})
+	r.broadcast(r.leaderboard(TypeLeaderboard))
+}
+
+// advance moves the race on when the timer fires
+func (r *room) advance() {
+	switch r.state {
+	case StateLobby:
+		r.close("the race was not started in time")
+	case StateQuestion:
+		r.reveal()
+	case StateReveal:
+		if r.current+1 < len(r.questions) {
+			r.ask(r.current + 1)
+			return
+		}
+		r.broadcast(r.leaderboard(TypeFinished))
+		r.disconnect()
+	}
+}
+
+// close tells every client why the room closed and disconnects them
+func (r *room) close(reason string) {
+	r.broadcast(ClosedMessage{Type: TypeClosed, Reason: reason})
+	r.disconnect()
+}
+
+// disconnect closes every client and marks the room closed
+func (r *room) disconnect() {
+	r.state = StateClosed
+	r.host.close()
+	for c := range r.players {
+		c.close()
+	}
+}
+
+// leaderboard ranks the players by score, then by correct answers.
+// Players with the same score and correct answers share a rank.
+func (r *room) leaderboard(messageType string) LeaderboardMessage {
+	ranked := make([]*player, len(r.order))
+	copy(ranked, r.order)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].correct > ranked[j].correct
+	})
+
+	entries := make([]LeaderboardEntry, 0, len(ranked))
+	for i, p := range ranked {
+		rank := i + 1
+		if i > 0 && p.score == ranked[i-1].score && p.correct == ranked[i-1].correct {
+			rank = entries[i-1].Rank
+		}
+		entries = append(entries, LeaderboardEntry{
+			Rank:     rank,
+			Name:     p.name,
+			Score:    p.score,
+			Correct:  p.correct,
+			Answered: p.answered,
+		})
+	}
+
+	return LeaderboardMessage{Type: messageType, Players: entries}
+}
+
+// broadcastRoom sends the room state to everyone, telling each client who they are
+func (r *room) broadcastRoom() {
+	names := make([]string, 0, len(r.order))
+	for _, p := range r.order {
+		if p.connected {
+			names = append(names, p.name)
+		}
+	}
+
+	message := RoomMessage{
+		Type:      TypeRoom,
+		Code:      r.code,
+		ThemeID:   r.themeID,
+		Language:  r.language,
+		State:     r.state,
+		Host:      r.hostName,
+		Players:   names,
+		Questions: len(r.questions),
+	}
+
+	message.You = r.hostName
+	r.host.queue(message)
+	for c, p := range r.players {
+		message.You = p.name
+		c.queue(message)
+	}
+}
+
+// broadcast sends a message to the host and every player
+func (r *room) broadcast(message any) {
+	r.host.queue(message)
+	for c := range r.players {
+		c.queue(message)
+	}
+}
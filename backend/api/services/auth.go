@@ -0,0 +1,271 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrUsernameTaken is returned when registering a username that already exists
+	ErrUsernameTaken = errors.New("username already taken")
+	// ErrInvalidCredentials is returned when a username or password is wrong
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrInvalidToken is returned for unknown or expired access tokens
+	ErrInvalidToken = errors.New("invalid or expired token")
+)
+
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 32
+	minPasswordLength = 8
+	// bcrypt ignores everything after the first 72 bytes
+	maxPasswordLength = 72
+)
+
+// authToken is an issued access token
+type authToken struct {
+	userID    string
+	expiresAt time.Time
+}
+
+// AuthService manages user accounts and access tokens
+type AuthService struct {
+	users      map[string]models.User // keyed by user ID
+	usernames  map[string]string      // lowercase username to user ID
+	tokens     map[string]authToken
+	tokenTTL   time.Duration
+	bcryptCost int
+	mu         sync.RWMutex
+
+	stop      chan struct{}
+	closeOnce sync.Once
+	janitor   sync.WaitGroup
+}
+
+// NewAuthService creates a new auth service
+func NewAuthService(tokenTTL time.Duration) *AuthService {
+	return &AuthService{
+		users:      make(map[string]models.User),
+		usernames:  make(map[string]string),
+		tokens:     make(map[string]authToken),
+		tokenTTL:   tokenTTL,
+		bcryptCost: bcrypt.DefaultCost,
+		stop:       make(chan struct{}),
+	}
+}
+
+// StartJanitor starts a background goroutine that removes expired tokens and
+// anonymous accounts without a valid token every interval, until Close is
+// called. It does nothing when the interval is not positive.
+func (s *AuthService) StartJanitor(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	s.janitor.Add(1)
+	go func() {
+		defer s.janitor.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if tokens, users := s.expire(time.Now()); tokens > 0 || users > 0 {
+					debugLogger.Printf("Auth janitor expired %d tokens and %d anonymous users", tokens, users)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the janitor and waits for it to exit
+func (s *AuthService) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	s.janitor.Wait()
+}
+
+// expire removes the tokens that have expired by now, and the anonymous users
+// left without a token, who can never sign in again. It returns how many
+// tokens and users were removed.
+func (s *AuthService) expire(now time.Time) (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := 0
+	withToken := make(map[string]bool)
+	for t, info := range s.tokens {
+		if now.After(info.expiresAt) {
+			delete(s.tokens, t)
+			tokens++
+			continue
+		}
+		withToken[info.userID] = true
+	}
+
+	users := 0
+	for id, user := range s.users {
+		if user.Anonymous && !withToken[id] {
+			delete(s.users, id)
+			users++
+		}
+	}
+
+	return tokens, users
+}
+
+// Register creates a new user with a bcrypt-hashed password
+func (s *AuthService) Register(username, password string) (*models.User, error) {
+	username = strings.TrimSpace(username)
+	if len(username) < minUsernameLength || len(username) > maxUsernameLength {
+		return nil, errors.New("username must be between 3 and 32 characters")
+	}
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return nil, errors.New("password must be between 8 and 72 characters")
+	}
+
+	// Hash before taking the lock, bcrypt is deliberately slow
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.bcryptCost)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.ToLower(username)
+	if _, ok := s.usernames[key]; ok {
+		return nil, ErrUsernameTaken
+	}
+
+	userID, err := NewUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	user := models.User{
+		ID:           userID,
+		Username:     username,
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now().Format(time.RFC3339),
+	}
+	s.users[user.ID] = user
+	s.usernames[key] = user.ID
+
+	return &user, nil
+}
+
+// CreateAnonymous creates a device account without a password and issues its
+// access token. The token is the only way to use the account.
+func (s *AuthService) CreateAnonymous() (string, *models.User, error) {
+	userID, err := NewUUID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	user := models.User{
+		ID:        userID,
+		Username:  "guest-" + userID[:8],
+		Anonymous: true,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+
+	// Anonymous users are not added to the username index, so nobody can log in as them
+	s.mu.Lock()
+	s.users[user.ID] = user
+	s.mu.Unlock()
+
+	token, err := s.issueToken(user.ID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, &user, nil
+}
+
+// Login checks the credentials and issues a new access token
+func (s *AuthService) Login(username, password string) (string, *models.User, error) {
+	s.mu.RLock()
+	user, ok := s.users[s.usernames[strings.ToLower(strings.TrimSpace(username))]]
+	s.mu.RUnlock()
+
+	if !ok {
+		// Compare against a dummy hash so unknown usernames take as long as wrong passwords
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return "", nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return "", nil, ErrInvalidCredentials
+	}
+
+	token, err := s.issueToken(user.ID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, &user, nil
+}
+
+// Authenticate resolves an access token to its user
+func (s *AuthService) Authenticate(token string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tokens[token]
+	if !ok || time.Now().After(t.expiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	user, ok := s.users[t.userID]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	return &user, nil
+}
+
+// Logout revokes an access token
+func (s *AuthService) Logout(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tokens, token)
+}
+
+// issueToken creates a new opaque access token for a user
+func (s *AuthService) issueToken(userID string) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[token] = authToken{userID: userID, expiresAt: time.Now().Add(s.tokenTTL)}
+	return token, nil
+}
+
+// dummyPasswordHash is compared against when a username does not exist
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("picto-lingua-dummy"), bcrypt.DefaultCost)
+
+// randomToken returns n cryptographically random bytes encoded as URL-safe base64
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
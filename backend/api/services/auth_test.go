@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthExpiresTokensAndAnonymousUsers(t *testing.T) {
+	s := NewAuthService(time.Hour)
+	s.bcryptCost = bcrypt.MinCost
+
+	anonymousToken, anonymous, err := s.CreateAnonymous()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered, err := s.Register("ada", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registeredToken, _, err := s.Login("ada", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing expires while the tokens are valid
+	if tokens, users := s.expire(time.Now()); tokens != 0 || users != 0 {
+		t.Errorf("expired %d tokens and %d users before the tokens lapsed", tokens, users)
+	}
+	if _, err := s.Authenticate(anonymousToken); err != nil {
+		t.Errorf("anonymous token rejected: %v", err)
+	}
+
+	// Once they lapse the anonymous account goes with its token, the registered one stays
+	if tokens, users := s.expire(time.Now().Add(2 * time.Hour)); tokens != 2 || users != 1 {
+		t.Errorf("expired %d tokens and %d users, want 2 and 1", tokens, users)
+	}
+	if _, ok := s.users[anonymous.ID]; ok {
+		t.Error("anonymous user kept after its token expired")
+	}
+	if _, ok := s.users[registered.ID]; !ok {
+		t.Error("registered user removed")
+	}
+	if _, err := s.Authenticate(registeredToken); err == nil {
+		t.Error("expired token accepted")
+	}
+	if _, _, err := s.Login("ada", "correct horse"); err != nil {
+		t.Errorf("registered user cannot log in again: %v", err)
+	}
+}
+
+func TestAuthJanitorStopsOnClose(t *testing.T) {
+	s := NewAuthService(time.Hour)
+	s.StartJanitor(time.Millisecond)
+	s.StartJanitor(0)
+	s.Close()
+	s.Close()
+}
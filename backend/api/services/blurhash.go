@@ -0,0 +1,193 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// BlurHash components, 4x3 suits landscape photos
+	blurHashComponentsX = 4
+	blurHashComponentsY = 3
+	// placeholderSampleSize is the size images are shrunk to before their placeholder is computed
+	placeholderSampleSize = 64
+)
+
+// base83Chars are the digits of the base 83 encoding used by BlurHash
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// placeholderSample shrinks an image so its placeholder is cheap to compute
+func placeholderSample(img image.Image) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= placeholderSampleSize && bounds.Dy() <= placeholderSampleSize {
+		return img
+	}
+
+	width, height := placeholderSampleSize, placeholderSampleSize
+	if bounds.Dx() > bounds.Dy() {
+		height = max(1, bounds.Dy()*placeholderSampleSize/bounds.Dx())
+	} else {
+		width = max(1, bounds.Dx()*placeholderSampleSize/bounds.Dy())
+	}
+
+	sample := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(sample, sample.Bounds(), img, bounds, draw.Src, nil)
+	return sample
+}
+
+// EncodeBlurHash computes the BlurHash (https://blurha.sh) of an image with
+// xComponents by yComponents components, each between 1 and 9
+func EncodeBlurHash(img image.Image, xComponents, yComponents int) (string, error) {
+	if xComponents < 1 || xComponents > 9 || yComponents < 1 || yComponents > 9 {
+		return "", fmt.Errorf("blurhash components must be between 1 and 9, got %dx%d", xComponents, yComponents)
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return "", fmt.Errorf("cannot compute the blurhash of an empty image")
+	}
+
+	// Convert the pixels to linear RGB once
+	linear := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			linear[y*width+x] = [3]float64{srgbToLinear(c.R), srgbToLinear(c.G), srgbToLinear(c.B)}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				basisY := math.Cos(math.Pi * float64(j) * float64(y) / float64(height))
+				for x := 0; x < width; x++ {
+					basis := basisY * math.Cos(math.Pi*float64(i)*float64(x)/float64(width))
+					pixel := linear[y*width+x]
+					factor[0] += basis * pixel[0]
+					factor[1] += basis * pixel[1]
+					factor[2] += basis * pixel[2]
+				}
+			}
+
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encodeBase83((xComponents-1)+(yComponents-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+	maxValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, factor := range ac {
+			actualMax = max(actualMax, math.Abs(factor[0]), math.Abs(factor[1]), math.Abs(factor[2]))
+		}
+		quantisedMax := clampInt(int(math.Floor(actualMax*166-0.5)), 0, 82)
+		maxValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encodeBase83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encodeBase83(0, 1))
+	}
+
+	hash.WriteString(encodeBase83(linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4))
+	for _, factor := range ac {
+		quantR := clampInt(int(math.Floor(signPow(factor[0]/maxValue, 0.5)*9+9.5)), 0, 18)
+		quantG := clampInt(int(math.Floor(signPow(factor[1]/maxValue, 0.5)*9+9.5)), 0, 18)
+		quantB := clampInt(int(math.Floor(signPow(factor[2]/maxValue, 0.5)*9+9.5)), 0, 18)
+		hash.WriteString(encodeBase83(quantR*19*19+quantG*19+quantB, 2))
+	}
+
+	return hash.String(), nil
+}
+
+// DominantColor returns the most common color of an image as a hex string
+// such as "#a0c4e2". Colors are grouped into buckets of similar colors, and
+// the average of the fullest bucket is returned.
+func DominantColor(img image.Image) string {
+	type bucket struct {
+		r, g, b, count int
+	}
+	// 4 bits per channel
+	buckets := make(map[int]*bucket)
+	var dominant *bucket
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			key := int(c.R>>4)<<8 | int(c.G>>4)<<4 | int(c.B>>4)
+
+			b, ok := buckets[key]
+			if !ok {
+				b = &bucket{}
+				buckets[key] = b
+			}
+			b.r += int(c.R)
+			b.g += int(c.G)
+			b.b += int(c.B)
+			b.count++
+
+			if dominant == nil || b.count > dominant.count {
+				dominant = b
+			}
+		}
+	}
+
+	if dominant == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", dominant.r/dominant.count, dominant.g/dominant.count, dominant.b/dominant.count)
+}
+
+// encodeBase83 encodes a value as length base 83 digits
+func encodeBase83(value, length int) string {
+	digits := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		digits[i] = base83Chars[value%83]
+		value /= 83
+	}
+	return string(digits)
+}
+
+// srgbToLinear converts an sRGB channel to linear light
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB converts linear light to an sRGB channel
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+// signPow raises the magnitude of a value to exp, keeping its sign
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
+
+// clampInt limits a value to the range [low, high]
+func clampInt(value, low, high int) int {
+	return min(max(value, low), high)
+}
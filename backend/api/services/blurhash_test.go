@@ -0,0 +1,76 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// filledImage returns an image where every pixel has the color that fill returns for it
+func filledImage(width, height int, fill func(x, y int) color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, fill(x, y))
+		}
+	}
+	return img
+}
+
+func TestEncodeBlurHash(t *testing.T) {
+	// Expected hashes were computed with a port of the reference implementation
+	tests := []struct {
+		name   string
+		img    image.Image
+		expect string
+	}{
+		{
+			name:   "solid",
+			img:    filledImage(32, 24, func(x, y int) color.Color { return color.RGBA{255, 0, 0, 255} }),
+			expect: "LDTI:j]9fQ]9|co1fQo1fQfQfQfQ",
+		},
+		{
+			name:   "horizontal gradient",
+			img:    filledImage(64, 48, func(x, y int) color.Color { return color.Gray{uint8(x * 4)} }),
+			expect: "L#HLl100%MRjofayj[fQfQfQfQfQ",
+		},
+		{
+			name:   "two gradients",
+			img:    filledImage(32, 24, func(x, y int) color.Color { return color.RGBA{uint8(x * 8), uint8(y * 10), 128, 255} }),
+			expect: "LxH27k2swxX8mHWWjtf7gJfjfQfj",
+		},
+	}
+
+	for _, tt := range tests {
+		hash, err := EncodeBlurHash(tt.img, 4, 3)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if hash != tt.expect {
+			t.Errorf("%s: hash = %s, want %s", tt.name, hash, tt.expect)
+		}
+	}
+}
+
+func TestEncodeBlurHashRejectsInvalidComponents(t *testing.T) {
+	img := filledImage(4, 4, func(x, y int) color.Color { return color.White })
+	for _, components := range [][2]int{{0, 3}, {4, 10}} {
+		if _, err := EncodeBlurHash(img, components[0], components[1]); err == nil {
+			t.Errorf("expected an error for %dx%d components", components[0], components[1])
+		}
+	}
+}
+
+func TestDominantColor(t *testing.T) {
+	// Three quarters blue with some noise, one quarter red
+	img := filledImage(40, 40, func(x, y int) color.Color {
+		if x < 10 {
+			return color.RGBA{250, 10, 10, 255}
+		}
+		return color.RGBA{10, 20, uint8(200 + (x+y)%4), 255}
+	})
+
+	if got := DominantColor(img); got != "#0a14c9" {
+		t.Errorf("dominant color = %s, want #0a14c9", got)
+	}
+}
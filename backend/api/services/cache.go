@@ -0,0 +1,329 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// ErrUnknownCacheNamespace is returned when purging a namespace that does not exist
+var ErrUnknownCacheNamespace = errors.New("unknown cache namespace")
+
+// Cache stores provider responses so they survive restarts. Entries are kept
+// in memory and written through to one JSON file per entry, grouped in a
+// directory per namespace. Without a directory the cache only lives in memory.
+type Cache struct {
+	dir        string
+	namespaces map[string]*CacheNamespace
+	mu         sync.Mutex
+}
+
+// NewCache creates a cache that persists entries in dir, or only keeps them in
+// memory when dir is empty
+func NewCache(dir string) *Cache {
+	return &Cache{
+		dir:        dir,
+		namespaces: make(map[string]*CacheNamespace),
+	}
+}
+
+// Namespace returns the namespace with the given name, creating it and loading
+// its entries from disk on first use. Entries expire ttl after they were
+// stored, a ttl of zero keeps them until they are purged.
+func (c *Cache) Namespace(name string, ttl time.Duration) *CacheNamespace {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ns, ok := c.namespaces[name]; ok {
+		return ns
+	}
+
+	ns := &CacheNamespace{
+		name:    name,
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+	if c.dir != "" {
+		ns.dir = filepath.Join(c.dir, name)
+		ns.load()
+	}
+	c.namespaces[name] = ns
+	return ns
+}
+
+// Stats returns the size and hit rate of every namespace, sorted by name
+func (c *Cache) Stats() []models.CacheStats {
+	c.mu.Lock()
+	namespaces := make([]*CacheNamespace, 0, len(c.namespaces))
+	for _, ns := range c.namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	c.mu.Unlock()
+
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].name < namespaces[j].name })
+
+	stats := make([]models.CacheStats, 0, len(namespaces))
+	for _, ns := range namespaces {
+		stats = append(stats, ns.Stats())
+	}
+	return stats
+}
+
+// Purge removes every entry of a namespace, or of all namespaces when name is
+// empty, and returns the number of entries removed
+func (c *Cache) Purge(name string) (int, error) {
+	c.mu.Lock()
+	var namespaces []*CacheNamespace
+	if name == "" {
+		for _, ns := range c.namespaces {
+			namespaces = append(namespaces, ns)
+		}
+	} else if ns, ok := c.namespaces[name]; ok {
+		namespaces = append(namespaces, ns)
+	}
+	c.mu.Unlock()
+
+	if name != "" && len(namespaces) == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownCacheNamespace, name)
+	}
+
+	purged := 0
+	for _, ns := range namespaces {
+		n, err := ns.Purge()
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// cacheEntry is a cached value as it is stored on disk
+type cacheEntry struct {
+	Key       string          `json:"key"` // the normalized request, for people reading the files
+	Value     json.RawMessage `json:"value"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at,omitempty"`
+}
+
+// expired reports whether the entry has outlived its TTL
+func (e cacheEntry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// CacheNamespace is a part of the cache with its own TTL and counters, such
+// as the generated vocabulary or the image search results
+type CacheNamespace struct {
+	name string
+	dir  string // empty when the cache only lives in memory
+	ttl  time.Duration
+
+	entries map[string]cacheEntry // fingerprint to entry
+	hits    int64
+	misses  int64
+	mu      sync.RWMutex
+}
+
+// Fingerprint identifies a request by its parts. Parts are trimmed, lowercased
+// and have their whitespace collapsed, so requests that only differ in
+// spelling share an entry.
+func Fingerprint(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(normalizeKey(parts), "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeKey normalizes the parts of a cache key
+func normalizeKey(parts []string) []string {
+	normalized := make([]string, len(parts))
+	for i, part := range parts {
+		normalized[i] = strings.ToLower(strings.Join(strings.Fields(part), " "))
+	}
+	return normalized
+}
+
+// Get decodes the entry for the key into v and reports whether it was found
+func (ns *CacheNamespace) Get(v any, key ...string) bool {
+	return ns.GetValid(v, nil, key...)
+}
+
+// GetValid is Get for entries that can go stale. An entry that valid rejects
+// after it has been decoded into v is not found and counts as a miss.
+func (ns *CacheNamespace) GetValid(v any, valid func() bool, key ...string) bool {
+	ok := ns.Peek(v, key...) && (valid == nil || valid())
+
+	ns.mu.Lock()
+	if ok {
+		ns.hits++
+	} else {
+		ns.misses++
+	}
+	ns.mu.Unlock()
+
+	return ok
+}
+
+// Peek decodes the entry for the key into v and reports whether it was found,
+// without counting it as a hit or miss
+func (ns *CacheNamespace) Peek(v any, key ...string) bool {
+	fingerprint := Fingerprint(key...)
+
+	ns.mu.RLock()
+	entry, ok := ns.entries[fingerprint]
+	ns.mu.RUnlock()
+
+	if ok && entry.expired(time.Now()) {
+		ns.mu.Lock()
+		if current, found := ns.entries[fingerprint]; found && current.expired(time.Now()) {
+			ns.remove(fingerprint)
+		}
+		ns.mu.Unlock()
+		return false
+	}
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(entry.Value, v); err != nil {
+		debugLogger.Printf("Error decoding %s cache entry %s: %v", ns.name, entry.Key, err)
+		return false
+	}
+	return true
+}
+
+// Contains reports whether an unexpired entry exists for the key, without
+// counting it as a hit or miss
+func (ns *CacheNamespace) Contains(key ...string) bool {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	entry, ok := ns.entries[Fingerprint(key...)]
+	return ok && !entry.expired(time.Now())
+}
+
+// Set stores v for the key. The entry stays available in memory when it
+// cannot be written to disk.
+func (ns *CacheNamespace) Set(v any, key ...string) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding cache entry: %w", err)
+	}
+
+	now := time.Now()
+	entry := cacheEntry{
+		Key:       strings.Join(normalizeKey(key), "/"),
+		Value:     value,
+		CreatedAt: now,
+	}
+	if ns.ttl > 0 {
+		entry.ExpiresAt = now.Add(ns.ttl)
+	}
+	fingerprint := Fingerprint(key...)
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.entries[fingerprint] = entry
+
+	if ns.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding cache entry: %w", err)
+	}
+	if err := writeFileAtomic(ns.path(fingerprint), data); err != nil {
+		return fmt.Errorf("error writing cache entry: %w", err)
+	}
+	return nil
+}
+
+// Purge removes every entry and returns how many there were
+func (ns *CacheNamespace) Purge() (int, error) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	purged := len(ns.entries)
+	ns.entries = make(map[string]cacheEntry)
+
+	if ns.dir != "" {
+		if err := os.RemoveAll(ns.dir); err != nil {
+			return purged, fmt.Errorf("error removing cache directory: %w", err)
+		}
+	}
+	debugLogger.Printf("Purged %d entries from the %s cache", purged, ns.name)
+	return purged, nil
+}
+
+// Stats returns the size and hit rate of the namespace
+func (ns *CacheNamespace) Stats() models.CacheStats {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+
+	stats := models.CacheStats{
+		Namespace: ns.name,
+		Entries:   len(ns.entries),
+		Hits:      ns.hits,
+		Misses:    ns.misses,
+		Persisted: ns.dir != "",
+	}
+	if ns.ttl > 0 {
+		stats.TTL = ns.ttl.String()
+	}
+	return stats
+}
+
+// path returns the file of an entry
+func (ns *CacheNamespace) path(fingerprint string) string {
+	return filepath.Join(ns.dir, fingerprint+".json")
+}
+
+// remove deletes an entry, the caller must hold the write lock
+func (ns *CacheNamespace) remove(fingerprint string) {
+	delete(ns.entries, fingerprint)
+	if ns.dir == "" {
+		return
+	}
+	if err := os.Remove(ns.path(fingerprint)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		debugLogger.Printf("Error removing %s cache entry %s: %v", ns.name, fingerprint, err)
+	}
+}
+
+// load reads the entries stored on disk, expired entries are removed
+func (ns *CacheNamespace) load() {
+	files, err := os.ReadDir(ns.dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			debugLogger.Printf("Error reading %s cache directory: %v", ns.name, err)
+		}
+		return
+	}
+
+	now := time.Now()
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		fingerprint := strings.TrimSuffix(name, ".json")
+
+		data, err := os.ReadFile(ns.path(fingerprint))
+		if err != nil {
+			debugLogger.Printf("Error reading %s cache entry %s: %v", ns.name, fingerprint, err)
+			continue
+		}
+		var entry cacheEntry
+		if err := json.Unmarshal(data, &entry); err != nil || entry.expired(now) {
+			ns.remove(fingerprint)
+			continue
+		}
+		ns.entries[fingerprint] = entry
+	}
+	debugLogger.Printf("Loaded %d entries into the %s cache", len(ns.entries), ns.name)
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCachePersistsEntriesAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := NewCache(dir).Namespace("vocabulary", time.Hour).Set([]string{"bench", "tree"}, "park", "10"); err != nil {
+		t.Fatal(err)
+	}
+
+	ns := NewCache(dir).Namespace("vocabulary", time.Hour)
+	var words []string
+	if !ns.Get(&words, "park", "10") {
+		t.Fatal("entry was not loaded from disk")
+	}
+	if len(words) != 2 || words[1] != "tree" {
+		t.Errorf("words = %v, want [bench tree]", words)
+	}
+}
+
+func TestCacheNormalizesKeys(t *testing.T) {
+	ns := NewCache("").Namespace("images", 0)
+	if err := ns.Set(1, "City  Park", "5"); err != nil {
+		t.Fatal(err)
+	}
+
+	var v int
+	if !ns.Get(&v, " city park ", "5") {
+		t.Error("keys that only differ in case and whitespace should share an entry")
+	}
+	if ns.Contains("city", "park 5") {
+		t.Error("keys with different parts should not share an entry")
+	}
+}
+
+func TestCacheExpiresEntries(t *testing.T) {
+	dir := t.TempDir()
+	ns := NewCache(dir).Namespace("images", time.Millisecond)
+	if err := ns.Set("x", "park"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if ns.Contains("park") {
+		t.Error("expired entry is reported as cached")
+	}
+
+	// Expired entries are not loaded, and their files are removed
+	reopened := NewCache(dir).Namespace("images", time.Millisecond)
+	if stats := reopened.Stats(); stats.Entries != 0 {
+		t.Errorf("loaded %d expired entries", stats.Entries)
+	}
+	files, _ := os.ReadDir(filepath.Join(dir, "images"))
+	if len(files) != 0 {
+		t.Errorf("%d expired files left on disk", len(files))
+	}
+}
+
+func TestCacheCountsHitsAndMisses(t *testing.T) {
+	ns := NewCache("").Namespace("vocabulary", time.Hour)
+	var v string
+	ns.Get(&v, "park")
+	if err := ns.Set("x", "park"); err != nil {
+		t.Fatal(err)
+	}
+	ns.Get(&v, "park")
+	ns.Get(&v, "park")
+	ns.Contains("park")
+
+	stats := ns.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("stats = %+v, want 2 hits, 1 miss and 1 entry", stats)
+	}
+}
+
+func TestCachePurge(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewCache(dir)
+	vocabulary := cache.Namespace("vocabulary", time.Hour)
+	images := cache.Namespace("images", time.Hour)
+	for _, key := range []string{"park", "kitchen"} {
+		if err := vocabulary.Set("x", key); err != nil {
+			t.Fatal(err)
+		}
+		if err := images.Set("x", key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purged, err := cache.Purge("vocabulary")
+	if err != nil || purged != 2 {
+		t.Fatalf("purged %d entries (%v), want 2", purged, err)
+	}
+	if vocabulary.Contains("park") || !images.Contains("park") {
+		t.Error("purge removed the wrong namespace")
+	}
+	if NewCache(dir).Namespace("vocabulary", time.Hour).Stats().Entries != 0 {
+		t.Error("purged entries were loaded from disk")
+	}
+
+	if _, err := cache.Purge("unknown"); !errors.Is(err, ErrUnknownCacheNamespace) {
+		t.Errorf("err = %v, want ErrUnknownCacheNamespace", err)
+	}
+
+	purged, err = cache.Purge("")
+	if err != nil || purged != 2 {
+		t.Errorf("purged %d entries (%v) from all namespaces, want 2", purged, err)
+	}
+}
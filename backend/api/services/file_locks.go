@@ -0,0 +1,43 @@
+package services
+
+import "sync"
+
+// fileLocks holds one lock per file being created, so concurrent requests
+// for the same file only create it once while other files are created in parallel
+type fileLocks struct {
+	locks map[string]*fileLock
+	mu    sync.Mutex
+}
+
+// fileLock serializes the creation of a file
+type fileLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock locks the creation of a file and returns the function that unlocks it
+func (l *fileLocks) lock(path string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*fileLock)
+	}
+	fl, ok := l.locks[path]
+	if !ok {
+		fl = &fileLock{}
+		l.locks[path] = fl
+	}
+	fl.refs++
+	l.mu.Unlock()
+
+	fl.mu.Lock()
+	return func() {
+		fl.mu.Unlock()
+
+		l.mu.Lock()
+		fl.refs--
+		if fl.refs == 0 {
+			delete(l.locks, path)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+const (
+	// XPPerReview is awarded the first time a word is reviewed on a day
+	XPPerReview = 1
+	// XPPerKnown is awarded on top of XPPerReview the first time a word is
+	// marked known on a day
+	XPPerKnown = 2
+	// XPGoalBonus is awarded once per day when the daily goal is reached
+	XPGoalBonus = 10
+
+	// DefaultDailyGoal is the daily word goal of new learners
+	DefaultDailyGoal = 10
+	maxDailyGoal     = 500
+
+	// A streak freeze is earned for every streakFreezeInterval consecutive days,
+	// up to maxStreakFreezes. Each freeze covers one missed day.
+	streakFreezeInterval = 7
+	maxStreakFreezes     = 2
+
+	dateLayout = "2006-01-02"
+)
+
+// gamificationProfile is the gamification state of one learner
+type gamificationProfile struct {
+	location       *time.Location
+	dailyGoal      int
+	xp             int
+	currentStreak  int
+	longestStreak  int
+	freezes        int
+	lastActiveDate string          // local date of the last review
+	todayDate      string          // local date wordsToday refers to
+	wordsToday     map[string]bool // words reviewed today, true once known
+}
+
+// GamificationService awards XP and tracks daily streaks and goals from
+// session progress updates
+type GamificationService struct {
+	profiles map[string]*gamificationProfile
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+// NewGamificationService creates a new gamification service
+func NewGamificationService() *GamificationService {
+	return &GamificationService{
+		profiles: make(map[string]*gamificationProfile),
+		now:      time.Now,
+	}
+}
+
+// profile returns the profile of a user, creating it if needed.
+// The caller must hold the lock.
+func (s *GamificationService) profile(userID string) *gamificationProfile {
+	p, ok := s.profiles[userID]
+	if !ok {
+		p = &gamificationProfile{
+			location:  time.UTC,
+			dailyGoal: DefaultDailyGoal,
+		}
+		s.profiles[userID] = p
+	}
+	return p
+}
+
+// RecordProgress awards XP and updates the streak, it is a ProgressListener.
+// Only answers recorded by the server count, counters reported by clients and
+// their answer timestamps cannot be trusted, so the day of an answer is the
+// day it was recorded. A word earns XP once per day however often it is
+// answered, and once more the first time it is known that day.
+func (s *GamificationService) RecordProgress(update ProgressUpdate) {
+	if update.Answers <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.profile(update.UserID)
+	today := update.RecordedAt.In(p.location).Format(dateLayout)
+
+	p.extendStreak(today)
+
+	if p.todayDate != today {
+		p.todayDate = today
+		p.wordsToday = make(map[string]bool)
+	}
+	goalMetBefore := len(p.wordsToday) >= p.dailyGoal
+
+	word := update.Current.Word
+	known, reviewed := p.wordsToday[word]
+	if !reviewed {
+		p.xp += XPPerReview
+	}
+	if update.KnownAnswers > 0 && !known {
+		p.xp += XPPerKnown
+		known = true
+	}
+	p.wordsToday[word] = known
+
+	if !goalMetBefore && len(p.wordsToday) >= p.dailyGoal {
+		p.xp += XPGoalBonus
+	}
+}
+
+// extendStreak counts today as an active day
+func (p *gamificationProfile) extendStreak(today string) {
+	if p.lastActiveDate == today {
+		return
+	}
+
+	if p.lastActiveDate == "" {
+		p.currentStreak = 1
+	} else {
+		missed := daysBetween(p.lastActiveDate, today) - 1
+		switch {
+		case missed < 0:
+			// A timezone change moved today before the last active date
+			return
+		case missed == 0:
+			p.currentStreak++
+		case missed <= p.freezes:
+			// Freezes cover the missed days and keep the streak alive
+			p.freezes -= missed
+			p.currentStreak++
+		default:
+			p.currentStreak = 1
+		}
+	}
+
+	p.lastActiveDate = today
+	if p.currentStreak > p.longestStreak {
+		p.longestStreak = p.currentStreak
+	}
+	if p.currentStreak%streakFreezeInterval == 0 && p.freezes < maxStreakFreezes {
+		p.freezes++
+	}
+}
+
+// daysBetween returns the number of calendar days from one local date to another
+func daysBetween(from, to string) int {
+	a, errA := time.Parse(dateLayout, from)
+	b, errB := time.Parse(dateLayout, to)
+	if errA != nil || errB != nil {
+		return 0
+	}
+	return int(b.Sub(a).Hours()/24 + 0.5)
+}
+
+// GetStatus returns the gamification status of a user
+func (s *GamificationService) GetStatus(userID string) models.GamificationStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.profile(userID)
+	today := s.now().In(p.location).Format(dateLayout)
+
+	status := models.GamificationStatus{
+		XP:             p.xp,
+		Level:          p.xp/100 + 1,
+		CurrentStreak:  p.currentStreak,
+		LongestStreak:  p.longestStreak,
+		StreakFreezes:  p.freezes,
+		DailyGoal:      p.dailyGoal,
+		Timezone:       p.location.String(),
+		LastActiveDate: p.lastActiveDate,
+	}
+	if p.todayDate == today {
+		status.WordsToday = len(p.wordsToday)
+	}
+	status.GoalMetToday = status.WordsToday >= p.dailyGoal
+
+	// The streak is broken once more days were missed than freezes can cover,
+	// yesterday still counts because the learner can extend the streak today
+	if p.lastActiveDate != "" && daysBetween(p.lastActiveDate, today)-1 > p.freezes {
+		status.CurrentStreak = 0
+	}
+
+	return status
+}
+
+// UpdateSettings changes the daily goal and timezone of a user.
+// A zero goal or empty timezone leaves the setting unchanged.
+func (s *GamificationService) UpdateSettings(userID string, dailyGoal int, timezone string) (models.GamificationStatus, error) {
+	var location *time.Location
+	if timezone != "" {
+		var err error
+		location, err = time.LoadLocation(timezone)
+		if err != nil {
+			return models.GamificationStatus{}, fmt.Errorf("unknown timezone: %s", timezone)
+		}
+	}
+	if dailyGoal < 0 || dailyGoal > maxDailyGoal {
+		return models.GamificationStatus{}, errors.New("daily goal must be between 1 and 500")
+	}
+
+	s.mu.Lock()
+	p := s.profile(userID)
+	if dailyGoal > 0 {
+		p.dailyGoal = dailyGoal
+	}
+	if location != nil {
+		p.location = location
+	}
+	s.mu.Unlock()
+
+	return s.GetStatus(userID), nil
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// review records one answer on a word for the user at the given time
+func review(s *GamificationService, userID, word string, at time.Time, known bool) {
+	update := ProgressUpdate{UserID: userID, ThemeID: "park", Current: models.ProgressItem{Word: word}, At: at, RecordedAt: at, Answers: 1}
+	if known {
+		update.KnownAnswers = 1
+	}
+	s.RecordProgress(update)
+}
+
+// statusAt returns the status of the user as seen at the given time
+func statusAt(s *GamificationService, userID string, at time.Time) models.GamificationStatus {
+	s.now = func() time.Time { return at }
+	return s.GetStatus(userID)
+}
+
+func mustTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatalf("invalid time %q: %v", value, err)
+	}
+	return parsed
+}
+
+func TestGamificationAwardsXP(t *testing.T) {
+	s := NewGamificationService()
+	at := mustTime(t, "2026-03-02T10:00:00Z")
+
+	review(s, "u1", "tree", at, false)
+	review(s, "u1", "bench", at, true)
+
+	status := statusAt(s, "u1", at)
+	if want := 2*XPPerReview + XPPerKnown; status.XP != want {
+		t.Errorf("XP = %d, want %d", status.XP, want)
+	}
+	if status.WordsToday != 2 {
+		t.Errorf("WordsToday = %d, want 2", status.WordsToday)
+	}
+}
+
+func TestGamificationIgnoresReportedCounters(t *testing.T) {
+	s := NewGamificationService()
+	at := mustTime(t, "2026-03-02T10:00:00Z")
+
+	// Counters reported by a client without answers earn nothing
+	s.RecordProgress(ProgressUpdate{
+		UserID:     "u1",
+		Current:    models.ProgressItem{Word: "tree", SeenCount: 1000000, KnownCount: 1000000},
+		At:         at,
+		RecordedAt: at,
+	})
+
+	if status := statusAt(s, "u1", at); status.XP != 0 || status.CurrentStreak != 0 || status.WordsToday != 0 {
+		t.Errorf("reported counters changed status: %+v", status)
+	}
+}
+
+func TestGamificationAwardsXPOncePerWordPerDay(t *testing.T) {
+	s := NewGamificationService()
+	at := mustTime(t, "2026-03-02T10:00:00Z")
+
+	// Answering the same word over and over earns XP once
+	s.RecordProgress(ProgressUpdate{UserID: "u1", Current: models.ProgressItem{Word: "tree"}, RecordedAt: at, Answers: 1000, KnownAnswers: 1000})
+	for i := 0; i < 20; i++ {
+		review(s, "u1", "tree", at, true)
+	}
+
+	status := statusAt(s, "u1", at)
+	if want := XPPerReview + XPPerKnown; status.XP != want || status.WordsToday != 1 {
+		t.Errorf("XP = %d, WordsToday = %d, want %d and 1", status.XP, status.WordsToday, want)
+	}
+
+	// The word earns XP again on the next day
+	next := at.AddDate(0, 0, 1)
+	review(s, "u1", "tree", next, false)
+	if got, want := statusAt(s, "u1", next).XP, 2*XPPerReview+XPPerKnown; got != want {
+		t.Errorf("XP = %d the next day, want %d", got, want)
+	}
+}
+
+func TestGamificationDatesStreakByRecordedTime(t *testing.T) {
+	s := NewGamificationService()
+	recorded := mustTime(t, "2026-03-05T10:00:00Z")
+
+	// Answers backdated by the client count on the day they were recorded
+	for day, word := range []string{"tree", "bench", "pond", "swing"} {
+		s.RecordProgress(ProgressUpdate{UserID: "u1", Current: models.ProgressItem{Word: word}, At: recorded.AddDate(0, 0, day-3), RecordedAt: recorded, Answers: 1})
+	}
+
+	status := statusAt(s, "u1", recorded)
+	if status.CurrentStreak != 1 || status.LastActiveDate != "2026-03-05" || status.WordsToday != 4 {
+		t.Errorf("status = %+v, want a one day streak on 2026-03-05", status)
+	}
+}
+
+func TestGamificationDailyGoalBonus(t *testing.T) {
+	s := NewGamificationService()
+	if _, err := s.UpdateSettings("u1", 3, ""); err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+	at := mustTime(t, "2026-03-02T10:00:00Z")
+
+	for _, word := range []string{"tree", "bench", "pond", "swing"} {
+		review(s, "u1", word, at, false)
+	}
+	// Answering a word again does not count towards the goal
+	review(s, "u1", "tree", at, false)
+
+	status := statusAt(s, "u1", at)
+	if want := 4*XPPerReview + XPGoalBonus; status.XP != want {
+		t.Errorf("XP = %d, want %d (bonus must be awarded exactly once)", status.XP, want)
+	}
+	if !status.GoalMetToday {
+		t.Error("GoalMetToday = false, want true")
+	}
+
+	// The goal resets on the next day
+	if status := statusAt(s, "u1", at.Add(24*time.Hour)); status.WordsToday != 0 || status.GoalMetToday {
+		t.Errorf("next day status = %+v, want no words today", status)
+	}
+}
+
+func TestGamificationStreakUsesLearnerTimezone(t *testing.T) {
+	s := NewGamificationService()
+	if _, err := s.UpdateSettings("u1", 0, "America/Los_Angeles"); err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+
+	// 20:00 and 06:00 UTC the next day are both March 2nd in Los Angeles,
+	// so they count as one day even though they cross midnight UTC
+	review(s, "u1", "tree", mustTime(t, "2026-03-02T20:00:00Z"), false)
+	review(s, "u1", "bench", mustTime(t, "2026-03-03T06:00:00Z"), false)
+
+	status := statusAt(s, "u1", mustTime(t, "2026-03-03T06:00:00Z"))
+	if status.CurrentStreak != 1 {
+		t.Errorf("CurrentStreak = %d, want 1", status.CurrentStreak)
+	}
+	if status.LastActiveDate != "2026-03-02" {
+		t.Errorf("LastActiveDate = %q, want 2026-03-02", status.LastActiveDate)
+	}
+	if status.WordsToday != 2 {
+		t.Errorf("WordsToday = %d, want 2", status.WordsToday)
+	}
+
+	// 09:00 UTC is March 3rd in Los Angeles, a new day extends the streak
+	review(s, "u1", "tree", mustTime(t, "2026-03-03T09:00:00Z"), false)
+	if status := statusAt(s, "u1", mustTime(t, "2026-03-03T09:00:00Z")); status.CurrentStreak != 2 {
+		t.Errorf("CurrentStreak = %d, want 2", status.CurrentStreak)
+	}
+}
+
+func TestGamificationStreakAcrossDateLine(t *testing.T) {
+	auckland := NewGamificationService()
+	auckland.UpdateSettings("u1", 0, "Pacific/Auckland")
+	utc := NewGamificationService()
+
+	// Both reviews are on the same UTC day but on consecutive days in Auckland
+	first := mustTime(t, "2026-03-02T01:00:00Z")  // March 2nd 14:00 in Auckland
+	second := mustTime(t, "2026-03-02T12:00:00Z") // March 3rd 01:00 in Auckland
+	for _, s := range []*GamificationService{auckland, utc} {
+		review(s, "u1", "tree", first, false)
+		review(s, "u1", "tree", second, false)
+	}
+
+	if got := statusAt(auckland, "u1", second).CurrentStreak; got != 2 {
+		t.Errorf("Auckland CurrentStreak = %d, want 2", got)
+	}
+	if got := statusAt(utc, "u1", second).CurrentStreak; got != 1 {
+		t.Errorf("UTC CurrentStreak = %d, want 1", got)
+	}
+}
+
+func TestGamificationStreakBreaks(t *testing.T) {
+	s := NewGamificationService()
+	day := mustTime(t, "2026-03-02T12:00:00Z")
+
+	review(s, "u1", "tree", day, false)
+	review(s, "u1", "tree", day.Add(24*time.Hour), false)
+
+	// Yesterday's streak is still shown, the learner can extend it today
+	if got := statusAt(s, "u1", day.Add(48*time.Hour)).CurrentStreak; got != 2 {
+		t.Errorf("CurrentStreak one day later = %d, want 2", got)
+	}
+	// Missing a whole day without freezes breaks it
+	if got := statusAt(s, "u1", day.Add(72*time.Hour)).CurrentStreak; got != 0 {
+		t.Errorf("CurrentStreak after a missed day = %d, want 0", got)
+	}
+
+	review(s, "u1", "tree", day.Add(72*time.Hour), false)
+	status := statusAt(s, "u1", day.Add(72*time.Hour))
+	if status.CurrentStreak != 1 || status.LongestStreak != 2 {
+		t.Errorf("after restart CurrentStreak = %d, LongestStreak = %d, want 1 and 2", status.CurrentStreak, status.LongestStreak)
+	}
+}
+
+func TestGamificationStreakFreeze(t *testing.T) {
+	s := NewGamificationService()
+	s.UpdateSettings("u1", 0, "Europe/Amsterdam")
+	day := mustTime(t, "2026-03-02T18:00:00Z")
+
+	// A seven day streak earns one freeze
+	for i := 0; i < streakFreezeInterval; i++ {
+		review(s, "u1", "tree", day.AddDate(0, 0, i), false)
+	}
+	status := statusAt(s, "u1", day.AddDate(0, 0, 6))
+	if status.CurrentStreak != 7 || status.StreakFreezes != 1 {
+		t.Fatalf("after a week CurrentStreak = %d, StreakFreezes = %d, want 7 and 1", status.CurrentStreak, status.StreakFreezes)
+	}
+
+	// Skipping one day is covered by the freeze
+	if got := statusAt(s, "u1", day.AddDate(0, 0, 8)).CurrentStreak; got != 7 {
+		t.Errorf("CurrentStreak with a freeze available = %d, want 7", got)
+	}
+	review(s, "u1", "tree", day.AddDate(0, 0, 8), false)
+	status = statusAt(s, "u1", day.AddDate(0, 0, 8))
+	if status.CurrentStreak != 8 || status.StreakFreezes != 0 {
+		t.Errorf("after using the freeze CurrentStreak = %d, StreakFreezes = %d, want 8 and 0", status.CurrentStreak, status.StreakFreezes)
+	}
+
+	// With no freezes left the next missed day breaks the streak
+	review(s, "u1", "tree", day.AddDate(0, 0, 10), false)
+	if got := statusAt(s, "u1", day.AddDate(0, 0, 10)).CurrentStreak; got != 1 {
+		t.Errorf("CurrentStreak after a missed day without freezes = %d, want 1", got)
+	}
+}
+
+func TestGamificationTimezoneChangeDoesNotDoubleCount(t *testing.T) {
+	s := NewGamificationService()
+	s.UpdateSettings("u1", 0, "Asia/Tokyo")
+
+	// March 3rd 08:00 in Tokyo
+	review(s, "u1", "tree", mustTime(t, "2026-03-02T23:00:00Z"), false)
+
+	// The learner moves to New York, where it is still March 2nd
+	s.UpdateSettings("u1", 0, "America/New_York")
+	review(s, "u1", "tree", mustTime(t, "2026-03-03T01:00:00Z"), false)
+
+	status := statusAt(s, "u1", mustTime(t, "2026-03-03T01:00:00Z"))
+	if status.CurrentStreak != 1 || status.LastActiveDate != "2026-03-03" {
+		t.Errorf("CurrentStreak = %d, LastActiveDate = %q, want 1 and 2026-03-03", status.CurrentStreak, status.LastActiveDate)
+	}
+}
+
+func TestGamificationUpdateSettingsValidation(t *testing.T) {
+	s := NewGamificationService()
+
+	if _, err := s.UpdateSettings("u1", 0, "Mars/Olympus_Mons"); err == nil {
+		t.Error("unknown timezone accepted")
+	}
+	if _, err := s.UpdateSettings("u1", maxDailyGoal+1, ""); err == nil {
+		t.Error("too large daily goal accepted")
+	}
+
+	status, err := s.UpdateSettings("u1", 25, "Europe/Amsterdam")
+	if err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+	if status.DailyGoal != 25 || status.Timezone != "Europe/Amsterdam" {
+		t.Errorf("settings = %d %q, want 25 Europe/Amsterdam", status.DailyGoal, status.Timezone)
+	}
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// ErrImageNotFound is returned when an image does not exist
+var ErrImageNotFound = errors.New("image not found")
+
+// ImageProvider finds images on a stock photo site. Images are normalized into
+// models.Image, with IDs from ProviderImageID so they can be routed back to
+// the provider.
+type ImageProvider interface {
+	// Name returns the provider name used in image IDs, such as "pexels"
+	Name() string
+	// Configured reports whether the provider can be used
+	Configured() bool
+	SearchImages(query string, count int) ([]models.Image, error)
+	GetImage(id string) (*models.Image, error)
+	GetRandomImage(query string) (*models.Image, error)
+	// ImageSourceURL returns the URL of a JPEG of the image that is at most maxWidth pixels wide
+	ImageSourceURL(id string, maxWidth int) (string, error)
+}
+
+// apiBaseURL returns the configured base URL of a provider's API, or its
+// public API when none is configured, without a trailing slash
+func apiBaseURL(configured, public string) string {
+	if configured == "" {
+		return public
+	}
+	return strings.TrimSuffix(configured, "/")
+}
+
+// imageIDPattern matches image IDs, optionally prefixed with their provider
+var imageIDPattern = regexp.MustCompile(`^(?:[a-z]+:)?[A-Za-z0-9_-]{1,64}$`)
+
+// ValidImageID reports whether id looks like an image ID of any provider
+func ValidImageID(id string) bool {
+	return imageIDPattern.MatchString(id)
+}
+
+// ProviderImageID returns the ID of a provider's image. Unsplash IDs are not
+// prefixed, so IDs stored before there were other providers keep working.
+func ProviderImageID(provider, id string) string {
+	if provider == "unsplash" {
+		return id
+	}
+	return provider + ":" + id
+}
+
+// SplitImageID returns the provider of an image and the provider's own ID of it
+func SplitImageID(id string) (string, string) {
+	if provider, providerID, ok := strings.Cut(id, ":"); ok {
+		return provider, providerID
+	}
+	return "unsplash", id
+}
+
+// ImageChain asks image providers in order and falls through to the next
+// one when a provider fails or finds nothing. Search results are cached.
+// Providers with fewer than quotaThreshold requests left are skipped until
+// their quota is refilled.
+type ImageChain struct {
+	providers      []ImageProvider
+	cache          *CacheNamespace
+	quotaThreshold int
+
+	// When images were last returned by SearchImages or GetRandomImage, by ID
+	served     map[string]time.Time
+	lastPruned time.Time
+	servedMu   sync.Mutex
+}
+
+// servedImageWindow is how long after an image was last shown to a learner
+// its selection can be tracked
+const servedImageWindow = 24 * time.Hour
+
+// downloadTracker is implemented by providers that want to know when a learner picks an image
+type downloadTracker interface {
+	TrackDownload(imageID, selector string) bool
+}
+
+// NewImageChain creates an image chain of the providers that caches search
+// results in cache and keeps quotaThreshold requests of every provider in reserve
+func NewImageChain(cache *CacheNamespace, quotaThreshold int, providers ...ImageProvider) *ImageChain {
+	return &ImageChain{
+		providers:      providers,
+		cache:          cache,
+		quotaThreshold: quotaThreshold,
+		served:         make(map[string]time.Time),
+	}
+}
+
+// configured returns the providers that can be used, in order
+func (c *ImageChain) configured() []ImageProvider {
+	var providers []ImageProvider
+	for _, provider := range c.providers {
+		if provider.Configured() {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+// Configured reports whether any provider can be used
+func (c *ImageChain) Configured() bool {
+	return len(c.configured()) > 0
+}
+
+// RateLimitRemaining returns the remaining quota of the first provider, when it reports one
+func (c *ImageChain) RateLimitRemaining() (int, bool) {
+	providers := c.configured()
+	if len(providers) == 0 {
+		return 0, false
+	}
+	if reporter, ok := providers[0].(rateLimitReporter); ok {
+		return reporter.rateLimits().remainingRequests()
+	}
+	return 0, false
+}
+
+// Quotas returns the quotas of the configured providers that report one
+func (c *ImageChain) Quotas() []models.ProviderQuota {
+	quotas := []models.ProviderQuota{}
+	for _, provider := range c.configured() {
+		if reporter, ok := provider.(rateLimitReporter); ok {
+			quotas = append(quotas, reporter.rateLimits().quota(c.quotaThreshold))
+		}
+	}
+	return quotas
+}
+
+// throttled returns a rate limit error when a provider has too little quota left to be asked
+func (c *ImageChain) throttled(provider ImageProvider) error {
+	if reporter, ok := provider.(rateLimitReporter); ok {
+		if err := reporter.rateLimits().throttled(c.quotaThreshold); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchCacheKey returns the cache key of a search
+func searchCacheKey(query string, count int) []string {
+	return []string{"search", query, strconv.Itoa(count)}
+}
+
+// IsSearchCached reports whether the results of a search are cached
+func (c *ImageChain) IsSearchCached(query string, count int) bool {
+	return c.cache.Contains(searchCacheKey(query, count)...)
+}
+
+// SearchImages searches the providers in order and returns the results of the
+// first one that finds images
+func (c *ImageChain) SearchImages(query string, count int) ([]models.Image, error) {
+	cacheKey := searchCacheKey(query, count)
+	var cached []models.Image
+	if c.cache.Get(&cached, cacheKey...) {
+		c.markServed(cached...)
+		return cached, nil
+	}
+
+	var errs []error
+	for _, provider := range c.configured() {
+		if err := c.throttled(provider); err != nil {
+			debugLogger.Printf("Skipping %s for image search %q: %v", provider.Name(), query, err)
+			errs = append(errs, err)
+			continue
+		}
+
+		images, err := provider.SearchImages(query, count)
+		if err != nil {
+			debugLogger.Printf("Image search for %q with %s failed, trying the next provider: %v", query, provider.Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+			continue
+		}
+		if len(images) == 0 {
+			debugLogger.Printf("Image search for %q with %s found nothing, trying the next provider", query, provider.Name())
+			continue
+		}
+
+		if err := c.cache.Set(images, cacheKey...); err != nil {
+			debugLogger.Printf("Error caching image search: %v", err)
+		}
+		c.markServed(images...)
+		return images, nil
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("image search failed: %w", errors.Join(errs...))
+	}
+	return []models.Image{}, nil
+}
+
+// GetRandomImage returns a random image from the first provider that has one
+func (c *ImageChain) GetRandomImage(query string) (*models.Image, error) {
+	var errs []error
+	for _, provider := range c.configured() {
+		if err := c.throttled(provider); err != nil {
+			debugLogger.Printf("Skipping %s for a random image for %q: %v", provider.Name(), query, err)
+			errs = append(errs, err)
+			continue
+		}
+
+		image, err := provider.GetRandomImage(query)
+		if err == nil {
+			c.markServed(*image)
+			return image, nil
+		}
+		debugLogger.Printf("Random image for %q from %s failed, trying the next provider: %v", query, provider.Name(), err)
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+	}
+
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no image provider is configured: %w", ErrImageNotFound)
+	}
+	return nil, fmt.Errorf("random image failed: %w", errors.Join(errs...))
+}
+
+// markServed remembers that images were shown to a learner
+func (c *ImageChain) markServed(images ...models.Image) {
+	now := time.Now()
+
+	c.servedMu.Lock()
+	defer c.servedMu.Unlock()
+	if now.Sub(c.lastPruned) > servedImageWindow {
+		for id, at := range c.served {
+			if now.Sub(at) >= servedImageWindow {
+				delete(c.served, id)
+			}
+		}
+		c.lastPruned = now
+	}
+	for _, image := range images {
+		c.served[image.ID] = now
+	}
+}
+
+// Served reports whether an image was returned by SearchImages or
+// GetRandomImage within servedImageWindow
+func (c *ImageChain) Served(id string) bool {
+	c.servedMu.Lock()
+	defer c.servedMu.Unlock()
+	at, ok := c.served[id]
+	return ok && time.Since(at) < servedImageWindow
+}
+
+// TrackDownload reports to the provider of an image that a learner picked it,
+// for providers that track downloads. Only images this server has shown to
+// learners are tracked, and tracking requests count against the provider's
+// quota like any other. It reports whether a tracking request was started.
+func (c *ImageChain) TrackDownload(id, selector string) (bool, error) {
+	name, _ := SplitImageID(id)
+	var tracker downloadTracker
+	for _, provider := range c.providers {
+		if provider.Name() == name {
+			tracker, _ = provider.(downloadTracker)
+		}
+	}
+	if tracker == nil {
+		return false, nil
+	}
+	if !c.Served(id) {
+		return false, fmt.Errorf("image %s was not served: %w", id, ErrImageNotFound)
+	}
+
+	provider, err := c.provider(id)
+	if err != nil {
+		return false, err
+	}
+	if !tracker.TrackDownload(id, selector) {
+		return false, nil
+	}
+	if reporter, ok := provider.(rateLimitReporter); ok {
+		reporter.rateLimits().spend()
+	}
+	return true, nil
+}
+
+// provider returns the provider an image ID belongs to, or a rate limit
+// error when it has too little quota left
+func (c *ImageChain) provider(id string) (ImageProvider, error) {
+	name, _ := SplitImageID(id)
+	for _, provider := range c.providers {
+		if provider.Name() == name {
+			if !provider.Configured() {
+				return nil, fmt.Errorf("%s is not configured: %w", name, ErrImageNotFound)
+			}
+			if err := c.throttled(provider); err != nil {
+				return nil, err
+			}
+			return provider, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown image provider %q: %w", name, ErrImageNotFound)
+}
+
+// GetImage gets an image from the provider its ID belongs to
+func (c *ImageChain) GetImage(id string) (*models.Image, error) {
+	provider, err := c.provider(id)
+	if err != nil {
+		return nil, err
+	}
+	return provider.GetImage(id)
+}
+
+// ImageSourceURL returns the source URL of an image from the provider its ID belongs to
+func (c *ImageChain) ImageSourceURL(id string, maxWidth int) (string, error) {
+	provider, err := c.provider(id)
+	if err != nil {
+		return "", err
+	}
+	return provider.ImageSourceURL(id, maxWidth)
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// fixtureTransport answers requests with a recorded response from testdata and records the requests
+type fixtureTransport struct {
+	fixture string
+	status  int
+	header  http.Header
+
+	requests []*http.Request
+	mu       sync.Mutex
+}
+
+func (f *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+
+	body, err := os.Open(filepath.Join("testdata", f.fixture))
+	if err != nil {
+		return nil, err
+	}
+	header := f.header
+	if header == nil {
+		header = make(http.Header)
+	}
+	status := f.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &http.Response{StatusCode: status, Header: header, Body: body, Request: req}, nil
+}
+
+// lastRequest returns the last recorded request
+func (f *fixtureTransport) lastRequest(t *testing.T) *http.Request {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.requests) == 0 {
+		t.Fatal("no request was sent")
+	}
+	return f.requests[len(f.requests)-1]
+}
+
+// fakeProvider is an image provider with canned results
+type fakeProvider struct {
+	name     string
+	images   []models.Image
+	err      error
+	searches int
+}
+
+func (p *fakeProvider) Name() string     { return p.name }
+func (p *fakeProvider) Configured() bool { return true }
+
+func (p *fakeProvider) SearchImages(query string, count int) ([]models.Image, error) {
+	p.searches++
+	return p.images, p.err
+}
+
+func (p *fakeProvider) GetImage(id string) (*models.Image, error) {
+	for _, image := range p.images {
+		if image.ID == id {
+			return &image, nil
+		}
+	}
+	return nil, ErrImageNotFound
+}
+
+func (p *fakeProvider) GetRandomImage(query string) (*models.Image, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if len(p.images) == 0 {
+		return nil, ErrImageNotFound
+	}
+	return &p.images[0], nil
+}
+
+func (p *fakeProvider) ImageSourceURL(id string, maxWidth int) (string, error) {
+	return "https://" + p.name + "/" + id, nil
+}
+
+func TestImageChainFallsThrough(t *testing.T) {
+	failing := &fakeProvider{name: "unsplash", err: ErrRateLimited}
+	empty := &fakeProvider{name: "pexels"}
+	wikimedia := &fakeProvider{name: "wikimedia", images: []models.Image{{ID: "wikimedia:1"}}}
+	chain := NewImageChain(NewCache("").Namespace("images", 0), 0, failing, empty, wikimedia)
+
+	images, err := chain.SearchImages("apple", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || images[0].ID != "wikimedia:1" {
+		t.Errorf("got %+v, want the wikimedia image", images)
+	}
+	if failing.searches != 1 || empty.searches != 1 {
+		t.Errorf("searched failing %d and empty %d times, want once each", failing.searches, empty.searches)
+	}
+
+	// The results are cached
+	if _, err := chain.SearchImages("apple", 3); err != nil {
+		t.Fatal(err)
+	}
+	if wikimedia.searches != 1 {
+		t.Errorf("searched %d times, want the second search to be cached", wikimedia.searches)
+	}
+
+	image, err := chain.GetRandomImage("apple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.ID != "wikimedia:1" {
+		t.Errorf("random image %s, want wikimedia:1", image.ID)
+	}
+}
+
+func TestImageChainReportsAllErrors(t *testing.T) {
+	chain := NewImageChain(NewCache("").Namespace("images", 0), 0,
+		&fakeProvider{name: "unsplash", err: ErrRateLimited},
+		&fakeProvider{name: "pexels", err: errors.New("unexpected status code: 500")})
+
+	_, err := chain.SearchImages("apple", 3)
+	if !errors.Is(err, ErrRateLimited) || !strings.Contains(err.Error(), "500") {
+		t.Errorf("err = %v, want the errors of both providers", err)
+	}
+
+	// Nothing found without errors is not an error
+	chain = NewImageChain(NewCache("").Namespace("images", 0), 0, &fakeProvider{name: "pexels"})
+	images, err := chain.SearchImages("apple", 3)
+	if err != nil || len(images) != 0 {
+		t.Errorf("got %v, %v, want no images and no error", images, err)
+	}
+}
+
+func TestImageChainRoutesByID(t *testing.T) {
+	chain := NewImageChain(NewCache("").Namespace("images", 0), 0,
+		&fakeProvider{name: "unsplash", images: []models.Image{{ID: "abc"}}},
+		&fakeProvider{name: "pexels", images: []models.Image{{ID: "pexels:42"}}})
+
+	tests := []struct {
+		id      string
+		wantURL string
+	}{
+		{"abc", "https://unsplash/abc"},
+		{"pexels:42", "https://pexels/pexels:42"},
+	}
+	for _, tt := range tests {
+		if image, err := chain.GetImage(tt.id); err != nil || image.ID != tt.id {
+			t.Errorf("GetImage(%s) = %v, %v", tt.id, image, err)
+		}
+		if url, err := chain.ImageSourceURL(tt.id, 800); err != nil || url != tt.wantURL {
+			t.Errorf("ImageSourceURL(%s) = %s, %v, want %s", tt.id, url, err, tt.wantURL)
+		}
+	}
+
+	if _, err := chain.GetImage("flickr:1"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("err = %v, want ErrImageNotFound for an unknown provider", err)
+	}
+}
+
+func TestValidImageID(t *testing.T) {
+	for _, id := range []string{"abc-123_X", "pexels:1132047", "wikimedia:4466547"} {
+		if !ValidImageID(id) {
+			t.Errorf("ValidImageID(%q) = false", id)
+		}
+	}
+	for _, id := range []string{"", "../etc", "pexels:", "a:b:c", "Pexels:1", "abc def"} {
+		if ValidImageID(id) {
+			t.Errorf("ValidImageID(%q) = true", id)
+		}
+	}
+}
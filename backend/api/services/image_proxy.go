@@ -0,0 +1,429 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/yourusername/picto-lingua-backend/api/models"
+	"golang.org/x/image/draw"
+
+	// Decoders for the originals
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxImageSize is the largest width or height the proxy serves, originals are fetched at this width
+	MaxImageSize = 1600
+	// maxOriginalBytes limits the size of a fetched original
+	maxOriginalBytes = 20 << 20
+	// maxOriginalPixels limits the dimensions of an original, which are
+	// checked before it is decoded
+	maxOriginalPixels = 40_000_000
+	// originalFetchTimeout limits fetching an original
+	originalFetchTimeout = 30 * time.Second
+	// jpegQuality is the quality of the JPEG variants
+	jpegQuality = 85
+)
+
+// Image formats served by the proxy
+const (
+	ImageFormatJPEG = "jpeg"
+	ImageFormatWebP = "webp"
+)
+
+// ErrInvalidImageVariant is returned for sizes or formats the proxy does not serve
+var ErrInvalidImageVariant = errors.New("invalid image variant")
+
+// imageSizes are the widths and heights variants are created in, requested
+// sizes are rounded up to the next one so every image has few variants
+var imageSizes = []int{100, 150, 200, 300, 400, 600, 800, 1200, MaxImageSize}
+
+// ImageSource resolves the URL an image is downloaded from
+type ImageSource interface {
+	ImageSourceURL(id string, maxWidth int) (string, error)
+}
+
+// ImageVariant is a size and format of an image. A zero width or height keeps
+// the aspect ratio, with both set the image is cropped to fill them.
+type ImageVariant struct {
+	Width  int
+	Height int
+	Format string
+}
+
+// ImageFile is an image variant stored on disk
+type ImageFile struct {
+	Path        string
+	ContentType string
+	ModTime     time.Time
+}
+
+// ImageProxy serves resized copies of images from its own disk cache. Every
+// image is fetched once and kept, so it stays available when the image
+// provider is not.
+type ImageProxy struct {
+	source ImageSource
+	dir    string
+	client *http.Client
+
+	// Concurrent requests for the same variant only create it once
+	locks fileLocks
+
+	// Placeholders by image ID, loaded from disk on first use
+	placeholders   map[string]models.ImagePlaceholder
+	placeholdersMu sync.RWMutex
+}
+
+// NewImageProxy creates an image proxy that caches images in dir
+func NewImageProxy(source ImageSource, dir string) *ImageProxy {
+	return &ImageProxy{
+		source: source,
+		dir:    dir,
+		client: &http.Client{Timeout: originalFetchTimeout},
+
+		placeholders: make(map[string]models.ImagePlaceholder),
+	}
+}
+
+// Validate normalizes a variant and checks that the proxy serves it
+func (v *ImageVariant) Validate() error {
+	switch strings.ToLower(v.Format) {
+	case "", ImageFormatJPEG, "jpg":
+		v.Format = ImageFormatJPEG
+	case ImageFormatWebP:
+		v.Format = ImageFormatWebP
+	default:
+		return fmt.Errorf("%w: format must be jpeg or webp", ErrInvalidImageVariant)
+	}
+
+	if v.Width < 0 || v.Width > MaxImageSize || v.Height < 0 || v.Height > MaxImageSize {
+		return fmt.Errorf("%w: width and height must be between 0 and %d", ErrInvalidImageVariant, MaxImageSize)
+	}
+	v.Width = roundImageSize(v.Width)
+	v.Height = roundImageSize(v.Height)
+	return nil
+}
+
+// roundImageSize rounds a width or height up to the next of imageSizes, zero
+// stays zero
+func roundImageSize(size int) int {
+	if size == 0 {
+		return 0
+	}
+	for _, s := range imageSizes {
+		if size <= s {
+			return s
+		}
+	}
+	return MaxImageSize
+}
+
+// contentType returns the MIME type of the variant's format
+func (v ImageVariant) contentType() string {
+	if v.Format == ImageFormatWebP {
+		return "image/webp"
+	}
+	return "image/jpeg"
+}
+
+// Get returns a variant of an image, fetching and resizing it on a cache miss
+func (p *ImageProxy) Get(ctx context.Context, id string, variant ImageVariant) (*ImageFile, error) {
+	if !ValidImageID(id) {
+		return nil, ErrImageNotFound
+	}
+	if err := variant.Validate(); err != nil {
+		return nil, err
+	}
+
+	path := p.path("variants", id, fmt.Sprintf("%dx%d.%s", variant.Width, variant.Height, variant.Format))
+	unlock := p.locks.lock(path)
+	defer unlock()
+
+	if file, err := statImage(path, variant.contentType()); err == nil {
+		return file, nil
+	}
+
+	original, err := p.original(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := decodeOriginal(id, original)
+	if err != nil {
+		return nil, err
+	}
+
+	// The original is at hand, so compute its placeholder while we are at it
+	if _, ok := p.CachedPlaceholder(id); !ok {
+		if _, err := p.storePlaceholder(id, img); err != nil {
+			debugLogger.Printf("Error computing placeholder of image %s: %v", id, err)
+		}
+	}
+
+	img = resizeImage(img, variant.Width, variant.Height)
+
+	var buf bytes.Buffer
+	if variant.Format == ImageFormatWebP {
+		err = nativewebp.Encode(&buf, img, nil)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error encoding image %s: %w", id, err)
+	}
+
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("error caching image %s: %w", id, err)
+	}
+	debugLogger.Printf("Created %s variant %dx%d of image %s", variant.Format, variant.Width, variant.Height, id)
+
+	return statImage(path, variant.contentType())
+}
+
+// original returns the original of an image, downloading it on first use
+func (p *ImageProxy) original(ctx context.Context, id string) ([]byte, error) {
+	path := p.path("originals", id, "original")
+	unlock := p.locks.lock(path)
+	defer unlock()
+
+	if data, err := os.ReadFile(path); err == nil {
+		return data, nil
+	}
+
+	sourceURL, err := p.source.ImageSourceURL(id, MaxImageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", sourceURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading image %s: %w", id, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading image %s: unexpected status code: %d", id, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOriginalBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("error downloading image %s: %w", id, err)
+	}
+	if len(data) > maxOriginalBytes {
+		return nil, fmt.Errorf("error downloading image %s: larger than %d bytes", id, maxOriginalBytes)
+	}
+	if err := checkOriginal(id, data); err != nil {
+		return nil, err
+	}
+
+	if err := writeFileAtomic(path, data); err != nil {
+		return nil, fmt.Errorf("error caching image %s: %w", id, err)
+	}
+	debugLogger.Printf("Downloaded original of image %s (%d bytes)", id, len(data))
+
+	return data, nil
+}
+
+// checkOriginal checks the dimensions an original declares without decoding
+// it, so a small file cannot make us allocate a huge image
+func checkOriginal(id string, data []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error decoding image %s: %w", id, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxOriginalPixels {
+		return fmt.Errorf("error decoding image %s: %dx%d is too large", id, config.Width, config.Height)
+	}
+	return nil
+}
+
+// decodeOriginal decodes an original once its dimensions have been checked
+func decodeOriginal(id string, data []byte) (image.Image, error) {
+	if err := checkOriginal(id, data); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image %s: %w", id, err)
+	}
+	return img, nil
+}
+
+// Placeholder returns the BlurHash and dominant color of an image, computing
+// them from the original when they have not been computed before
+func (p *ImageProxy) Placeholder(ctx context.Context, id string) (*models.ImagePlaceholder, error) {
+	if !ValidImageID(id) {
+		return nil, ErrImageNotFound
+	}
+	if placeholder, ok := p.CachedPlaceholder(id); ok {
+		return placeholder, nil
+	}
+
+	unlock := p.locks.lock(p.placeholderPath(id))
+	defer unlock()
+
+	// Another request may have computed it while we waited
+	if placeholder, ok := p.CachedPlaceholder(id); ok {
+		return placeholder, nil
+	}
+
+	original, err := p.original(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	img, err := decodeOriginal(id, original)
+	if err != nil {
+		return nil, err
+	}
+	return p.storePlaceholder(id, img)
+}
+
+// CachedPlaceholder returns the placeholder of an image if it has been computed
+func (p *ImageProxy) CachedPlaceholder(id string) (*models.ImagePlaceholder, bool) {
+	p.placeholdersMu.RLock()
+	placeholder, ok := p.placeholders[id]
+	p.placeholdersMu.RUnlock()
+	if ok {
+		return &placeholder, true
+	}
+
+	if !ValidImageID(id) {
+		return nil, false
+	}
+	data, err := os.ReadFile(p.placeholderPath(id))
+	if err != nil {
+		return nil, false
+	}
+	if err := json.Unmarshal(data, &placeholder); err != nil {
+		debugLogger.Printf("Error decoding placeholder of image %s: %v", id, err)
+		return nil, false
+	}
+
+	p.placeholdersMu.Lock()
+	p.placeholders[id] = placeholder
+	p.placeholdersMu.Unlock()
+	return &placeholder, true
+}
+
+// FillPlaceholders sets the BlurHash and color of images that have none,
+// using placeholders computed before. It never downloads an image.
+func (p *ImageProxy) FillPlaceholders(images []models.Image) {
+	for i := range images {
+		if images[i].BlurHash != "" && images[i].Color != "" {
+			continue
+		}
+		placeholder, ok := p.CachedPlaceholder(images[i].ID)
+		if !ok {
+			continue
+		}
+		if images[i].BlurHash == "" {
+			images[i].BlurHash = placeholder.BlurHash
+		}
+		if images[i].Color == "" {
+			images[i].Color = placeholder.Color
+		}
+	}
+}
+
+// storePlaceholder computes the placeholder of an image and caches it
+func (p *ImageProxy) storePlaceholder(id string, img image.Image) (*models.ImagePlaceholder, error) {
+	sample := placeholderSample(img)
+	blurHash, err := EncodeBlurHash(sample, blurHashComponentsX, blurHashComponentsY)
+	if err != nil {
+		return nil, err
+	}
+	placeholder := models.ImagePlaceholder{BlurHash: blurHash, Color: DominantColor(sample)}
+
+	data, err := json.Marshal(placeholder)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(p.placeholderPath(id), data); err != nil {
+		return nil, fmt.Errorf("error caching placeholder of image %s: %w", id, err)
+	}
+
+	p.placeholdersMu.Lock()
+	p.placeholders[id] = placeholder
+	p.placeholdersMu.Unlock()
+	return &placeholder, nil
+}
+
+// placeholderPath returns the file the placeholder of an image is cached in
+func (p *ImageProxy) placeholderPath(id string) string {
+	return p.path("placeholders", id, "placeholder.json")
+}
+
+// path returns where a file of an image is stored, in a directory per provider
+func (p *ImageProxy) path(kind, id, name string) string {
+	provider, providerID := SplitImageID(id)
+	return filepath.Join(p.dir, kind, provider, providerID, name)
+}
+
+// statImage returns the cached image file at path
+func statImage(path, contentType string) (*ImageFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ImageFile{Path: path, ContentType: contentType, ModTime: info.ModTime()}, nil
+}
+
+// resizeImage scales an image to the width and height. With one of them zero
+// the aspect ratio is kept, with both set the image is scaled to cover them
+// and cropped around its center. Images are never enlarged.
+func resizeImage(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	switch {
+	case width == 0 && height == 0:
+		return img
+	case height == 0:
+		height = max(1, srcH*width/srcW)
+	case width == 0:
+		width = max(1, srcW*height/srcH)
+	}
+
+	// The part of the source with the aspect ratio of the target
+	crop := bounds
+	if srcW*height > srcH*width {
+		cropW := srcH * width / height
+		crop.Min.X += (srcW - cropW) / 2
+		crop.Max.X = crop.Min.X + cropW
+	} else {
+		cropH := srcW * height / width
+		crop.Min.Y += (srcH - cropH) / 2
+		crop.Max.Y = crop.Min.Y + cropH
+	}
+
+	// Do not enlarge, shrink the target to the cropped source instead
+	if width > crop.Dx() {
+		width, height = crop.Dx(), max(1, height*crop.Dx()/width)
+	}
+	if height > crop.Dy() {
+		width, height = max(1, width*crop.Dy()/height), crop.Dy()
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+	return dst
+}
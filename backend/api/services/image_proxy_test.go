@@ -0,0 +1,229 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+	"golang.org/x/image/webp"
+)
+
+// fakeImageSource serves a 400x300 JPEG and counts the downloads
+type fakeImageSource struct {
+	url       string
+	downloads atomic.Int32
+}
+
+func (f *fakeImageSource) ImageSourceURL(id string, maxWidth int) (string, error) {
+	if id == "missing" {
+		return "", ErrImageNotFound
+	}
+	return f.url, nil
+}
+
+func newTestImageProxy(t *testing.T) (*ImageProxy, *fakeImageSource) {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for x := 0; x < 400; x++ {
+		for y := 0; y < 300; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var original bytes.Buffer
+	if err := jpeg.Encode(&original, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return newImageProxyServing(t, original.Bytes())
+}
+
+// newImageProxyServing creates an image proxy whose source serves original for every image
+func newImageProxyServing(t *testing.T, original []byte) (*ImageProxy, *fakeImageSource) {
+	t.Helper()
+
+	source := &fakeImageSource{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		source.downloads.Add(1)
+		w.Write(original)
+	}))
+	t.Cleanup(server.Close)
+	source.url = server.URL
+
+	return NewImageProxy(source, t.TempDir()), source
+}
+
+func TestImageProxyResizesVariants(t *testing.T) {
+	proxy, source := newTestImageProxy(t)
+
+	tests := []struct {
+		variant      ImageVariant
+		wantW, wantH int
+	}{
+		{ImageVariant{}, 400, 300},
+		{ImageVariant{Width: 200, Height: 200}, 200, 200},
+		{ImageVariant{Width: 100}, 100, 75},
+		{ImageVariant{Height: 150}, 200, 150},
+		{ImageVariant{Width: 800}, 400, 300},              // never enlarged
+		{ImageVariant{Width: 800, Height: 400}, 400, 200}, // cropped, then shrunk to fit the source
+	}
+	for _, tt := range tests {
+		file, err := proxy.Get(context.Background(), "abc", tt.variant)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.variant, err)
+		}
+		f, err := os.Open(file.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, err := jpeg.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.variant, err)
+		}
+		if config.Width != tt.wantW || config.Height != tt.wantH {
+			t.Errorf("%+v: got %dx%d, want %dx%d", tt.variant, config.Width, config.Height, tt.wantW, tt.wantH)
+		}
+	}
+
+	if n := source.downloads.Load(); n != 1 {
+		t.Errorf("downloaded the original %d times, want 1", n)
+	}
+}
+
+func TestImageProxyEncodesWebP(t *testing.T) {
+	proxy, _ := newTestImageProxy(t)
+
+	file, err := proxy.Get(context.Background(), "abc", ImageVariant{Width: 120, Format: "webp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.ContentType != "image/webp" {
+		t.Errorf("content type = %s, want image/webp", file.ContentType)
+	}
+
+	f, err := os.Open(file.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := webp.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The width is rounded up to the next variant size
+	if b := img.Bounds(); b.Dx() != 150 || b.Dy() != 112 {
+		t.Errorf("got %dx%d, want 150x112", b.Dx(), b.Dy())
+	}
+}
+
+func TestImageProxyRoundsVariantSizes(t *testing.T) {
+	proxy, _ := newTestImageProxy(t)
+
+	paths := make(map[string]bool)
+	for size := 101; size <= 150; size++ {
+		file, err := proxy.Get(context.Background(), "abc", ImageVariant{Width: size, Height: size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths[file.Path] = true
+	}
+	if len(paths) != 1 {
+		t.Errorf("created %d variants, want only 150x150", len(paths))
+	}
+}
+
+func TestImageProxyRejectsHugeOriginals(t *testing.T) {
+	// A tiny PNG that claims to be 100000x100000 pixels
+	var small bytes.Buffer
+	if err := png.Encode(&small, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := small.Bytes()
+	ihdr := data[12 : 12+4+13] // chunk type and data
+	binary.BigEndian.PutUint32(ihdr[4:], 100000)
+	binary.BigEndian.PutUint32(ihdr[8:], 100000)
+	binary.BigEndian.PutUint32(data[12+4+13:], crc32.ChecksumIEEE(ihdr))
+
+	proxy, _ := newImageProxyServing(t, data)
+	if _, err := proxy.Get(context.Background(), "abc", ImageVariant{Width: 100}); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("err = %v, want the image rejected as too large", err)
+	}
+	if _, err := proxy.Placeholder(context.Background(), "abc"); err == nil {
+		t.Error("placeholder computed for a huge image")
+	}
+	if _, err := os.Stat(proxy.path("originals", "abc", "original")); err == nil {
+		t.Error("huge original cached")
+	}
+}
+
+func TestImageProxyRejectsInvalidRequests(t *testing.T) {
+	proxy, source := newTestImageProxy(t)
+
+	for _, variant := range []ImageVariant{{Format: "gif"}, {Width: -1}, {Height: MaxImageSize + 1}} {
+		if _, err := proxy.Get(context.Background(), "abc", variant); !errors.Is(err, ErrInvalidImageVariant) {
+			t.Errorf("%+v: err = %v, want ErrInvalidImageVariant", variant, err)
+		}
+	}
+	for _, id := range []string{"missing", "../etc", ""} {
+		if _, err := proxy.Get(context.Background(), id, ImageVariant{}); !errors.Is(err, ErrImageNotFound) {
+			t.Errorf("%q: err = %v, want ErrImageNotFound", id, err)
+		}
+	}
+	if n := source.downloads.Load(); n != 0 {
+		t.Errorf("downloaded %d originals for invalid requests", n)
+	}
+}
+
+func TestImageProxyCachesPlaceholders(t *testing.T) {
+	proxy, source := newTestImageProxy(t)
+
+	if _, ok := proxy.CachedPlaceholder("abc"); ok {
+		t.Fatal("placeholder cached before the image was seen")
+	}
+
+	// Serving a variant computes the placeholder from the original
+	if _, err := proxy.Get(context.Background(), "abc", ImageVariant{Width: 100}); err != nil {
+		t.Fatal(err)
+	}
+	placeholder, ok := proxy.CachedPlaceholder("abc")
+	if !ok || len(placeholder.BlurHash) != 28 || !strings.HasPrefix(placeholder.Color, "#") {
+		t.Fatalf("placeholder = %+v, %v", placeholder, ok)
+	}
+
+	// A new proxy finds it on disk
+	reopened := NewImageProxy(source, proxy.dir)
+	images := []models.Image{{ID: "abc"}, {ID: "other", BlurHash: "LKO2?U%2Tw=w", Color: "#ffffff"}}
+	reopened.FillPlaceholders(images)
+	if images[0].BlurHash != placeholder.BlurHash || images[0].Color != placeholder.Color {
+		t.Errorf("filled %+v, want %+v", images[0], placeholder)
+	}
+	if images[1].BlurHash != "LKO2?U%2Tw=w" {
+		t.Error("a placeholder from the provider was overwritten")
+	}
+
+	// Placeholder computes it on demand
+	fresh := NewImageProxy(source, t.TempDir())
+	computed, err := fresh.Placeholder(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if computed.BlurHash != placeholder.BlurHash {
+		t.Errorf("blurhash = %s, want %s", computed.BlurHash, placeholder.BlurHash)
+	}
+	if n := source.downloads.Load(); n != 2 {
+		t.Errorf("downloaded the original %d times, want 2", n)
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// ipaSymbols lists the IPA characters outside the Unicode ranges accepted by isIPARune
+const ipaSymbols = "æçðøħŋœβθχ" + // Latin-1, Latin Extended and Greek letters used by the IPA
+	" .|‖‿" + // word and syllable boundaries, intonation groups and linking
+	"()" // optional segments
+
+// isIPARune reports whether r is allowed in an IPA transcription
+func isIPARune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return true
+	case r >= 0x0250 && r <= 0x02AF: // IPA Extensions
+		return true
+	case r >= 0x02B0 && r <= 0x02FF: // Spacing Modifier Letters (ˈ ˌ ː ʰ ʲ ...)
+		return true
+	case r >= 0x0300 && r <= 0x036F: // Combining Diacritical Marks
+		return true
+	case r == 0x1D4A || r == 0x1D7B || r == 0x1D7F: // ᵊ ᵻ ᵿ
+		return true
+	}
+	return strings.ContainsRune(ipaSymbols, r)
+}
+
+// NormalizeIPA trims a transcription and wraps it in phonemic slashes.
+// Transcriptions already delimited by slashes or square brackets keep their delimiters.
+func NormalizeIPA(ipa string) string {
+	ipa = strings.TrimSpace(ipa)
+	if ipa == "" {
+		return ""
+	}
+	if strings.HasPrefix(ipa, "[") && strings.HasSuffix(ipa, "]") {
+		return ipa
+	}
+	return "/" + strings.Trim(ipa, "/ ") + "/"
+}
+
+// ValidateIPA checks that a transcription only uses characters from the IPA
+func ValidateIPA(ipa string) error {
+	ipa = NormalizeIPA(ipa)
+	if ipa == "" {
+		return nil
+	}
+
+	body := ipa[1 : len(ipa)-1]
+	if strings.TrimSpace(body) == "" {
+		return fmt.Errorf("empty transcription")
+	}
+	for _, r := range body {
+		if !isIPARune(r) {
+			if unicode.IsPrint(r) {
+				return fmt.Errorf("invalid IPA character %q", r)
+			}
+			return fmt.Errorf("invalid IPA character %U", r)
+		}
+	}
+	return nil
+}
+
+// sanitizeIPA normalizes the transcriptions of generated vocabulary and
+// drops the ones that fail validation
+func sanitizeIPA(vocabulary []models.VocabularyItem) {
+	for i := range vocabulary {
+		item := &vocabulary[i]
+		item.IPA = NormalizeIPA(item.IPA)
+		if err := ValidateIPA(item.IPA); err != nil {
+			debugLogger.Printf("Dropping invalid IPA %q for word %q: %v", item.IPA, item.Word, err)
+			item.IPA = ""
+		}
+		item.DutchIPA = NormalizeIPA(item.DutchIPA)
+		if err := ValidateIPA(item.DutchIPA); err != nil {
+			debugLogger.Printf("Dropping invalid Dutch IPA %q for word %q: %v", item.DutchIPA, item.DutchWord, err)
+			item.DutchIPA = ""
+		}
+	}
+}
+
+// PronunciationOverride is a transcription set by an admin for a word
+type PronunciationOverride struct {
+	Word     string `json:"word"`
+	IPA      string `json:"ipa,omitempty"`
+	DutchIPA string `json:"dutch_ipa,omitempty"`
+}
+
+// PronunciationService stores admin overrides for generated transcriptions
+type PronunciationService struct {
+	overrides map[string]PronunciationOverride
+	mu        sync.RWMutex
+}
+
+// NewPronunciationService creates a new pronunciation service
+func NewPronunciationService() *PronunciationService {
+	return &PronunciationService{
+		overrides: make(map[string]PronunciationOverride),
+	}
+}
+
+// SetOverride validates and stores an override for an English word
+func (s *PronunciationService) SetOverride(override PronunciationOverride) (*PronunciationOverride, error) {
+	override.Word = strings.TrimSpace(override.Word)
+	if override.Word == "" {
+		return nil, fmt.Errorf("word is required")
+	}
+
+	override.IPA = NormalizeIPA(override.IPA)
+	if err := ValidateIPA(override.IPA); err != nil {
+		return nil, fmt.Errorf("ipa: %w", err)
+	}
+	override.DutchIPA = NormalizeIPA(override.DutchIPA)
+	if err := ValidateIPA(override.DutchIPA); err != nil {
+		return nil, fmt.Errorf("dutch_ipa: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.ToLower(override.Word)
+	if override.IPA == "" && override.DutchIPA == "" {
+		delete(s.overrides, key)
+	} else {
+		s.overrides[key] = override
+	}
+
+	return &override, nil
+}
+
+// Apply returns a copy of the vocabulary with the overrides applied
+func (s *PronunciationService) Apply(vocabulary []models.VocabularyItem) []models.VocabularyItem {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.overrides) == 0 {
+		return vocabulary
+	}
+
+	result := make([]models.VocabularyItem, len(vocabulary))
+	copy(result, vocabulary)
+	for i := range result {
+		override, ok := s.overrides[strings.ToLower(result[i].Word)]
+		if !ok {
+			continue
+		}
+		if override.IPA != "" {
+			result[i].IPA = override.IPA
+		}
+		if override.DutchIPA != "" {
+			result[i].DutchIPA = override.DutchIPA
+		}
+	}
+	return result
+}
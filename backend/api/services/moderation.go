@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+const (
+	// moderationTimeout limits a single moderation request
+	moderationTimeout = 10 * time.Second
+	// moderationConcurrency limits the moderation requests in flight for one vocabulary list
+	moderationConcurrency = 4
+)
+
+// defaultBlocklist holds terms that are never shown to children, as whole words or phrases
+var defaultBlocklist = []string{
+	"sex", "sexy", "sexual", "nude", "nudity", "naked", "porn", "pornography", "erotic", "lingerie",
+	"kill", "killing", "murder", "suicide", "blood", "bloody", "gore", "corpse", "dead body",
+	"gun", "guns", "rifle", "pistol", "weapon", "weapons", "bomb", "terrorist",
+	"drug", "drugs", "cocaine", "heroin", "marijuana", "cannabis", "cigarette", "vape",
+	"drunk", "casino", "gambling",
+}
+
+// Blocklist matches text against a list of words and phrases
+type Blocklist struct {
+	terms []string // normalized, each surrounded by spaces
+}
+
+// NewBlocklist creates a blocklist of the default terms and the extra terms
+func NewBlocklist(extra []string) *Blocklist {
+	b := &Blocklist{}
+	for _, term := range append(append([]string(nil), defaultBlocklist...), extra...) {
+		if normalized := normalizeWords(term); normalized != "" {
+			b.terms = append(b.terms, " "+normalized+" ")
+		}
+	}
+	return b
+}
+
+// Match returns the first blocked term that occurs in the text as a whole word or phrase
+func (b *Blocklist) Match(texts ...string) (string, bool) {
+	if b == nil {
+		return "", false
+	}
+	text := " " + normalizeWords(strings.Join(texts, " ")) + " "
+	for _, term := range b.terms {
+		if strings.Contains(text, term) {
+			return strings.TrimSpace(term), true
+		}
+	}
+	return "", false
+}
+
+// normalizeWords lowercases text and separates its words by single spaces
+func normalizeWords(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// ContentModerator decides whether text is suitable for children
+type ContentModerator interface {
+	// Name returns the moderator name
+	Name() string
+	// Moderate returns why the text is unsuitable, or an empty string if it is fine
+	Moderate(ctx context.Context, text string) (string, error)
+}
+
+// OpenAIContentModerator uses the OpenAI moderation API
+type OpenAIContentModerator struct {
+	client *openai.Client
+}
+
+// NewOpenAIContentModerator creates a new OpenAI content moderator that sends
+// requests to baseURL, or to the OpenAI API when it is empty
+func NewOpenAIContentModerator(apiKey, baseURL string) *OpenAIContentModerator {
+	return &OpenAIContentModerator{client: newOpenAIClient(apiKey, baseURL)}
+}
+
+// Name returns the moderator name
+func (m *OpenAIContentModerator) Name() string {
+	return "openai"
+}
+
+// Moderate flags text in any of the OpenAI moderation categories
+func (m *OpenAIContentModerator) Moderate(ctx context.Context, text string) (string, error) {
+	resp, err := m.client.Moderations(ctx, openai.ModerationRequest{
+		Input: text,
+		Model: openai.ModerationOmniLatest,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error moderating text: %w", err)
+	}
+
+	for _, result := range resp.Results {
+		if result.Flagged {
+			return "flagged by OpenAI moderation: " + strings.Join(flaggedCategories(result.Categories), ", "), nil
+		}
+	}
+	return "", nil
+}
+
+// flaggedCategories lists the names of the flagged moderation categories
+func flaggedCategories(c openai.ResultCategories) []string {
+	categories := []struct {
+		name    string
+		flagged bool
+	}{
+		{"hate", c.Hate}, {"hate/threatening", c.HateThreatening},
+		{"harassment", c.Harassment}, {"harassment/threatening", c.HarassmentThreatening},
+		{"self-harm", c.SelfHarm}, {"self-harm/intent", c.SelfHarmIntent}, {"self-harm/instructions", c.SelfHarmInstructions},
+		{"sexual", c.Sexual}, {"sexual/minors", c.SexualMinors},
+		{"violence", c.Violence}, {"violence/graphic", c.ViolenceGraphic},
+	}
+
+	var flagged []string
+	for _, category := range categories {
+		if category.flagged {
+			flagged = append(flagged, category.name)
+		}
+	}
+	return flagged
+}
+
+// BlocklistContentModerator flags text that contains a blocked term
+type BlocklistContentModerator struct {
+	blocklist *Blocklist
+}
+
+// NewBlocklistContentModerator creates a new blocklist based content moderator
+func NewBlocklistContentModerator(blocklist *Blocklist) *BlocklistContentModerator {
+	return &BlocklistContentModerator{blocklist: blocklist}
+}
+
+// Name returns the moderator name
+func (m *BlocklistContentModerator) Name() string {
+	return "blocklist"
+}
+
+// Moderate flags text containing a blocked term
+func (m *BlocklistContentModerator) Moderate(ctx context.Context, text string) (string, error) {
+	if term, ok := m.blocklist.Match(text); ok {
+		return fmt.Sprintf("contains blocked term %q", term), nil
+	}
+	return "", nil
+}
+
+// MockContentModerator lets all text through
+type MockContentModerator struct{}
+
+// Name returns the moderator name
+func (MockContentModerator) Name() string {
+	return "mock"
+}
+
+// Moderate never flags text
+func (MockContentModerator) Moderate(ctx context.Context, text string) (string, error) {
+	return "", nil
+}
+
+// ModerationService screens generated content before it reaches learners.
+// A nil ModerationService lets everything through.
+type ModerationService struct {
+	moderator ContentModerator
+	// fallback is used when the moderator fails, so content is never let through unscreened
+	fallback *Blocklist
+}
+
+// NewModerationService creates a moderation service that falls back to the
+// blocklist when the moderator fails
+func NewModerationService(moderator ContentModerator, fallback *Blocklist) *ModerationService {
+	return &ModerationService{moderator: moderator, fallback: fallback}
+}
+
+// FilterVocabulary returns the vocabulary items the moderator accepts, in
+// their original order. The reasons for rejected items are logged.
+func (s *ModerationService) FilterVocabulary(ctx context.Context, items []models.VocabularyItem) []models.VocabularyItem {
+	if s == nil || len(items) == 0 {
+		return items
+	}
+
+	reasons := make([]string, len(items))
+	slots := make(chan struct{}, moderationConcurrency)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			reasons[i] = s.moderate(ctx, vocabularyText(item))
+		}()
+	}
+	wg.Wait()
+
+	accepted := make([]models.VocabularyItem, 0, len(items))
+	for i, item := range items {
+		if reasons[i] != "" {
+			debugLogger.Printf("Moderation rejected vocabulary item %q: %s", item.Word, reasons[i])
+			continue
+		}
+		accepted = append(accepted, item)
+	}
+	return accepted
+}
+
+// moderate returns why a text is rejected, or an empty string if it is accepted
+func (s *ModerationService) moderate(ctx context.Context, text string) string {
+	ctx, cancel := context.WithTimeout(ctx, moderationTimeout)
+	defer cancel()
+
+	reason, err := s.moderator.Moderate(ctx, text)
+	if err == nil {
+		return reason
+	}
+
+	debugLogger.Printf("Moderation with %s failed, using the blocklist: %v", s.moderator.Name(), err)
+	if term, ok := s.fallback.Match(text); ok {
+		return fmt.Sprintf("contains blocked term %q", term)
+	}
+	return ""
+}
+
+// vocabularyText joins the text of a vocabulary item that learners see
+func vocabularyText(item models.VocabularyItem) string {
+	parts := []string{item.Word, item.Definition, item.Example, item.DutchWord, item.DutchDefinition, item.DutchExample}
+	text := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part != "" {
+			text = append(text, part)
+		}
+	}
+	return strings.Join(text, "\n")
+}
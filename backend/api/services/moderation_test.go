@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+func TestBlocklistMatchesWholeWords(t *testing.T) {
+	b := NewBlocklist([]string{"Scary Clown"})
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"A KILL switch", "kill"},
+		{"learn a new skill", ""},
+		{"a scary  clown!", "scary clown"},
+		{"a scary movie about a clown", ""},
+		{"drugstore", ""},
+	}
+	for _, tt := range tests {
+		term, ok := b.Match(tt.text)
+		if term != tt.want || ok != (tt.want != "") {
+			t.Errorf("Match(%q) = %q, %v, want %q", tt.text, term, ok, tt.want)
+		}
+	}
+}
+
+// fakeModerator flags text containing "bad" and fails on text containing "fail"
+type fakeModerator struct{}
+
+func (fakeModerator) Name() string { return "fake" }
+
+func (fakeModerator) Moderate(ctx context.Context, text string) (string, error) {
+	if strings.Contains(text, "fail") {
+		return "", errors.New("moderation unavailable")
+	}
+	if strings.Contains(text, "bad") {
+		return "bad", nil
+	}
+	return "", nil
+}
+
+func TestFilterVocabulary(t *testing.T) {
+	s := NewModerationService(fakeModerator{}, NewBlocklist(nil))
+	items := []models.VocabularyItem{
+		{Word: "bench", Definition: "A seat"},
+		{Word: "thing", Definition: "Something bad"},
+		{Word: "tree", Definition: "A plant", DutchExample: "bad"},
+		{Word: "pistol", Definition: "fail"}, // the moderator fails, the blocklist catches it
+		{Word: "flower", Definition: "fail"}, // the moderator fails, the blocklist lets it through
+		{Word: "sign", Definition: "Keep off the grass"},
+	}
+
+	var words []string
+	for _, item := range s.FilterVocabulary(context.Background(), items) {
+		words = append(words, item.Word)
+	}
+	if got := strings.Join(words, ","); got != "bench,flower,sign" {
+		t.Errorf("accepted %s, want bench,flower,sign", got)
+	}
+}
+
+func TestFilterVocabularyWithoutModeration(t *testing.T) {
+	var s *ModerationService
+	items := []models.VocabularyItem{{Word: "pistol"}}
+	if got := s.FilterVocabulary(context.Background(), items); len(got) != 1 {
+		t.Error("a nil moderation service should let everything through")
+	}
+}
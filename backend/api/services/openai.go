@@ -4,28 +4,33 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/sashabaranov/go-openai"
 	"github.com/yourusername/picto-lingua-backend/api/models"
 )
 
-var (
-	// Create a logger that writes to a file
-	debugLogger = initDebugLogger()
-)
+// debugLogger records the requests to and responses from OpenAI and the image
+// providers. It discards everything until OpenDebugLog is called.
+var debugLogger = log.New(io.Discard, "DEBUG: ", log.Ldate|log.Ltime)
+
+// OpenDebugLog appends the debug log to a file, or discards it when path is empty
+func OpenDebugLog(path string) error {
+	if path == "" {
+		debugLogger.SetOutput(io.Discard)
+		return nil
+	}
 
-// initDebugLogger initializes a logger that writes to a file
-func initDebugLogger() *log.Logger {
-	// Create or open the log file
-	logFile, err := os.OpenFile("openai_debug.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	logFile, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
-		log.Printf("ERROR: Failed to open log file: %v", err)
-		return log.New(os.Stderr, "DEBUG: ", log.Ldate|log.Ltime)
+		return err
 	}
-	return log.New(logFile, "DEBUG: ", log.Ldate|log.Ltime)
+	debugLogger.SetOutput(logFile)
+	return nil
 }
 
 // OpenAIService handles communication with the OpenAI API
@@ -33,28 +38,47 @@ type OpenAIService struct {
 	client     *openai.Client
 	useMock    bool
 	mockThemes map[string][]models.VocabularyItem
-	language   string // Default language for vocabulary generation
+	cache      *CacheNamespace
+	prompts    *PromptLibrary
+	moderation *ModerationService
+	usage      *UsageTracker
+}
+
+// newOpenAIClient creates an OpenAI client that sends requests to baseURL, or
+// to the OpenAI API when it is empty
+func newOpenAIClient(apiKey, baseURL string) *openai.Client {
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+	return openai.NewClientWithConfig(config)
 }
 
-// NewOpenAIService creates a new OpenAI service
-func NewOpenAIService(apiKey string) *OpenAIService {
+// NewOpenAIService creates a new OpenAI service that asks for vocabulary with
+// the templates of prompts and caches it in cache, after it has been screened
+// by moderation. The tokens it uses are recorded by usage, which also decides
+// when the daily budget is spent. Requests go to baseURL, or to the OpenAI API
+// when it is empty.
+func NewOpenAIService(apiKey, baseURL string, cache *CacheNamespace, prompts *PromptLibrary, moderation *ModerationService, usage *UsageTracker) *OpenAIService {
 	service := &OpenAIService{
 		mockThemes: make(map[string][]models.VocabularyItem),
-		language:   "english", // Default language is English
+		cache:      cache,
+		prompts:    prompts,
+		moderation: moderation,
+		usage:      usage,
 	}
+	// Mock data is also served once the daily budget is spent
+	service.initMockData()
 
 	// Check if API key is provided
 	if apiKey == "" {
 		debugLogger.Printf("WARNING: No OpenAI API key provided, using mock implementation")
 		service.useMock = true
-		// Initialize mock data
-		service.initMockData()
 		return service
 	}
 
 	debugLogger.Printf("Initializing OpenAI service with API key: %s...", apiKey[:5]+"...")
-	client := openai.NewClient(apiKey)
-	service.client = client
+	service.client = newOpenAIClient(apiKey, baseURL)
 	return service
 }
 
@@ -62,126 +86,109 @@ func NewOpenAIService(apiKey string) *OpenAIService {
 func (s *OpenAIService) initMockData() {
 	// Mock data for park theme
 	s.mockThemes["park"] = []models.VocabularyItem{
-		{Word: "bench", Definition: "A long seat for two or more people", Example: "We sat on the bench in the park."},
-		{Word: "playground", Definition: "An area for children with swings, slides, etc.", Example: "The children had fun at the playground."},
-		{Word: "fountain", Definition: "An ornamental structure that sends water into the air", Example: "The fountain in the park was beautiful."},
-		{Word: "path", Definition: "A way or track for walking or cycling", Example: "We walked along the path through the park."},
-		{Word: "tree", Definition: "A tall plant with a wooden trunk and branches", Example: "The trees in the park provide shade in summer."},
-		{Word: "grass", Definition: "Plants with narrow green leaves that cover the ground", Example: "The grass in the park was freshly cut."},
-		{Word: "picnic", Definition: "An outdoor meal", Example: "We had a picnic in the park on Sunday."},
-		{Word: "jogger", Definition: "A person who runs at a steady speed for exercise", Example: "Joggers often use the park in the morning."},
-		{Word: "lake", Definition: "A large area of water surrounded by land", Example: "There is a small lake in the center of the park."},
-		{Word: "garden", Definition: "An area where flowers and plants are grown", Example: "The botanical garden in the park has rare flowers."},
+		{Word: "bench", Definition: "A long seat for two or more people", Example: "We sat on the bench in the park.", IPA: "/bɛntʃ/"},
+		{Word: "playground", Definition: "An area for children with swings, slides, etc.", Example: "The children had fun at the playground.", IPA: "/ˈpleɪɡraʊnd/"},
+		{Word: "fountain", Definition: "An ornamental structure that sends water into the air", Example: "The fountain in the park was beautiful.", IPA: "/ˈfaʊntɪn/"},
+		{Word: "path", Definition: "A way or track for walking or cycling", Example: "We walked along the path through the park.", IPA: "/pɑːθ/"},
+		{Word: "tree", Definition: "A tall plant with a wooden trunk and branches", Example: "The trees in the park provide shade in summer.", IPA: "/triː/"},
+		{Word: "grass", Definition: "Plants with narrow green leaves that cover the ground", Example: "The grass in the park was freshly cut.", IPA: "/ɡrɑːs/"},
+		{Word: "picnic", Definition: "An outdoor meal", Example: "We had a picnic in the park on Sunday.", IPA: "/ˈpɪknɪk/"},
+		{Word: "jogger", Definition: "A person who runs at a steady speed for exercise", Example: "Joggers often use the park in the morning.", IPA: "/ˈdʒɒɡə/"},
+		{Word: "lake", Definition: "A large area of water surrounded by land", Example: "There is a small lake in the center of the park.", IPA: "/leɪk/"},
+		{Word: "garden", Definition: "An area where flowers and plants are grown", Example: "The botanical garden in the park has rare flowers.", IPA: "/ˈɡɑːdn̩/"},
 	}
 
 	// Mock data for cafe theme
 	s.mockThemes["cafe"] = []models.VocabularyItem{
-		{Word: "coffee", Definition: "A hot drink made from roasted coffee beans", Example: "I ordered a coffee at the cafe."},
-		{Word: "barista", Definition: "A person who makes and serves coffee", Example: "The barista made a beautiful design in my latte."},
-		{Word: "menu", Definition: "A list of food and drinks available", Example: "The cafe has a varied menu with many options."},
-		{Word: "pastry", Definition: "A sweet baked food made with dough", Example: "The cafe sells delicious pastries."},
-		{Word: "table", Definition: "A piece of furniture with a flat top", Example: "We found a table by the window in the cafe."},
-		{Word: "espresso", Definition: "A strong coffee made by forcing steam through ground coffee beans", Example: "An espresso is perfect for a quick caffeine boost."},
-		{Word: "latte", Definition: "Coffee made with hot milk", Example: "She ordered a vanilla latte at the cafe."},
-		{Word: "wifi", Definition: "Wireless internet connection", Example: "The cafe offers free wifi to customers."},
-		{Word: "ambiance", Definition: "The character and atmosphere of a place", Example: "The cafe has a cozy ambiance with soft lighting."},
-		{Word: "tip", Definition: "Money given to a server as a reward for good service", Example: "I left a generous tip at the cafe."},
+		{Word: "coffee", Definition: "A hot drink made from roasted coffee beans", Example: "I ordered a coffee at the cafe.", IPA: "/ˈkɒfi/"},
+		{Word: "barista", Definition: "A person who makes and serves coffee", Example: "The barista made a beautiful design in my latte.", IPA: "/bəˈrɪstə/"},
+		{Word: "menu", Definition: "A list of food and drinks available", Example: "The cafe has a varied menu with many options.", IPA: "/ˈmɛnjuː/"},
+		{Word: "pastry", Definition: "A sweet baked food made with dough", Example: "The cafe sells delicious pastries.", IPA: "/ˈpeɪstri/"},
+		{Word: "table", Definition: "A piece of furniture with a flat top", Example: "We found a table by the window in the cafe.", IPA: "/ˈteɪbəl/"},
+		{Word: "espresso", Definition: "A strong coffee made by forcing steam through ground coffee beans", Example: "An espresso is perfect for a quick caffeine boost.", IPA: "/ɛˈsprɛsəʊ/"},
+		{Word: "latte", Definition: "Coffee made with hot milk", Example: "She ordered a vanilla latte at the cafe.", IPA: "/ˈlɑːteɪ/"},
+		{Word: "wifi", Definition: "Wireless internet connection", Example: "The cafe offers free wifi to customers.", IPA: "/ˈwaɪfaɪ/"},
+		{Word: "ambiance", Definition: "The character and atmosphere of a place", Example: "The cafe has a cozy ambiance with soft lighting.", IPA: "/ˈæmbiəns/"},
+		{Word: "tip", Definition: "Money given to a server as a reward for good service", Example: "I left a generous tip at the cafe.", IPA: "/tɪp/"},
 	}
 
 	// Mock data for park theme with Dutch translations
 	s.mockThemes["park_dutch"] = []models.VocabularyItem{
 		{
-			Word: "bench", Definition: "A long seat for two or more people", Example: "We sat on the bench in the park.",
-			DutchWord: "bank", DutchDefinition: "Een lange zitplaats voor twee of meer personen", DutchExample: "We zaten op de bank in het park.",
+			Word: "bench", Definition: "A long seat for two or more people", Example: "We sat on the bench in the park.", IPA: "/bɛntʃ/",
+			DutchWord: "bank", DutchDefinition: "Een lange zitplaats voor twee of meer personen", DutchExample: "We zaten op de bank in het park.", DutchIPA: "/bɑŋk/",
 		},
 		{
-			Word: "playground", Definition: "An area for children with swings, slides, etc.", Example: "The children had fun at the playground.",
-			DutchWord: "speeltuin", DutchDefinition: "Een gebied voor kinderen met schommels, glijbanen, etc.", DutchExample: "De kinderen hadden plezier in de speeltuin.",
+			Word: "playground", Definition: "An area for children with swings, slides, etc.", Example: "The children had fun at the playground.", IPA: "/ˈpleɪɡraʊnd/",
+			DutchWord: "speeltuin", DutchDefinition: "Een gebied voor kinderen met schommels, glijbanen, etc.", DutchExample: "De kinderen hadden plezier in de speeltuin.", DutchIPA: "/ˈspeːltœyn/",
 		},
 		{
-			Word: "fountain", Definition: "An ornamental structure that sends water into the air", Example: "The fountain in the park was beautiful.",
-			DutchWord: "fontein", DutchDefinition: "Een sierelement dat water in de lucht spuit", DutchExample: "De fontein in het park was prachtig.",
+			Word: "fountain", Definition: "An ornamental structure that sends water into the air", Example: "The fountain in the park was beautiful.", IPA: "/ˈfaʊntɪn/",
+			DutchWord: "fontein", DutchDefinition: "Een sierelement dat water in de lucht spuit", DutchExample: "De fontein in het park was prachtig.", DutchIPA: "/fɔnˈtɛin/",
 		},
 		{
-			Word: "path", Definition: "A way or track for walking or cycling", Example: "We walked along the path through the park.",
-			DutchWord: "pad", DutchDefinition: "Een weg of spoor om te wandelen of fietsen", DutchExample: "We liepen over het pad door het park.",
+			Word: "path", Definition: "A way or track for walking or cycling", Example: "We walked along the path through the park.", IPA: "/pɑːθ/",
+			DutchWord: "pad", DutchDefinition: "Een weg of spoor om te wandelen of fietsen", DutchExample: "We liepen over het pad door het park.", DutchIPA: "/pɑt/",
 		},
 		{
-			Word: "tree", Definition: "A tall plant with a wooden trunk and branches", Example: "The trees in the park provide shade in summer.",
-			DutchWord: "boom", DutchDefinition: "Een hoge plant met een houten stam en takken", DutchExample: "De bomen in het park geven schaduw in de zomer.",
+			Word: "tree", Definition: "A tall plant with a wooden trunk and branches", Example: "The trees in the park provide shade in summer.", IPA: "/triː/",
+			DutchWord: "boom", DutchDefinition: "Een hoge plant met een houten stam en takken", DutchExample: "De bomen in het park geven schaduw in de zomer.", DutchIPA: "/boːm/",
 		},
 	}
 
 	// Mock data for cafe theme with Dutch translations
 	s.mockThemes["cafe_dutch"] = []models.VocabularyItem{
 		{
-			Word: "coffee", Definition: "A hot drink made from roasted coffee beans", Example: "I ordered a coffee at the cafe.",
-			DutchWord: "koffie", DutchDefinition: "Een warme drank gemaakt van gebrande koffiebonen", DutchExample: "Ik bestelde een koffie in het café.",
+			Word: "coffee", Definition: "A hot drink made from roasted coffee beans", Example: "I ordered a coffee at the cafe.", IPA: "/ˈkɒfi/",
+			DutchWord: "koffie", DutchDefinition: "Een warme drank gemaakt van gebrande koffiebonen", DutchExample: "Ik bestelde een koffie in het café.", DutchIPA: "/ˈkɔfi/",
 		},
 		{
-			Word: "barista", Definition: "A person who makes and serves coffee", Example: "The barista made a beautiful design in my latte.",
-			DutchWord: "barista", DutchDefinition: "Een persoon die koffie maakt en serveert", DutchExample: "De barista maakte een mooie tekening in mijn latte.",
+			Word: "barista", Definition: "A person who makes and serves coffee", Example: "The barista made a beautiful design in my latte.", IPA: "/bəˈrɪstə/",
+			DutchWord: "barista", DutchDefinition: "Een persoon die koffie maakt en serveert", DutchExample: "De barista maakte een mooie tekening in mijn latte.", DutchIPA: "/baːˈrɪstaː/",
 		},
 		{
-			Word: "menu", Definition: "A list of food and drinks available", Example: "The cafe has a varied menu with many options.",
-			DutchWord: "menu", DutchDefinition: "Een lijst met beschikbaar eten en drinken", DutchExample: "Het café heeft een gevarieerd menu met veel opties.",
+			Word: "menu", Definition: "A list of food and drinks available", Example: "The cafe has a varied menu with many options.", IPA: "/ˈmɛnjuː/",
+			DutchWord: "menu", DutchDefinition: "Een lijst met beschikbaar eten en drinken", DutchExample: "Het café heeft een gevarieerd menu met veel opties.", DutchIPA: "/məˈny/",
 		},
 		{
-			Word: "pastry", Definition: "A sweet baked food made with dough", Example: "The cafe sells delicious pastries.",
-			DutchWord: "gebak", DutchDefinition: "Een zoet gebakken voedsel gemaakt van deeg", DutchExample: "Het café verkoopt heerlijk gebak.",
+			Word: "pastry", Definition: "A sweet baked food made with dough", Example: "The cafe sells delicious pastries.", IPA: "/ˈpeɪstri/",
+			DutchWord: "gebak", DutchDefinition: "Een zoet gebakken voedsel gemaakt van deeg", DutchExample: "Het café verkoopt heerlijk gebak.", DutchIPA: "/ɣəˈbɑk/",
 		},
 		{
-			Word: "table", Definition: "A piece of furniture with a flat top", Example: "We found a table by the window in the cafe.",
-			DutchWord: "tafel", DutchDefinition: "Een meubelstuk met een plat oppervlak", DutchExample: "We vonden een tafel bij het raam in het café.",
+			Word: "table", Definition: "A piece of furniture with a flat top", Example: "We found a table by the window in the cafe.", IPA: "/ˈteɪbəl/",
+			DutchWord: "tafel", DutchDefinition: "Een meubelstuk met een plat oppervlak", DutchExample: "We vonden een tafel bij het raam in het café.", DutchIPA: "/ˈtaːfəl/",
 		},
 	}
 
 	// Add more mock themes as needed
 }
 
-// SetLanguage sets the language for vocabulary generation
-func (s *OpenAIService) SetLanguage(language string) {
-	s.language = strings.ToLower(language)
-	debugLogger.Printf("Language set to: %s", s.language)
-}
+// generateWithinBudget generates vocabulary unless the daily budget is spent.
+// Then it returns ErrBudgetExceeded, or mock vocabulary in the mock over
+// budget mode. It reports whether the vocabulary may be cached, which mock
+// vocabulary served in place of generated vocabulary may not.
+func (s *OpenAIService) generateWithinBudget(theme string, count int, language string, prompt Prompt) ([]models.VocabularyItem, bool, error) {
+	if s.useMock || !s.usage.OverBudget() {
+		vocabulary, err := s.generateVocabulary(theme, count, language, prompt)
+		return vocabulary, err == nil, err
+	}
 
-// GetLanguage returns the current language setting
-func (s *OpenAIService) GetLanguage() string {
-	return s.language
+	if s.usage.OverBudgetMode() != OverBudgetMock {
+		debugLogger.Printf("Daily budget exceeded, not generating vocabulary for theme: %s", theme)
+		return nil, false, s.usage.budgetError()
+	}
+	debugLogger.Printf("Daily budget exceeded, serving mock vocabulary for theme: %s", theme)
+	vocabulary, err := s.mockVocabulary(theme, count, language)
+	return vocabulary, false, err
 }
 
-// GenerateVocabulary generates vocabulary words for a given theme
-func (s *OpenAIService) GenerateVocabulary(theme string, count int) ([]models.VocabularyItem, error) {
-	debugLogger.Printf("Generating vocabulary for theme: %s, count: %d, language: %s", theme, count, s.language)
+// generateVocabulary generates vocabulary words for a given theme and language with a rendered prompt
+func (s *OpenAIService) generateVocabulary(theme string, count int, language string, prompt Prompt) ([]models.VocabularyItem, error) {
+	debugLogger.Printf("Generating vocabulary for theme: %s, count: %d, language: %s", theme, count, language)
 
 	// If using mock implementation, return mock data
 	if s.useMock {
-		debugLogger.Printf("Using mock implementation for theme: %s", theme)
-
-		mockThemeKey := theme
-		// If language is set to Dutch, try to use the Dutch version of the theme
-		if s.language == "dutch" {
-			dutchThemeKey := theme + "_dutch"
-			if _, ok := s.mockThemes[dutchThemeKey]; ok {
-				mockThemeKey = dutchThemeKey
-				debugLogger.Printf("Using Dutch mock data for theme: %s", mockThemeKey)
-			} else {
-				debugLogger.Printf("Dutch mock data not available for theme: %s, falling back to English", theme)
-			}
-		}
-
-		mockData, ok := s.mockThemes[mockThemeKey]
-		if !ok {
-			return nil, fmt.Errorf("mock data not available for theme: %s", theme)
-		}
-
-		// Return the requested number of items, or all items if count > available items
-		resultCount := count
-		if resultCount > len(mockData) {
-			resultCount = len(mockData)
-		}
-
-		return mockData[:resultCount], nil
+		return s.mockVocabulary(theme, count, language)
 	}
 
 	// Check if client is initialized
@@ -189,61 +196,15 @@ func (s *OpenAIService) GenerateVocabulary(theme string, count int) ([]models.Vo
 		return nil, fmt.Errorf("OpenAI client not initialized")
 	}
 
-	var prompt string
-	if s.language == "dutch" {
-		prompt = fmt.Sprintf(`Generate %d vocabulary words related to the theme "%s" in both English and Dutch.
-Each word should have:
-- English word
-- English definition
-- Example sentence in English
-- Dutch translation of the word
-- Dutch definition
-- Example sentence in Dutch
-
-Format your response as a JSON array of objects, where each object contains:
-- "word": the English vocabulary word
-- "definition": a brief English definition of the word
-- "example": a simple example sentence using the word in English
-- "dutch_word": the Dutch translation of the word
-- "dutch_definition": a brief Dutch definition of the word
-- "dutch_example": a simple example sentence using the word in Dutch
-
-Only provide the JSON output, no additional text.`, count, theme)
-	} else {
-		prompt = fmt.Sprintf(`Generate %d vocabulary words related to the theme "%s". 
-Each word should have a definition and a simple example sentence.
-Format your response as a JSON array of objects, where each object contains:
-- "word": the vocabulary word
-- "definition": a brief definition of the word
-- "example": a simple example sentence using the word
-
-Only provide the JSON output, no additional text.`, count, theme)
-	}
-
-	debugLogger.Printf("Using prompt: %s", prompt)
-
-	resp, err := s.client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: openai.GPT3Dot5Turbo,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: "You are a language learning tool that generates vocabulary words with definitions and examples.",
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-			Temperature: 0.7,
-		},
-	)
+	request := vocabularyRequest(prompt)
+	debugLogger.Printf("Using prompt %s: %s", prompt.Version, prompt.User)
 
+	resp, err := s.client.CreateChatCompletion(context.Background(), request)
 	if err != nil {
 		debugLogger.Printf("Error generating vocabulary: %v", err)
 		return nil, fmt.Errorf("error generating vocabulary: %w", err)
 	}
+	s.usage.Record(usageModel(resp.Model, request.Model), theme, language, resp.Usage)
 
 	// Log the raw response for debugging
 	rawResponse := resp.Choices[0].Message.Content
@@ -266,35 +227,156 @@ Only provide the JSON output, no additional text.`, count, theme)
 		return nil, fmt.Errorf("error parsing vocabulary response: %w", err)
 	}
 
+	// Drop transcriptions that are not valid IPA
+	sanitizeIPA(vocabulary)
+
 	debugLogger.Printf("Successfully parsed %d vocabulary items", len(vocabulary))
 	return vocabulary, nil
 }
 
-// Cache to store previously generated vocabulary
-var vocabularyCache = make(map[string][]models.VocabularyItem)
+// usageModel returns the model a completion was generated with, as reported
+// in the response, or the requested model when the response does not say
+func usageModel(responseModel, requestModel string) string {
+	if responseModel != "" {
+		return responseModel
+	}
+	return requestModel
+}
 
-// GetVocabularyWithCache gets vocabulary for a theme using caching
-func (s *OpenAIService) GetVocabularyWithCache(theme string, count int) ([]models.VocabularyItem, error) {
-	cacheKey := fmt.Sprintf("%s_%d_%s", theme, count, s.language)
-	debugLogger.Printf("Getting vocabulary for cache key: %s", cacheKey)
+// mockVocabulary returns mock vocabulary for a theme and language
+func (s *OpenAIService) mockVocabulary(theme string, count int, language string) ([]models.VocabularyItem, error) {
+	debugLogger.Printf("Using mock implementation for theme: %s", theme)
+
+	mockThemeKey := theme
+	// If language is set to Dutch, try to use the Dutch version of the theme
+	if language == "dutch" {
+		dutchThemeKey := theme + "_dutch"
+		if _, ok := s.mockThemes[dutchThemeKey]; ok {
+			mockThemeKey = dutchThemeKey
+			debugLogger.Printf("Using Dutch mock data for theme: %s", mockThemeKey)
+		} else {
+			debugLogger.Printf("Dutch mock data not available for theme: %s, falling back to English", theme)
+		}
+	}
+
+	mockData, ok := s.mockThemes[mockThemeKey]
+	if !ok {
+		return nil, fmt.Errorf("mock data not available for theme: %s", theme)
+	}
+
+	// Return the requested number of items, or all items if count > available items
+	resultCount := count
+	if resultCount > len(mockData) {
+		resultCount = len(mockData)
+	}
+
+	return mockData[:resultCount], nil
+}
+
+// vocabularyPromptData is what the vocabulary templates are rendered with
+type vocabularyPromptData struct {
+	Theme    string
+	Count    int
+	Language string
+}
+
+// vocabularyPrompt renders the prompt that asks for vocabulary in a language
+func (s *OpenAIService) vocabularyPrompt(theme string, count int, language string) (Prompt, error) {
+	return s.prompts.Render("vocabulary", language, vocabularyPromptData{Theme: theme, Count: count, Language: language})
+}
+
+// model returns the model vocabulary is generated with, mock vocabulary is
+// cached separately so it is not served once an API key is configured
+func (s *OpenAIService) model() string {
+	if s.useMock || s.client == nil {
+		return "mock"
+	}
+	return openai.GPT3Dot5Turbo
+}
+
+// vocabularyCacheKey returns the cache key of the vocabulary for a theme, count and language
+func (s *OpenAIService) vocabularyCacheKey(theme string, count int, language string) []string {
+	return []string{s.model(), theme, strconv.Itoa(count), language}
+}
+
+// vocabularyCacheEntry is cached vocabulary with the version of the prompt it
+// was generated with. Entries of another version are stale.
+type vocabularyCacheEntry struct {
+	PromptVersion string                  `json:"prompt_version"`
+	Vocabulary    []models.VocabularyItem `json:"vocabulary"`
+}
+
+// cachedVocabulary returns vocabulary cached with the given prompt version
+func (s *OpenAIService) cachedVocabulary(cacheKey []string, promptVersion string) ([]models.VocabularyItem, bool) {
+	var entry vocabularyCacheEntry
+	fresh := func() bool {
+		if entry.PromptVersion != promptVersion {
+			debugLogger.Printf("Cached vocabulary for key %v was generated with prompt %q, not %q", cacheKey, entry.PromptVersion, promptVersion)
+			return false
+		}
+		return true
+	}
+	if !s.cache.GetValid(&entry, fresh, cacheKey...) {
+		return nil, false
+	}
+	return entry.Vocabulary, true
+}
+
+// cacheVocabulary stores vocabulary generated with a prompt version in the cache
+func (s *OpenAIService) cacheVocabulary(cacheKey []string, promptVersion string, vocabulary []models.VocabularyItem) {
+	entry := vocabularyCacheEntry{PromptVersion: promptVersion, Vocabulary: vocabulary}
+	if err := s.cache.Set(entry, cacheKey...); err != nil {
+		debugLogger.Printf("Error caching vocabulary: %v", err)
+	}
+}
+
+// IsVocabularyCached reports whether vocabulary for a theme, count and language
+// is cached, generated with the current version of its prompt
+func (s *OpenAIService) IsVocabularyCached(theme string, count int, language string) bool {
+	language = strings.ToLower(language)
+	version, err := s.prompts.Version("vocabulary", language)
+	if err != nil {
+		return false
+	}
+	var entry vocabularyCacheEntry
+	return s.cache.Peek(&entry, s.vocabularyCacheKey(theme, count, language)...) && entry.PromptVersion == version
+}
+
+// GetVocabularyForLanguage gets vocabulary for a theme in a language using caching
+func (s *OpenAIService) GetVocabularyForLanguage(theme string, count int, language string) ([]models.VocabularyItem, error) {
+	language = strings.ToLower(language)
+	cacheKey := s.vocabularyCacheKey(theme, count, language)
+	debugLogger.Printf("Getting vocabulary for cache key: %v", cacheKey)
+
+	// Vocabulary generated with an older prompt is generated again
+	prompt, err := s.vocabularyPrompt(theme, count, language)
+	if err != nil {
+		return nil, err
+	}
 
 	// Check if we have cached results
-	if cachedVocab, ok := vocabularyCache[cacheKey]; ok {
-		debugLogger.Printf("Cache hit for key: %s, returning %d vocabulary items", cacheKey, len(cachedVocab))
+	if cachedVocab, ok := s.cachedVocabulary(cacheKey, prompt.Version); ok {
+		debugLogger.Printf("Cache hit for key: %v, returning %d vocabulary items", cacheKey, len(cachedVocab))
 		return cachedVocab, nil
 	}
 
-	debugLogger.Printf("Cache miss for key: %s, generating new vocabulary", cacheKey)
+	debugLogger.Printf("Cache miss for key: %v, generating new vocabulary", cacheKey)
 	// Generate new vocabulary
-	vocabulary, err := s.GenerateVocabulary(theme, count)
+	vocabulary, cacheable, err := s.generateWithinBudget(theme, count, language, prompt)
 	if err != nil {
 		debugLogger.Printf("Error generating vocabulary: %v", err)
 		return nil, err
 	}
+	if !cacheable {
+		return vocabulary, nil
+	}
+
+	// Drop words that are not suitable for children
+	vocabulary = s.moderation.FilterVocabulary(context.Background(), vocabulary)
 
 	// Cache the results
-	vocabularyCache[cacheKey] = vocabulary
-	debugLogger.Printf("Cached %d vocabulary items for key: %s", len(vocabulary), cacheKey)
+	s.cacheVocabulary(cacheKey, prompt.Version, vocabulary)
+	debugLogger.Printf("Cached %d vocabulary items for key: %v", len(vocabulary), cacheKey)
 
 	return vocabulary, nil
 }
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+const (
+	// defaultPexelsBaseURL is the Pexels API used when no other base URL is configured
+	defaultPexelsBaseURL = "https://api.pexels.com/v1"
+	// pexelsRateLimitWindow is how often Pexels refills its hourly quota, it
+	// reports when the monthly quota is refilled
+	pexelsRateLimitWindow = time.Hour
+	// pexelsRandomCandidates is the number of search results a random image is picked from
+	pexelsRandomCandidates = 15
+)
+
+// pexelsPhoto is a photo as returned by the Pexels API
+type pexelsPhoto struct {
+	ID              int    `json:"id"`
+	Width           int    `json:"width"`
+	Height          int    `json:"height"`
+	URL             string `json:"url"`
+	Photographer    string `json:"photographer"`
+	PhotographerURL string `json:"photographer_url"`
+	AvgColor        string `json:"avg_color"`
+	Alt             string `json:"alt"`
+	Src             struct {
+		Original string `json:"original"`
+	} `json:"src"`
+}
+
+// toImage maps a Pexels photo to our model
+func (p *pexelsPhoto) toImage() models.Image {
+	return models.Image{
+		ID: ProviderImageID("pexels", strconv.Itoa(p.ID)),
+		// Pexels resizes through query parameters on the original
+		URL:               p.Src.Original + "?auto=compress&cs=tinysrgb&fit=crop&w=800&h=600",
+		DownloadURL:       p.Src.Original,
+		Description:       p.Alt,
+		Width:             p.Width,
+		Height:            p.Height,
+		Color:             p.AvgColor,
+		Provider:          "pexels",
+		SourceURL:         p.URL,
+		Photographer:      p.Photographer,
+		PhotographerURL:   p.PhotographerURL,
+		AttributionString: fmt.Sprintf("Photo by %s on Pexels", p.Photographer),
+	}
+}
+
+// PexelsService finds images with the Pexels API
+type PexelsService struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+	// Images whose description contains a blocked term are not shown
+	blocklist *Blocklist
+
+	// Quota reported by the rate limit headers
+	limits *rateLimit
+}
+
+// NewPexelsService creates a new Pexels service that leaves out images
+// matching the blocklist. It uses the public API when baseURL is empty.
+func NewPexelsService(apiKey, baseURL string, blocklist *Blocklist) *PexelsService {
+	return &PexelsService{
+		apiKey:    apiKey,
+		baseURL:   apiBaseURL(baseURL, defaultPexelsBaseURL),
+		client:    &http.Client{},
+		blocklist: blocklist,
+		limits:    newRateLimit("pexels", pexelsRateLimitWindow),
+	}
+}
+
+// Name returns the provider name
+func (s *PexelsService) Name() string {
+	return "pexels"
+}
+
+// Configured reports whether an API key is set
+func (s *PexelsService) Configured() bool {
+	return s.apiKey != ""
+}
+
+// RateLimitRemaining returns how many requests are left in the current rate limit
+// window, as reported by the last response. It returns false before the first response.
+func (s *PexelsService) RateLimitRemaining() (int, bool) {
+	return s.limits.remainingRequests()
+}
+
+// rateLimits returns the tracker of the Pexels quota
+func (s *PexelsService) rateLimits() *rateLimit {
+	return s.limits
+}
+
+// get sends an authorized request to the Pexels API and decodes the response into v
+func (s *PexelsService) get(path string, query url.Values, v any) error {
+	endpoint := s.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", s.apiKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	s.limits.update(resp.Header)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests:
+		return s.limits.exhausted(resp.Header)
+	case http.StatusNotFound:
+		return fmt.Errorf("pexels: %w", ErrImageNotFound)
+	default:
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// search returns the photos found for a query that are suitable for children
+func (s *PexelsService) search(query string, count int) ([]pexelsPhoto, error) {
+	var response struct {
+		Photos []pexelsPhoto `json:"photos"`
+	}
+	err := s.get("/search", url.Values{
+		"query":       {query},
+		"per_page":    {strconv.Itoa(count)},
+		"orientation": {"landscape"},
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	photos := make([]pexelsPhoto, 0, len(response.Photos))
+	for _, photo := range response.Photos {
+		if s.suitable(&photo) {
+			photos = append(photos, photo)
+		}
+	}
+	return photos, nil
+}
+
+// suitable reports whether a photo may be shown to children, the reason for
+// leaving it out is logged
+func (s *PexelsService) suitable(p *pexelsPhoto) bool {
+	if term, ok := s.blocklist.Match(p.Alt); ok {
+		debugLogger.Printf("Moderation rejected image pexels:%d: contains blocked term %q", p.ID, term)
+		return false
+	}
+	return true
+}
+
+// SearchImages searches for images based on a query
+func (s *PexelsService) SearchImages(query string, count int) ([]models.Image, error) {
+	photos, err := s.search(query, count)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]models.Image, 0, len(photos))
+	for _, photo := range photos {
+		images = append(images, photo.toImage())
+	}
+	return images, nil
+}
+
+// GetRandomImage picks a random image from the search results for a query,
+// Pexels has no random endpoint
+func (s *PexelsService) GetRandomImage(query string) (*models.Image, error) {
+	photos, err := s.search(query, pexelsRandomCandidates)
+	if err != nil {
+		return nil, err
+	}
+	if len(photos) == 0 {
+		return nil, fmt.Errorf("no pexels image for %q: %w", query, ErrImageNotFound)
+	}
+
+	image := photos[rand.Intn(len(photos))].toImage()
+	return &image, nil
+}
+
+// getPhoto fetches a photo by its ID. Photos that are not suitable for
+// children are not found, whoever asks for them.
+func (s *PexelsService) getPhoto(id string) (*pexelsPhoto, error) {
+	_, pexelsID := SplitImageID(id)
+	if _, err := strconv.Atoi(pexelsID); err != nil {
+		return nil, fmt.Errorf("invalid pexels id %q: %w", pexelsID, ErrImageNotFound)
+	}
+
+	var photo pexelsPhoto
+	if err := s.get("/photos/"+pexelsID, nil, &photo); err != nil {
+		return nil, err
+	}
+	if !s.suitable(&photo) {
+		return nil, fmt.Errorf("pexels photo %s: %w", pexelsID, ErrImageNotFound)
+	}
+	return &photo, nil
+}
+
+// GetImage gets a single image by its ID
+func (s *PexelsService) GetImage(id string) (*models.Image, error) {
+	photo, err := s.getPhoto(id)
+	if err != nil {
+		return nil, err
+	}
+
+	image := photo.toImage()
+	return &image, nil
+}
+
+// ImageSourceURL returns the URL of a JPEG of the image that is at most maxWidth pixels wide
+func (s *PexelsService) ImageSourceURL(id string, maxWidth int) (string, error) {
+	photo, err := s.getPhoto(id)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s?auto=compress&cs=tinysrgb&fm=jpg&w=%d", photo.Src.Original, maxWidth), nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func newFixturePexelsService(fixture string) (*PexelsService, *fixtureTransport) {
+	transport := &fixtureTransport{fixture: fixture}
+	s := NewPexelsService("test-key", "", NewBlocklist(nil))
+	s.client = &http.Client{Transport: transport}
+	return s, transport
+}
+
+func TestPexelsSearchImages(t *testing.T) {
+	s, transport := newFixturePexelsService("pexels_search.json")
+	transport.header = http.Header{"X-Ratelimit-Remaining": {"19999"}}
+
+	images, err := s.SearchImages("apple", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := transport.lastRequest(t)
+	if req.URL.Path != "/v1/search" || req.URL.Query().Get("query") != "apple" {
+		t.Errorf("requested %s", req.URL)
+	}
+	if got := req.Header.Get("Authorization"); got != "test-key" {
+		t.Errorf("Authorization = %q, want the API key", got)
+	}
+
+	// The photo of a drunk man is left out
+	if len(images) != 2 {
+		t.Fatalf("got %d images, want 2", len(images))
+	}
+	image := images[0]
+	if image.ID != "pexels:1132047" || image.Provider != "pexels" {
+		t.Errorf("got ID %q from %q", image.ID, image.Provider)
+	}
+	if image.AttributionString != "Photo by Mali Maeder on Pexels" {
+		t.Errorf("attribution = %q", image.AttributionString)
+	}
+	if image.Description != "Red apples on a wooden table" || image.Color != "#8C5A3C" {
+		t.Errorf("description %q, color %q", image.Description, image.Color)
+	}
+	if image.SourceURL != "https://www.pexels.com/photo/red-apples-on-a-wooden-table-1132047/" {
+		t.Errorf("source URL = %q", image.SourceURL)
+	}
+	if images[1].ID != "pexels:672101" {
+		t.Errorf("second image %q, want pexels:672101", images[1].ID)
+	}
+
+	if remaining, ok := s.RateLimitRemaining(); !ok || remaining != 19999 {
+		t.Errorf("rate limit remaining = %d, %v, want 19999", remaining, ok)
+	}
+}
+
+func TestPexelsGetImage(t *testing.T) {
+	s, transport := newFixturePexelsService("pexels_photo.json")
+
+	image, err := s.GetImage("pexels:1132047")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req := transport.lastRequest(t); req.URL.Path != "/v1/photos/1132047" {
+		t.Errorf("requested %s", req.URL.Path)
+	}
+	if image.Photographer != "Mali Maeder" || image.Width != 5184 {
+		t.Errorf("got %+v", image)
+	}
+
+	url, err := s.ImageSourceURL("pexels:1132047", 1600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://images.pexels.com/photos/1132047/pexels-photo-1132047.jpeg?auto=compress&cs=tinysrgb&fm=jpg&w=1600"; url != want {
+		t.Errorf("source URL = %s, want %s", url, want)
+	}
+
+	if _, err := s.GetImage("pexels:abc"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("err = %v, want ErrImageNotFound for a malformed ID", err)
+	}
+}
+
+func TestPexelsErrors(t *testing.T) {
+	s, transport := newFixturePexelsService("pexels_photo.json")
+
+	transport.status = http.StatusTooManyRequests
+	if _, err := s.SearchImages("apple", 3); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("err = %v, want ErrRateLimited", err)
+	}
+
+	transport.status = http.StatusNotFound
+	if _, err := s.GetImage("pexels:1"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("err = %v, want ErrImageNotFound", err)
+	}
+}
+
+func TestPexelsGetImageLeavesOutBlockedPhotos(t *testing.T) {
+	s, _ := newFixturePexelsService("pexels_photo.json")
+	s.blocklist = NewBlocklist([]string{"wooden table"})
+
+	if _, err := s.GetImage("pexels:1132047"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("err = %v, want ErrImageNotFound", err)
+	}
+	if _, err := s.ImageSourceURL("pexels:1132047", 1600); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("err = %v, want ErrImageNotFound for the source URL", err)
+	}
+}
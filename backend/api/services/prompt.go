@@ -0,0 +1,299 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// defaultPromptFS holds the prompt templates that are built into the binary
+//
+//go:embed prompts
+var defaultPromptFS embed.FS
+
+// defaultPromptLanguage is the language of templates that serve every language of a task
+const defaultPromptLanguage = "default"
+
+// ErrUnknownPrompt is returned when there is no template for a task
+var ErrUnknownPrompt = errors.New("unknown prompt")
+
+// promptFilePattern matches template files such as "vocabulary/dutch.v2.tmpl"
+var promptFilePattern = regexp.MustCompile(`^([a-z_]+)/([a-z_]+)\.v([0-9]+)\.tmpl$`)
+
+// Prompt is a rendered prompt
+type Prompt struct {
+	System string
+	User   string
+	// Version identifies the template and its content, such as
+	// "vocabulary/dutch.v2:1a2b3c4d". It changes whenever the template does.
+	Version string
+}
+
+// promptTemplate is a parsed template file
+type promptTemplate struct {
+	template *template.Template
+	version  int
+	hash     string
+	override bool // loaded from the prompt directory
+}
+
+// versionOf returns the version of the template stored under key
+func (t promptTemplate) versionOf(key string) string {
+	return fmt.Sprintf("%s.v%d:%s", key, t.version, t.hash)
+}
+
+// PromptLibrary renders the prompts sent to OpenAI from text/template files
+// named <task>/<language>.v<version>.tmpl, where "default" as the language
+// serves every language without its own template. The newest version of every
+// template is used. Templates in the prompt directory are added to the
+// built-in ones and take precedence at the same version, and they are reloaded
+// when they change. A nil PromptLibrary renders the built-in templates.
+type PromptLibrary struct {
+	dir       string
+	templates map[string]promptTemplate // by task and language, "vocabulary/dutch"
+	signature string                    // names, sizes and modification times of the directory's files
+	mu        sync.RWMutex
+
+	stop      chan struct{}
+	watcher   sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewPromptLibrary loads the built-in templates and those in dir, which may be empty
+func NewPromptLibrary(dir string) (*PromptLibrary, error) {
+	l := &PromptLibrary{dir: dir, stop: make(chan struct{})}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// builtinPrompts is the library of built-in templates used by a nil PromptLibrary
+var builtinPrompts = sync.OnceValue(func() *PromptLibrary {
+	l, err := NewPromptLibrary("")
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in prompt template: %v", err))
+	}
+	return l
+})
+
+// load parses all templates and replaces the current ones. The current ones
+// are kept when a template cannot be parsed.
+func (l *PromptLibrary) load() error {
+	templates := make(map[string]promptTemplate)
+
+	builtin, err := fs.Sub(defaultPromptFS, "prompts")
+	if err != nil {
+		return err
+	}
+	if err := loadPromptTemplates(templates, builtin, false); err != nil {
+		return err
+	}
+
+	signature := ""
+	if l.dir != "" {
+		if signature, err = promptDirSignature(l.dir); err != nil {
+			return err
+		}
+		if err := loadPromptTemplates(templates, os.DirFS(l.dir), true); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	l.templates = templates
+	l.signature = signature
+	l.mu.Unlock()
+	return nil
+}
+
+// loadPromptTemplates parses the template files in fsys into templates,
+// keeping the newest version of every template
+func loadPromptTemplates(templates map[string]promptTemplate, fsys fs.FS, override bool) error {
+	return fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		match := promptFilePattern.FindStringSubmatch(name)
+		if match == nil {
+			if path.Ext(name) == ".tmpl" {
+				debugLogger.Printf("Ignoring prompt template %s, expected <task>/<language>.v<version>.tmpl", name)
+			}
+			return nil
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		parsed, err := template.New(name).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("error parsing prompt template: %w", err)
+		}
+
+		version, _ := strconv.Atoi(match[3])
+		sum := sha256.Sum256(content)
+		key := match[1] + "/" + match[2]
+		current, ok := templates[key]
+		if ok && (version < current.version || (version == current.version && !override)) {
+			return nil
+		}
+		templates[key] = promptTemplate{
+			template: parsed,
+			version:  version,
+			hash:     hex.EncodeToString(sum[:4]),
+			override: override,
+		}
+		return nil
+	})
+}
+
+// promptDirSignature summarizes the files in dir, so changes can be detected
+// without parsing them. A missing directory has an empty signature.
+func promptDirSignature(dir string) (string, error) {
+	var files []string
+	err := fs.WalkDir(os.DirFS(dir), ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, fmt.Sprintf("%s:%d:%d", name, info.Size(), info.ModTime().UnixNano()))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading prompt directory: %w", err)
+	}
+	sort.Strings(files)
+	return strings.Join(files, "\n"), nil
+}
+
+// Watch reloads the templates in the prompt directory every interval when
+// they have changed, until Close is called
+func (l *PromptLibrary) Watch(interval time.Duration) {
+	if l.dir == "" || interval <= 0 {
+		return
+	}
+
+	l.watcher.Add(1)
+	go func() {
+		defer l.watcher.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				l.reload()
+			case <-l.stop:
+				return
+			}
+		}
+	}()
+}
+
+// reload loads the templates again when the prompt directory has changed
+func (l *PromptLibrary) reload() {
+	signature, err := promptDirSignature(l.dir)
+	if err != nil {
+		debugLogger.Printf("Error checking prompt templates: %v", err)
+		return
+	}
+
+	l.mu.RLock()
+	changed := signature != l.signature
+	l.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	if err := l.load(); err != nil {
+		debugLogger.Printf("Error reloading prompt templates, keeping the current ones: %v", err)
+		// Do not retry until the directory changes again
+		l.mu.Lock()
+		l.signature = signature
+		l.mu.Unlock()
+		return
+	}
+	debugLogger.Printf("Reloaded prompt templates from %s", l.dir)
+}
+
+// Close stops watching the prompt directory
+func (l *PromptLibrary) Close() {
+	if l == nil {
+		return
+	}
+	l.closeOnce.Do(func() {
+		close(l.stop)
+	})
+	l.watcher.Wait()
+}
+
+// lookup returns the template for a task in a language, or the default one of the task
+func (l *PromptLibrary) lookup(task, language string) (string, promptTemplate, error) {
+	if l == nil {
+		l = builtinPrompts()
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, lang := range []string{strings.ToLower(language), defaultPromptLanguage} {
+		key := task + "/" + lang
+		if t, ok := l.templates[key]; ok {
+			return key, t, nil
+		}
+	}
+	return "", promptTemplate{}, fmt.Errorf("%w: no template for %s in %s", ErrUnknownPrompt, task, language)
+}
+
+// Render renders the prompt for a task in a language with data
+func (l *PromptLibrary) Render(task, language string, data any) (Prompt, error) {
+	key, t, err := l.lookup(task, language)
+	if err != nil {
+		return Prompt{}, err
+	}
+
+	var user, system bytes.Buffer
+	if err := t.template.Execute(&user, data); err != nil {
+		return Prompt{}, fmt.Errorf("error rendering prompt %s: %w", key, err)
+	}
+	if t.template.Lookup("system") != nil {
+		if err := t.template.ExecuteTemplate(&system, "system", data); err != nil {
+			return Prompt{}, fmt.Errorf("error rendering system prompt %s: %w", key, err)
+		}
+	}
+
+	return Prompt{
+		System:  strings.TrimSpace(system.String()),
+		User:    strings.TrimSpace(user.String()),
+		Version: t.versionOf(key),
+	}, nil
+}
+
+// Version returns the version of the template a task in a language is rendered with
+func (l *PromptLibrary) Version(task, language string) (string, error) {
+	key, t, err := l.lookup(task, language)
+	if err != nil {
+		return "", err
+	}
+	return t.versionOf(key), nil
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// writePrompt writes a template file into a prompt directory
+func writePrompt(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuiltinPrompts(t *testing.T) {
+	var l *PromptLibrary
+
+	english, err := l.Render("vocabulary", "English", vocabularyPromptData{Theme: "park", Count: 3, Language: "english"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(english.User, `Generate 3 vocabulary words related to the theme "park".`) {
+		t.Errorf("user prompt = %q", english.User)
+	}
+	if english.System != "You are a language learning tool that generates vocabulary words with definitions and examples." {
+		t.Errorf("system prompt = %q", english.System)
+	}
+	if !strings.HasPrefix(english.Version, "vocabulary/default.v1:") {
+		t.Errorf("version = %q, want the default vocabulary template", english.Version)
+	}
+
+	dutch, err := l.Render("vocabulary", "dutch", vocabularyPromptData{Theme: "park", Count: 3, Language: "dutch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dutch.User, "in both English and Dutch") || !strings.HasPrefix(dutch.Version, "vocabulary/dutch.v1:") {
+		t.Errorf("dutch prompt = %+v", dutch)
+	}
+
+	if _, err := l.Render("story", "english", nil); !errors.Is(err, ErrUnknownPrompt) {
+		t.Errorf("err = %v, want ErrUnknownPrompt", err)
+	}
+}
+
+func TestPromptDirectoryOverridesBuiltinTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writePrompt(t, dir, "vocabulary/default.v1.tmpl", `List {{.Count}} words about {{.Theme}}.`)
+	writePrompt(t, dir, "vocabulary/dutch.v2.tmpl", `{{define "system"}}Be brief.{{end}}Noem {{.Count}} woorden over {{.Theme}}.`)
+	writePrompt(t, dir, "vocabulary/README.md", "not a template")
+
+	l, err := NewPromptLibrary(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := vocabularyPromptData{Theme: "park", Count: 2}
+
+	english, err := l.Render("vocabulary", "english", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builtin, _ := (*PromptLibrary)(nil).Version("vocabulary", "english")
+	if english.User != "List 2 words about park." || english.System != "" {
+		t.Errorf("english prompt = %+v", english)
+	}
+	if !strings.HasPrefix(english.Version, "vocabulary/default.v1:") || english.Version == builtin {
+		t.Errorf("version = %q, want another v1 than the built-in %q", english.Version, builtin)
+	}
+
+	dutch, err := l.Render("vocabulary", "dutch", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dutch.User != "Noem 2 woorden over park." || dutch.System != "Be brief." || !strings.HasPrefix(dutch.Version, "vocabulary/dutch.v2:") {
+		t.Errorf("dutch prompt = %+v", dutch)
+	}
+
+	// Missing fields are errors rather than "<no value>" in the prompt
+	writePrompt(t, dir, "vocabulary/default.v3.tmpl", `{{.Missing}}`)
+	if l, err = NewPromptLibrary(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Render("vocabulary", "english", map[string]string{}); err == nil {
+		t.Error("expected an error for a missing field")
+	}
+
+	writePrompt(t, dir, "vocabulary/dutch.v3.tmpl", `{{if}}`)
+	if _, err := NewPromptLibrary(dir); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
+
+func TestPromptLibraryReloadsChangedTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writePrompt(t, dir, "vocabulary/default.v2.tmpl", `First {{.Theme}}`)
+
+	l, err := NewPromptLibrary(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Watch(10 * time.Millisecond)
+	defer l.Close()
+
+	first, _ := l.Version("vocabulary", "english")
+	writePrompt(t, dir, "vocabulary/default.v2.tmpl", `Second {{.Theme}}`)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		prompt, err := l.Render("vocabulary", "english", vocabularyPromptData{Theme: "park"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prompt.User == "Second park" {
+			if prompt.Version == first {
+				t.Errorf("version %q did not change with the template", first)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("template was not reloaded, prompt = %q", prompt.User)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A broken template keeps the current ones in place
+	writePrompt(t, dir, "vocabulary/default.v3.tmpl", `{{end}}`)
+	l.reload()
+	prompt, err := l.Render("vocabulary", "english", vocabularyPromptData{Theme: "park"})
+	if err != nil || prompt.User != "Second park" {
+		t.Errorf("got %q, %v after a broken template, want the previous template", prompt.User, err)
+	}
+}
+
+func TestVocabularyCacheMissesWhenPromptChanges(t *testing.T) {
+	dir := t.TempDir()
+	writePrompt(t, dir, "vocabulary/default.v2.tmpl", `Words about {{.Theme}}`)
+	prompts, err := NewPromptLibrary(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &OpenAIService{
+		useMock:    true,
+		mockThemes: make(map[string][]models.VocabularyItem),
+		cache:      NewCache("").Namespace("vocabulary", 0),
+		prompts:    prompts,
+	}
+	s.initMockData()
+
+	if _, err := s.GetVocabularyForLanguage("park", 2, "english"); err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsVocabularyCached("park", 2, "english") {
+		t.Fatal("vocabulary was not cached")
+	}
+	if _, err := s.GetVocabularyForLanguage("park", 2, "english"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := s.cache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("stats = %+v, want 1 hit and 1 miss", stats)
+	}
+
+	writePrompt(t, dir, "vocabulary/default.v2.tmpl", `More words about {{.Theme}}`)
+	prompts.reload()
+	if s.IsVocabularyCached("park", 2, "english") {
+		t.Error("vocabulary of the previous prompt counts as cached")
+	}
+	if _, err := s.GetVocabularyForLanguage("park", 2, "english"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := s.cache.Stats(); stats.Misses != 2 {
+		t.Errorf("stats = %+v, want the stale entry to be a miss", stats)
+	}
+	if !s.IsVocabularyCached("park", 2, "english") {
+		t.Error("vocabulary was not cached again with the new prompt")
+	}
+
+	// Entries cached before prompts were versioned are stale too
+	if err := s.cache.Set([]models.VocabularyItem{{Word: "bench"}}, s.vocabularyCacheKey("cafe", 1, "english")...); err != nil {
+		t.Fatal(err)
+	}
+	if s.IsVocabularyCached("cafe", 1, "english") {
+		t.Error("an unversioned entry counts as cached")
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// RateLimitError is returned when a provider's quota is used up, or when the
+// rest of it is held back. It matches ErrRateLimited.
+type RateLimitError struct {
+	Provider string
+	// RetryAfter is how long until the provider is expected to accept requests again
+	RetryAfter time.Duration
+}
+
+// Error describes the rate limit
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s is rate limited, retry after %s", e.Provider, e.RetryAfter.Round(time.Second))
+}
+
+// Is makes errors.Is(err, ErrRateLimited) match rate limit errors
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RetryAfter returns how long to wait before retrying after err. When err
+// joins several rate limit errors, the shortest wait is returned, since one
+// provider is enough to retry. It returns false when err has no rate limit error.
+func RetryAfter(err error) (time.Duration, bool) {
+	switch e := err.(type) {
+	case *RateLimitError:
+		return e.RetryAfter, true
+	case interface{ Unwrap() []error }:
+		var shortest time.Duration
+		found := false
+		for _, err := range e.Unwrap() {
+			if retryAfter, ok := RetryAfter(err); ok && (!found || retryAfter < shortest) {
+				shortest, found = retryAfter, true
+			}
+		}
+		return shortest, found
+	case interface{ Unwrap() error }:
+		return RetryAfter(e.Unwrap())
+	}
+	return 0, false
+}
+
+// rateLimit tracks a provider's quota from the X-Ratelimit headers of its responses
+type rateLimit struct {
+	provider string
+	// window is when the quota is assumed to recover if the provider does not report it
+	window time.Duration
+
+	limit     int // -1 until a response reported it
+	remaining int // -1 until a response reported it
+	resetAt   time.Time
+	updatedAt time.Time
+	mu        sync.RWMutex
+}
+
+// newRateLimit creates a rate limit tracker for a provider whose quota is refilled every window
+func newRateLimit(provider string, window time.Duration) *rateLimit {
+	return &rateLimit{provider: provider, window: window, limit: -1, remaining: -1}
+}
+
+// update records the quota reported by the headers of a response
+func (r *rateLimit) update(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-Ratelimit-Remaining"))
+	if err != nil {
+		return
+	}
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.remaining = remaining
+	if limit, err := strconv.Atoi(header.Get("X-Ratelimit-Limit")); err == nil {
+		r.limit = limit
+	}
+	// Pexels reports when the quota is refilled, Unsplash refills it every hour
+	if reset, err := strconv.ParseInt(header.Get("X-Ratelimit-Reset"), 10, 64); err == nil {
+		r.resetAt = time.Unix(reset, 0)
+	} else {
+		r.resetAt = now.Add(r.window)
+	}
+	r.updatedAt = now
+}
+
+// exhausted records that the provider rejected a request because of its rate
+// limit and returns the error for it
+func (r *rateLimit) exhausted(header http.Header) *RateLimitError {
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.remaining = 0
+	r.updatedAt = now
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+		r.resetAt = now.Add(time.Duration(seconds) * time.Second)
+	} else if !r.resetAt.After(now) {
+		r.resetAt = now.Add(r.window)
+	}
+	return &RateLimitError{Provider: r.provider, RetryAfter: r.resetAt.Sub(now)}
+}
+
+// spend counts a request whose response has not been seen yet against the
+// remaining quota, the response's headers replace the estimate
+func (r *rateLimit) spend() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.remaining > 0 {
+		r.remaining--
+	}
+}
+
+// remainingRequests returns how many requests are left in the current window,
+// and false before a response reported it
+func (r *rateLimit) remainingRequests() (int, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.remaining, r.remaining >= 0
+}
+
+// throttled returns a rate limit error while fewer than threshold requests are
+// left and the quota has not been refilled yet. The last request is always held back.
+func (r *rateLimit) throttled(threshold int) *RateLimitError {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	if r.remaining < 0 || r.remaining >= max(threshold, 1) || !now.Before(r.resetAt) {
+		return nil
+	}
+	return &RateLimitError{Provider: r.provider, RetryAfter: r.resetAt.Sub(now)}
+}
+
+// quota returns the quota as shown to admins
+func (r *rateLimit) quota(threshold int) models.ProviderQuota {
+	r.mu.RLock()
+	quota := models.ProviderQuota{
+		Provider:  r.provider,
+		Reported:  r.remaining >= 0,
+		Limit:     max(r.limit, 0),
+		Remaining: max(r.remaining, 0),
+		Threshold: threshold,
+	}
+	if !r.updatedAt.IsZero() {
+		quota.ResetAt = r.resetAt.Format(time.RFC3339)
+		quota.UpdatedAt = r.updatedAt.Format(time.RFC3339)
+	}
+	r.mu.RUnlock()
+
+	quota.Throttled = r.throttled(threshold) != nil
+	return quota
+}
+
+// rateLimitReporter is implemented by providers that track their quota
+type rateLimitReporter interface {
+	rateLimits() *rateLimit
+}
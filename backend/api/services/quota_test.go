@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+func TestImageChainSkipsProviderWithLowQuota(t *testing.T) {
+	unsplash, fake := newFakeUnsplashService(http.StatusOK)
+	fake.body = `{"results": [{"id": "abc"}]}`
+	fake.header = http.Header{"X-Ratelimit-Limit": {"50"}, "X-Ratelimit-Remaining": {"3"}}
+	fallback := &fakeProvider{name: "wikimedia", images: []models.Image{{ID: "wikimedia:1"}}}
+	chain := NewImageChain(NewCache("").Namespace("images", 0), 5, unsplash, fallback)
+
+	// The quota is only known after the first response
+	images, err := chain.SearchImages("park", 1)
+	if err != nil || len(images) != 1 || images[0].ID != "abc" {
+		t.Fatalf("got %v, %v, want the Unsplash image", images, err)
+	}
+
+	quotas := chain.Quotas()
+	if len(quotas) != 1 {
+		t.Fatalf("got %d quotas, want only the Unsplash quota", len(quotas))
+	}
+	if q := quotas[0]; !q.Reported || q.Limit != 50 || q.Remaining != 3 || !q.Throttled || q.Threshold != 5 {
+		t.Errorf("quota = %+v", q)
+	}
+
+	images, err = chain.SearchImages("beach", 1)
+	if err != nil || len(images) != 1 || images[0].ID != "wikimedia:1" {
+		t.Fatalf("got %v, %v, want the fallback image", images, err)
+	}
+	if requests := fake.requests(); len(requests) != 1 {
+		t.Errorf("sent %d requests to Unsplash, want it to be skipped below the threshold", len(requests))
+	}
+
+	// Images of a throttled provider are not fetched
+	_, err = chain.GetImage("abc")
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) || rateLimitErr.Provider != "unsplash" {
+		t.Fatalf("err = %v, want a rate limit error", err)
+	}
+	if rateLimitErr.RetryAfter <= 59*time.Minute || rateLimitErr.RetryAfter > time.Hour {
+		t.Errorf("retry after %s, want about an hour", rateLimitErr.RetryAfter)
+	}
+}
+
+func TestUnsplashExhaustedQuota(t *testing.T) {
+	s, fake := newFakeUnsplashService(http.StatusForbidden)
+	fake.header = http.Header{"X-Ratelimit-Limit": {"50"}, "X-Ratelimit-Remaining": {"0"}}
+
+	_, err := s.SearchImages("park", 1)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("err = %v, want ErrRateLimited", err)
+	}
+	if retryAfter, ok := RetryAfter(err); !ok || retryAfter <= 0 {
+		t.Errorf("retry after %s, %v", retryAfter, ok)
+	}
+	if remaining, ok := s.RateLimitRemaining(); !ok || remaining != 0 {
+		t.Errorf("remaining = %d, %v, want 0", remaining, ok)
+	}
+}
+
+func TestPexelsRetryAfter(t *testing.T) {
+	s, transport := newFixturePexelsService("pexels_photo.json")
+	transport.status = http.StatusTooManyRequests
+	transport.header = http.Header{"Retry-After": {"120"}}
+
+	_, err := s.SearchImages("apple", 3)
+	retryAfter, ok := RetryAfter(err)
+	if !ok || retryAfter != 2*time.Minute {
+		t.Errorf("retry after %s, %v, want 2m", retryAfter, ok)
+	}
+}
+
+func TestRetryAfterPicksShortestWait(t *testing.T) {
+	err := fmt.Errorf("image search failed: %w", errors.Join(
+		fmt.Errorf("unsplash: %w", &RateLimitError{Provider: "unsplash", RetryAfter: time.Hour}),
+		errors.New("wikimedia: unexpected status code: 500"),
+		fmt.Errorf("pexels: %w", &RateLimitError{Provider: "pexels", RetryAfter: time.Minute}),
+	))
+	if retryAfter, ok := RetryAfter(err); !ok || retryAfter != time.Minute {
+		t.Errorf("retry after %s, %v, want 1m", retryAfter, ok)
+	}
+
+	if _, ok := RetryAfter(errors.New("unexpected status code: 500")); ok {
+		t.Error("found a retry time in an error without rate limit")
+	}
+}
+
+func TestImageChainTracksOnlyServedImages(t *testing.T) {
+	unsplash, fake := newFakeUnsplashService(http.StatusOK)
+	fake.body = `{"results": [{"id": "abc"}]}`
+	fake.header = http.Header{"X-Ratelimit-Limit": {"50"}, "X-Ratelimit-Remaining": {"20"}}
+	chain := NewImageChain(NewCache("").Namespace("images", 0), 5, unsplash)
+
+	// Images that were never shown to a learner cannot use up the quota
+	if _, err := chain.TrackDownload("abc", "ip:1"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("err = %v, want ErrImageNotFound for an image that was not served", err)
+	}
+	if requests := fake.requests(); len(requests) != 0 {
+		t.Fatalf("sent %v to Unsplash, want nothing", requests)
+	}
+
+	if _, err := chain.SearchImages("park", 1); err != nil {
+		t.Fatal(err)
+	}
+	tracked, err := chain.TrackDownload("abc", "ip:1")
+	if err != nil || !tracked {
+		t.Fatalf("got %v, %v, want the served image tracked", tracked, err)
+	}
+	unsplash.Close()
+	if requests := fake.requests(); len(requests) != 2 || requests[1] != "/photos/abc/download" {
+		t.Errorf("requests = %v, want the search and the download", requests)
+	}
+
+	// Tracking is held back with the rest of the quota
+	fake.header = http.Header{"X-Ratelimit-Limit": {"50"}, "X-Ratelimit-Remaining": {"3"}}
+	if _, err := chain.SearchImages("beach", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.TrackDownload("abc", "ip:2"); !IsRateLimited(err) {
+		t.Errorf("err = %v, want a rate limit error", err)
+	}
+	unsplash.Close()
+	if requests := fake.requests(); len(requests) != 3 {
+		t.Errorf("requests = %v, want no download below the threshold", requests)
+	}
+}
@@ -1,91 +1,523 @@
 package services
 
 import (
+	"crypto/rand"
 	"errors"
+	"fmt"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/yourusername/picto-lingua-backend/api/models"
 )
 
+var (
+	// ErrSessionNotFound is returned when a session does not exist
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionForbidden is returned when a session belongs to another user
+	ErrSessionForbidden = errors.New("session belongs to another user")
+	// ErrSessionExpired is returned when a session existed but has expired
+	ErrSessionExpired = errors.New("session expired")
+	// ErrInvalidAnswer is returned when a recorded answer fails validation
+	ErrInvalidAnswer = errors.New("invalid answer")
+	// ErrInvalidProgress is returned when reported progress fails validation
+	ErrInvalidProgress = errors.New("invalid progress")
+	// ErrVersionConflict is returned when a session was changed since the client read it
+	ErrVersionConflict = errors.New("session was modified by another client")
+)
+
+// expiredSessionRetention is how long the IDs of expired sessions are remembered
+// so they can be reported as expired rather than not found
+const expiredSessionRetention = 7 * 24 * time.Hour
+
+// expiredSession remembers who owned an expired session and when it expired
+type expiredSession struct {
+	userID    string
+	expiredAt time.Time
+}
+
+// sessionEntry is a stored session with its activity timestamps
+type sessionEntry struct {
+	data       models.SessionData
+	events     []recordedEvent // append-only, progress is folded from it
+	reported   map[string]models.ProgressItem
+	vocabulary []models.VocabularyItem // words the session practices, frozen at creation
+	startedAt  time.Time
+	lastActive time.Time
+}
+
+// expiresAt returns the time the session expires, whichever limit comes first
+func (e *sessionEntry) expiresAt(idleTimeout, maxLifetime time.Duration) time.Time {
+	idle := e.lastActive.Add(idleTimeout)
+	absolute := e.startedAt.Add(maxLifetime)
+	if absolute.Before(idle) {
+		return absolute
+	}
+	return idle
+}
+
+// practices reports whether a word is part of the session's vocabulary
+func (e *sessionEntry) practices(word string) bool {
+	return slices.ContainsFunc(e.vocabulary, func(item models.VocabularyItem) bool {
+		return item.Word == word
+	})
+}
+
+// snapshot returns a copy of the session data that is safe to use without the lock
+func (e *sessionEntry) snapshot() *models.SessionData {
+	session := e.data
+	session.Progress = make(map[string]models.ProgressItem, len(e.data.Progress))
+	for word, item := range e.data.Progress {
+		session.Progress[word] = item
+	}
+	return &session
+}
+
+// ProgressUpdate describes a change to the progress on one word in a session
+type ProgressUpdate struct {
+	UserID    string
+	ThemeID   string
+	SessionID string
+	// AssignmentID is the classroom assignment the session practices, if any
+	AssignmentID string
+	// Previous is the progress before the update, nil for words seen for the first time
+	Previous *models.ProgressItem
+	Current  models.ProgressItem
+	// At is when the learner last answered, RecordedAt when the server stored the update
+	At         time.Time
+	RecordedAt time.Time
+	// Answers and KnownAnswers count the answers on the word recorded by this
+	// update, unlike the counters in Current they are not reported by clients
+	Answers      int
+	KnownAnswers int
+}
+
+// ProgressListener is notified after session progress has been updated
+type ProgressListener func(update ProgressUpdate)
+
 // SessionService manages user sessions
 type SessionService struct {
-	sessions map[string]models.SessionData
-	mu       sync.RWMutex
+	sessions    map[string]*sessionEntry
+	byUser      map[string]map[string]struct{} // user ID to their live session IDs
+	expired     map[string]expiredSession      // keyed by session ID
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+	listeners   []ProgressListener
+	mu          sync.RWMutex
+
+	stop      chan struct{}
+	janitor   sync.WaitGroup
+	closeOnce sync.Once
 }
 
-// NewSessionService creates a new session service
-func NewSessionService() *SessionService {
+// NewSessionService creates a new session service.
+// Sessions expire after idleTimeout without updates or maxLifetime after creation.
+func NewSessionService(idleTimeout, maxLifetime time.Duration) *SessionService {
 	return &SessionService{
-		sessions: make(map[string]models.SessionData),
+		sessions:    make(map[string]*sessionEntry),
+		byUser:      make(map[string]map[string]struct{}),
+		expired:     make(map[string]expiredSession),
+		idleTimeout: idleTimeout,
+		maxLifetime: maxLifetime,
+		stop:        make(chan struct{}),
 	}
 }
 
-// CreateSession creates a new session for a user
-func (s *SessionService) CreateSession(themeID, imageID string) (string, error) {
+// StartJanitor starts a background goroutine that removes expired sessions
+// every interval until Close is called. It does nothing when the interval is
+// not positive.
+func (s *SessionService) StartJanitor(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	s.janitor.Add(1)
+	go func() {
+		defer s.janitor.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if n := s.expireSessions(time.Now()); n > 0 {
+					debugLogger.Printf("Session janitor expired %d sessions", n)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the janitor and waits for it to exit
+func (s *SessionService) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	s.janitor.Wait()
+}
+
+// expireSessions removes every session that has expired by now and
+// returns how many were removed
+func (s *SessionService) expireSessions(now time.Time) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Generate a simple session ID (in production, use a proper UUID generator)
-	sessionID := generateSessionID()
+	count := 0
+	for id, entry := range s.sessions {
+		expiresAt := entry.expiresAt(s.idleTimeout, s.maxLifetime)
+		if now.After(expiresAt) {
+			delete(s.sessions, id)
+			delete(s.byUser[entry.data.UserID], id)
+			if len(s.byUser[entry.data.UserID]) == 0 {
+				delete(s.byUser, entry.data.UserID)
+			}
+			s.expired[id] = expiredSession{userID: entry.data.UserID, expiredAt: expiresAt}
+			count++
+		}
+	}
+
+	for id, expired := range s.expired {
+		if now.Sub(expired.expiredAt) > expiredSessionRetention {
+			delete(s.expired, id)
+		}
+	}
+
+	return count
+}
+
+// SessionOptions describes what a new session practices
+type SessionOptions struct {
+	ThemeID      string
+	ImageID      string
+	Language     string
+	WordCount    int
+	AssignmentID string
+	// Vocabulary is the word list the session practices, answers and progress
+	// on other words are rejected
+	Vocabulary []models.VocabularyItem
+}
+
+// SessionFilter narrows down the sessions returned by ListSessions
+type SessionFilter struct {
+	ThemeID      string
+	AssignmentID string
+	// Sessions started before From or after To are skipped, zero values disable the bound
+	From time.Time
+	To   time.Time
+}
+
+// CreateSession creates a new session owned by a user
+func (s *SessionService) CreateSession(userID string, options SessionOptions) (string, error) {
+	sessionID, err := NewUUID()
+	if err != nil {
+		return "", fmt.Errorf("error generating session ID: %w", err)
+	}
 
-	now := time.Now().Format(time.RFC3339)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// Create a new session
-	session := models.SessionData{
-		ThemeID:     themeID,
-		ImageID:     imageID,
-		Progress:    make(map[string]models.ProgressItem),
-		SessionID:   sessionID,
-		StartedAt:   now,
-		LastUpdated: now,
+	now := time.Now()
+	entry := &sessionEntry{
+		data: models.SessionData{
+			UserID:       userID,
+			ThemeID:      options.ThemeID,
+			ImageID:      options.ImageID,
+			Language:     options.Language,
+			WordCount:    options.WordCount,
+			AssignmentID: options.AssignmentID,
+			Progress:     make(map[string]models.ProgressItem),
+			SessionID:    sessionID,
+			StartedAt:    now.Format(time.RFC3339),
+			LastUpdated:  now.Format(time.RFC3339),
+			Version:      1,
+		},
+		reported:   make(map[string]models.ProgressItem),
+		vocabulary: slices.Clone(options.Vocabulary),
+		startedAt:  now,
+		lastActive: now,
 	}
+	entry.data.ExpiresAt = entry.expiresAt(s.idleTimeout, s.maxLifetime).Format(time.RFC3339)
 
 	// Store the session
-	s.sessions[sessionID] = session
+	s.sessions[sessionID] = entry
+	if s.byUser[userID] == nil {
+		s.byUser[userID] = make(map[string]struct{})
+	}
+	s.byUser[userID][sessionID] = struct{}{}
 
 	return sessionID, nil
 }
 
-// GetSession gets a session by its ID
-func (s *SessionService) GetSession(sessionID string) (*models.SessionData, error) {
+// ListSessions returns the live sessions of a user, most recently active first
+func (s *SessionService) ListSessions(userID string, filter SessionFilter) []models.SessionData {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	session, ok := s.sessions[sessionID]
-	if !ok {
-		return nil, errors.New("session not found")
+	now := time.Now()
+	entries := make([]*sessionEntry, 0, len(s.byUser[userID]))
+	for sessionID := range s.byUser[userID] {
+		entry := s.sessions[sessionID]
+		if now.After(entry.expiresAt(s.idleTimeout, s.maxLifetime)) {
+			continue
+		}
+		if filter.ThemeID != "" && entry.data.ThemeID != filter.ThemeID {
+			continue
+		}
+		if filter.AssignmentID != "" && entry.data.AssignmentID != filter.AssignmentID {
+			continue
+		}
+		if !filter.From.IsZero() && entry.startedAt.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && entry.startedAt.After(filter.To) {
+			continue
+		}
+		entries = append(entries, entry)
 	}
 
-	return &session, nil
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastActive.After(entries[j].lastActive)
+	})
+
+	sessions := make([]models.SessionData, 0, len(entries))
+	for _, entry := range entries {
+		sessions = append(sessions, *entry.snapshot())
+	}
+	return sessions
 }
 
-// UpdateSession updates a session with new progress
-func (s *SessionService) UpdateSession(sessionID string, progress map[string]models.ProgressItem) error {
+// ResumeSession marks a session owned by the user as active again, which
+// extends its idle expiry, and returns it with the vocabulary it practices
+func (s *SessionService) ResumeSession(sessionID, userID string) (*models.SessionData, []models.VocabularyItem, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	session, ok := s.sessions[sessionID]
+	entry, err := s.lookup(sessionID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry.lastActive = time.Now()
+	entry.data.ExpiresAt = entry.expiresAt(s.idleTimeout, s.maxLifetime).Format(time.RFC3339)
+
+	return entry.snapshot(), slices.Clone(entry.vocabulary), nil
+}
+
+// lookup finds a live session owned by the user, the caller must hold the lock
+func (s *SessionService) lookup(sessionID, userID string) (*sessionEntry, error) {
+	entry, ok := s.sessions[sessionID]
 	if !ok {
-		return errors.New("session not found")
+		expired, ok := s.expired[sessionID]
+		switch {
+		case !ok:
+			return nil, ErrSessionNotFound
+		case expired.userID != userID:
+			return nil, ErrSessionForbidden
+		}
+		return nil, ErrSessionExpired
 	}
 
-	// Update the progress
-	for word, item := range progress {
-		session.Progress[word] = item
+	// Other users do not learn whether the session is still live
+	if entry.data.UserID != userID {
+		return nil, ErrSessionForbidden
+	}
+
+	// The janitor may not have run yet
+	if time.Now().After(entry.expiresAt(s.idleTimeout, s.maxLifetime)) {
+		return nil, ErrSessionExpired
+	}
+
+	return entry, nil
+}
+
+// GetSession gets a session by its ID if it is owned by the user
+func (s *SessionService) GetSession(sessionID, userID string) (*models.SessionData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, err := s.lookup(sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.snapshot(), nil
+}
+
+// AddProgressListener registers a listener for progress updates.
+// Listeners are called synchronously after the session lock has been released.
+func (s *SessionService) AddProgressListener(listener ProgressListener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.listeners = append(s.listeners, listener)
+}
+
+// SessionUpdate is a change to a session's progress
+type SessionUpdate struct {
+	// ExpectedVersion rejects the update with ErrVersionConflict unless it
+	// matches the current version, zero accepts any version
+	ExpectedVersion int
+	// Answers are appended to the session's event log
+	Answers []models.SessionEvent
+	// Progress holds counters reported by clients that do not send answers,
+	// they are capped by capProgress and merged with MergeProgress
+	Progress map[string]models.ProgressItem
+}
+
+// UpdateSession applies an update to a session owned by the user and returns
+// the updated session
+func (s *SessionService) UpdateSession(sessionID, userID string, update SessionUpdate) (*models.SessionData, error) {
+	session, updates, listeners, err := s.applyUpdate(sessionID, userID, update)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range updates {
+		for _, listener := range listeners {
+			listener(u)
+		}
+	}
+
+	return session, nil
+}
+
+// applyUpdate stores new answers and reported progress, refolds the progress
+// on the affected words and returns the resulting progress updates
+func (s *SessionService) applyUpdate(sessionID, userID string, update SessionUpdate) (*models.SessionData, []ProgressUpdate, []ProgressListener, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, err := s.lookup(sessionID, userID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if update.ExpectedVersion != 0 && update.ExpectedVersion != entry.data.Version {
+		return nil, nil, nil, ErrVersionConflict
+	}
+
+	// Validate everything before touching the log so a bad answer rejects the whole batch
+	events := make([]recordedEvent, 0, len(update.Answers))
+	for _, answer := range update.Answers {
+		event, err := normalizeAnswer(answer, entry.startedAt, now)
+		if err == nil && !entry.practices(event.event.Word) {
+			err = fmt.Errorf("word %q is not part of the session", event.event.Word)
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: %v", ErrInvalidAnswer, err)
+		}
+		events = append(events, event)
+	}
+	for word, item := range update.Progress {
+		if err := validateProgress(word, item); err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: %v", ErrInvalidProgress, err)
+		}
+		if !entry.practices(word) {
+			return nil, nil, nil, fmt.Errorf("%w: word %q is not part of the session", ErrInvalidProgress, word)
+		}
+	}
+
+	// Append the events, remembering the latest answer time and the answers per word
+	latest := make(map[string]time.Time)
+	answers := make(map[string]int)
+	knownAnswers := make(map[string]int)
+	words := make([]string, 0)
+	for _, event := range events {
+		event.event.Sequence = len(entry.events) + 1
+		entry.events = append(entry.events, event)
+
+		answers[event.event.Word]++
+		if event.event.Result == "known" {
+			knownAnswers[event.event.Word]++
+		}
+
+		at, seen := latest[event.event.Word]
+		if !seen {
+			words = append(words, event.event.Word)
+		}
+		if !seen || event.at.After(at) {
+			latest[event.event.Word] = event.at
+		}
+	}
+
+	// Merge reported counters, keeping the highest seen by any client, after
+	// capping them by the answers this update can account for
+	for word, item := range update.Progress {
+		item.Word = word
+		item = capProgress(item, entry.data.Progress[word], answers[word])
+		entry.reported[word] = MergeProgress(entry.reported[word], item)
+		if _, seen := latest[word]; !seen {
+			words = append(words, word)
+			latest[word] = now
+		}
 	}
 
-	// Update the last updated timestamp
-	session.LastUpdated = time.Now().Format(time.RFC3339)
+	// Derive the progress on every affected word from its events and reported counters
+	updates := make([]ProgressUpdate, 0, len(words))
+	for _, word := range words {
+		item := MergeProgress(foldEvents(word, entry.events), entry.reported[word])
+		u := ProgressUpdate{
+			UserID:       entry.data.UserID,
+			ThemeID:      entry.data.ThemeID,
+			SessionID:    sessionID,
+			AssignmentID: entry.data.AssignmentID,
+			Current:      item,
+			At:           latest[word],
+			RecordedAt:   now,
+			Answers:      answers[word],
+			KnownAnswers: knownAnswers[word],
+		}
+		if previous, ok := entry.data.Progress[word]; ok {
+			u.Previous = &previous
+		}
+		entry.data.Progress[word] = item
+		updates = append(updates, u)
+	}
 
-	// Store the updated session
-	s.sessions[sessionID] = session
+	// Update the version and activity timestamps, which also extends the idle expiry
+	entry.data.Version++
+	entry.lastActive = now
+	entry.data.LastUpdated = now.Format(time.RFC3339)
+	entry.data.ExpiresAt = entry.expiresAt(s.idleTimeout, s.maxLifetime).Format(time.RFC3339)
 
-	return nil
+	return entry.snapshot(), updates, s.listeners, nil
 }
 
-// generateSessionID generates a simple session ID
-// In production, use a proper UUID generator
-func generateSessionID() string {
-	return time.Now().Format("20060102150405.000000000")
+// GetEvents returns the events of a session owned by the user with a
+// sequence number greater than afterSequence, in the order they were recorded
+func (s *SessionService) GetEvents(sessionID, userID string, afterSequence int) ([]models.SessionEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, err := s.lookup(sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if afterSequence < 0 {
+		afterSequence = 0
+	}
+
+	events := make([]models.SessionEvent, 0)
+	for _, e := range entry.events[min(afterSequence, len(entry.events)):] {
+		events = append(events, e.event)
+	}
+
+	return events, nil
+}
+
+// NewUUID generates a random (version 4) UUID
+func NewUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
 }
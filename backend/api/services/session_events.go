@@ -0,0 +1,134 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// maxClockSkew is how far in the future an answer timestamp may be before it is clamped
+const maxClockSkew = 5 * time.Minute
+
+// validResults are the answers a learner can give on a flashcard
+var validResults = map[string]bool{
+	"known":     true,
+	"learning":  true,
+	"difficult": true,
+}
+
+// recordedEvent is a stored session event with its parsed timestamp
+type recordedEvent struct {
+	event models.SessionEvent
+	at    time.Time
+}
+
+// normalizeAnswer validates an answer and fills in its timestamp. Answers
+// cannot be given before the session started or in the future, timestamps
+// outside that range are clamped to it.
+func normalizeAnswer(answer models.SessionEvent, startedAt, now time.Time) (recordedEvent, error) {
+	answer.Word = strings.TrimSpace(answer.Word)
+	answer.Result = strings.ToLower(strings.TrimSpace(answer.Result))
+
+	if answer.Word == "" {
+		return recordedEvent{}, fmt.Errorf("answer word is required")
+	}
+	if !validResults[answer.Result] {
+		return recordedEvent{}, fmt.Errorf("invalid result %q for word %q", answer.Result, answer.Word)
+	}
+	if answer.DurationMs < 0 {
+		return recordedEvent{}, fmt.Errorf("invalid duration for word %q", answer.Word)
+	}
+
+	at := now
+	if answer.Timestamp != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, answer.Timestamp)
+		if err != nil {
+			return recordedEvent{}, fmt.Errorf("invalid timestamp %q for word %q", answer.Timestamp, answer.Word)
+		}
+		at = parsed
+	}
+	if at.After(now.Add(maxClockSkew)) {
+		at = now
+	}
+	if at.Before(startedAt) {
+		at = startedAt
+	}
+
+	answer.Timestamp = at.UTC().Format(time.RFC3339Nano)
+	answer.RecordedAt = now.UTC().Format(time.RFC3339Nano)
+	return recordedEvent{event: answer, at: at}, nil
+}
+
+// foldEvents derives the progress on a word from its answers in timestamp
+// order, so answers saved out of order cannot regress the status
+func foldEvents(word string, events []recordedEvent) models.ProgressItem {
+	matching := make([]recordedEvent, 0, len(events))
+	for _, e := range events {
+		if e.event.Word == word {
+			matching = append(matching, e)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].at.Before(matching[j].at)
+	})
+
+	item := models.ProgressItem{Word: word}
+	for _, e := range matching {
+		item.SeenCount++
+		if e.event.Result == "known" {
+			item.KnownCount++
+		}
+		item.Status = e.event.Result
+		item.TimeTaken = e.event.DurationMs
+	}
+	return item
+}
+
+// validateProgress checks that progress reported on a word is consistent:
+// counters cannot be negative, a word cannot be known more often than seen,
+// and only a word that has been seen can have one of the answer statuses
+func validateProgress(word string, item models.ProgressItem) error {
+	switch {
+	case item.SeenCount < 0 || item.KnownCount < 0:
+		return fmt.Errorf("negative counts for word %q", word)
+	case item.KnownCount > item.SeenCount:
+		return fmt.Errorf("word %q known more often than seen", word)
+	case item.TimeTaken < 0:
+		return fmt.Errorf("invalid time taken for word %q", word)
+	case item.Status != "" && !validResults[item.Status]:
+		return fmt.Errorf("invalid status %q for word %q", item.Status, word)
+	case item.Status != "" && item.SeenCount == 0:
+		return fmt.Errorf("word %q has a status but was never seen", word)
+	}
+	return nil
+}
+
+// capProgress limits how far reported counters can move past the current
+// progress on a word: by the answers recorded in the same update, or by one
+// answer for clients that report counters without sending answers
+func capProgress(item, current models.ProgressItem, answers int) models.ProgressItem {
+	growth := max(answers, 1)
+	item.SeenCount = min(item.SeenCount, current.SeenCount+growth)
+	item.KnownCount = min(item.KnownCount, current.KnownCount+growth, item.SeenCount)
+	return item
+}
+
+// MergeProgress merges two views of the progress on a word field by field.
+// Counters only ever grow, so the highest seen and known counts win, and the
+// status and time come from the view that has seen the word most often.
+func MergeProgress(a, b models.ProgressItem) models.ProgressItem {
+	merged := a
+	if b.SeenCount > a.SeenCount || (a.Status == "" && b.Status != "") {
+		merged.Status = b.Status
+		merged.TimeTaken = b.TimeTaken
+	}
+	if merged.Word == "" {
+		merged.Word = b.Word
+	}
+	merged.SeenCount = max(a.SeenCount, b.SeenCount)
+	merged.KnownCount = max(a.KnownCount, b.KnownCount)
+	return merged
+}
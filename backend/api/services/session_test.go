@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// parkSession is a session practicing a few words of the park theme
+var parkSession = SessionOptions{ThemeID: "park", Vocabulary: []models.VocabularyItem{{Word: "tree"}, {Word: "pond"}}}
+
+func TestSessionLookupChecksOwnerBeforeExpiry(t *testing.T) {
+	s := NewSessionService(time.Hour, 24*time.Hour)
+	expiredID, err := s.CreateSession("u1", parkSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.expireSessions(time.Now().Add(2 * time.Hour))
+
+	// A session that expired before the janitor ran
+	s.idleTimeout = time.Nanosecond
+	lapsedID, err := s.CreateSession("u1", parkSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+
+	for _, id := range []string{expiredID, lapsedID} {
+		if _, err := s.GetSession(id, "u2"); !errors.Is(err, ErrSessionForbidden) {
+			t.Errorf("other user got %v, want %v", err, ErrSessionForbidden)
+		}
+		if _, err := s.GetSession(id, "u1"); !errors.Is(err, ErrSessionExpired) {
+			t.Errorf("owner got %v, want %v", err, ErrSessionExpired)
+		}
+	}
+}
+
+func TestSessionJanitorIgnoresInvalidInterval(t *testing.T) {
+	s := NewSessionService(time.Hour, 24*time.Hour)
+	s.StartJanitor(0)
+	s.StartJanitor(-time.Minute)
+	s.Close()
+}
+
+func TestSessionClampsAnswerTimestamps(t *testing.T) {
+	s := NewSessionService(time.Hour, 24*time.Hour)
+	id, err := s.CreateSession("u1", parkSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := s.sessions[id].startedAt
+
+	var updates []ProgressUpdate
+	s.AddProgressListener(func(u ProgressUpdate) { updates = append(updates, u) })
+	_, err = s.UpdateSession(id, "u1", SessionUpdate{Answers: []models.SessionEvent{
+		{Word: "tree", Result: "known", Timestamp: "2020-01-01T00:00:00Z"},
+		{Word: "pond", Result: "known", Timestamp: time.Now().Add(time.Hour).Format(time.RFC3339)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(updates) != 2 {
+		t.Fatalf("got %d progress updates, want 2", len(updates))
+	}
+	if !updates[0].At.Equal(started) {
+		t.Errorf("backdated answer at %s, want the session start %s", updates[0].At, started)
+	}
+	if updates[1].At.After(updates[1].RecordedAt) {
+		t.Errorf("future answer at %s, after it was recorded at %s", updates[1].At, updates[1].RecordedAt)
+	}
+}
+
+func TestSessionValidatesReportedProgress(t *testing.T) {
+	s := NewSessionService(time.Hour, 24*time.Hour)
+	id, err := s.CreateSession("u1", parkSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, progress := range map[string]map[string]models.ProgressItem{
+		"negative seen":    {"tree": {SeenCount: -1}},
+		"negative known":   {"tree": {SeenCount: 1, KnownCount: -1}},
+		"known above seen": {"tree": {SeenCount: 1, KnownCount: 2}},
+		"unknown status":   {"tree": {Status: "whatever", SeenCount: 1}},
+		"status unseen":    {"tree": {Status: "known"}},
+		"unknown word":     {"tree": {SeenCount: 1}, "swing": {SeenCount: 1000000, KnownCount: 1000000}},
+	} {
+		if _, err := s.UpdateSession(id, "u1", SessionUpdate{Progress: progress}); !errors.Is(err, ErrInvalidProgress) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrInvalidProgress)
+		}
+	}
+	answers := []models.SessionEvent{{Word: "swing", Result: "known"}}
+	if _, err := s.UpdateSession(id, "u1", SessionUpdate{Answers: answers}); !errors.Is(err, ErrInvalidAnswer) {
+		t.Errorf("answer on an unknown word: got %v, want %v", err, ErrInvalidAnswer)
+	}
+
+	// Rejected updates leave no trace, valid ones are merged
+	session, err := s.UpdateSession(id, "u1", SessionUpdate{Progress: map[string]models.ProgressItem{"tree": {Status: "known", SeenCount: 1, KnownCount: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Progress) != 1 || session.Progress["tree"].SeenCount != 1 || session.Version != 2 {
+		t.Errorf("session = %+v, want only the valid progress", session)
+	}
+}
+
+func TestSessionCapsReportedProgress(t *testing.T) {
+	s := NewSessionService(time.Hour, 24*time.Hour)
+	id, err := s.CreateSession("u1", parkSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A report without answers stands for a single answer
+	session, err := s.UpdateSession(id, "u1", SessionUpdate{Progress: map[string]models.ProgressItem{"tree": {Status: "known", SeenCount: 1000000, KnownCount: 1000000}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := session.Progress["tree"]; got.SeenCount != 1 || got.KnownCount != 1 {
+		t.Errorf("progress = %+v, want one answer", got)
+	}
+
+	// With answers the counters grow by the answers in the update
+	answers := []models.SessionEvent{{Word: "tree", Result: "learning"}, {Word: "tree", Result: "known"}}
+	session, err = s.UpdateSession(id, "u1", SessionUpdate{Answers: answers, Progress: map[string]models.ProgressItem{"tree": {Status: "known", SeenCount: 50, KnownCount: 50}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := session.Progress["tree"]; got.SeenCount != 3 || got.KnownCount != 3 {
+		t.Errorf("progress = %+v, want two more answers", got)
+	}
+}
+
+func TestSessionResumesWithItsVocabulary(t *testing.T) {
+	s := NewSessionService(time.Hour, 24*time.Hour)
+	options := parkSession
+	options.Vocabulary = slices.Clone(parkSession.Vocabulary)
+	id, err := s.CreateSession("u1", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changes to the caller's word list do not reach the session
+	options.Vocabulary[0].Word = "swing"
+
+	_, vocabulary, err := s.ResumeSession(id, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vocabulary) != 2 || vocabulary[0].Word != "tree" || vocabulary[1].Word != "pond" {
+		t.Errorf("vocabulary = %+v, want the words the session started with", vocabulary)
+	}
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// SpeechSynthesizer turns a word or phrase into spoken audio
+type SpeechSynthesizer interface {
+	// Name identifies the synthesizer, it is part of the audio cache key
+	Name() string
+	// Synthesize returns the encoded audio and its content type
+	Synthesize(ctx context.Context, text, language string) ([]byte, string, error)
+}
+
+// languageCodes maps the language names used by the API to ISO 639-1 codes
+var languageCodes = map[string]string{
+	"english": "en",
+	"dutch":   "nl",
+}
+
+// LanguageCode returns the ISO 639-1 code for a language name
+func LanguageCode(language string) (string, bool) {
+	code, ok := languageCodes[strings.ToLower(language)]
+	return code, ok
+}
+
+// OpenAISpeechSynthesizer uses the OpenAI text-to-speech API
+type OpenAISpeechSynthesizer struct {
+	client *openai.Client
+	model  openai.SpeechModel
+	voice  openai.SpeechVoice
+}
+
+// NewOpenAISpeechSynthesizer creates a new OpenAI speech synthesizer that
+// sends requests to baseURL, or to the OpenAI API when it is empty
+func NewOpenAISpeechSynthesizer(apiKey, baseURL string) *OpenAISpeechSynthesizer {
+	return &OpenAISpeechSynthesizer{
+		client: newOpenAIClient(apiKey, baseURL),
+		model:  openai.TTSModel1,
+		voice:  openai.VoiceAlloy,
+	}
+}
+
+// Name returns the synthesizer name
+func (s *OpenAISpeechSynthesizer) Name() string {
+	return "openai-" + string(s.model) + "-" + string(s.voice)
+}
+
+// Synthesize generates MP3 audio for the text.
+// The OpenAI voices are multilingual and detect the language from the input.
+func (s *OpenAISpeechSynthesizer) Synthesize(ctx context.Context, text, language string) ([]byte, string, error) {
+	resp, err := s.client.CreateSpeech(ctx, openai.CreateSpeechRequest{
+		Model:          s.model,
+		Input:          text,
+		Voice:          s.voice,
+		ResponseFormat: openai.SpeechResponseFormatMp3,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating speech: %w", err)
+	}
+	defer resp.Close()
+
+	audio, err := io.ReadAll(resp)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading speech response: %w", err)
+	}
+
+	return audio, "audio/mpeg", nil
+}
+
+// CommandSpeechSynthesizer runs a local text-to-speech program such as
+// espeak-ng or piper that writes WAV audio to stdout.
+//
+// The text is written to the program's stdin, and the command line may
+// contain the placeholder {lang}. Commands that only take the text as an
+// argument may use the placeholder {text}, which is preceded by "--" so a word
+// starting with a dash is not read as an option.
+//
+//	espeak-ng -v {lang} --stdout --stdin
+//	piper --model /voices/{lang}.onnx --output_file -
+type CommandSpeechSynthesizer struct {
+	args []string
+}
+
+// NewCommandSpeechSynthesizer creates a new command based speech synthesizer
+func NewCommandSpeechSynthesizer(command string) (*CommandSpeechSynthesizer, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("text-to-speech command is empty")
+	}
+	return &CommandSpeechSynthesizer{args: args}, nil
+}
+
+// Name returns the synthesizer name
+func (s *CommandSpeechSynthesizer) Name() string {
+	return "command-" + strings.Join(s.args, " ")
+}
+
+// Synthesize runs the configured command and returns its WAV output
+func (s *CommandSpeechSynthesizer) Synthesize(ctx context.Context, text, language string) ([]byte, string, error) {
+	lang, ok := LanguageCode(language)
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported language: %s", language)
+	}
+
+	cmd := exec.CommandContext(ctx, s.args[0], s.commandArgs(text, lang)...)
+	cmd.Stdin = strings.NewReader(text)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, "", fmt.Errorf("error running text-to-speech command: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return nil, "", errors.New("text-to-speech command produced no audio")
+	}
+
+	return stdout.Bytes(), "audio/wav", nil
+}
+
+// commandArgs substitutes the placeholders in the arguments of the command.
+// The text only replaces a {text} argument of its own, behind "--", so it can
+// never add or change options.
+func (s *CommandSpeechSynthesizer) commandArgs(text, lang string) []string {
+	args := make([]string, 0, len(s.args))
+	for i, arg := range s.args[1:] {
+		if arg == "{text}" {
+			if s.args[i] != "--" {
+				args = append(args, "--")
+			}
+			args = append(args, text)
+			continue
+		}
+		args = append(args, strings.ReplaceAll(arg, "{lang}", lang))
+	}
+	return args
+}
+
+// MockSpeechSynthesizer returns a short silent WAV file for every request
+type MockSpeechSynthesizer struct{}
+
+// Name returns the synthesizer name
+func (MockSpeechSynthesizer) Name() string {
+	return "mock"
+}
+
+// Synthesize returns half a second of silence
+func (MockSpeechSynthesizer) Synthesize(ctx context.Context, text, language string) ([]byte, string, error) {
+	return silentWAV(8000, 4000), "audio/wav", nil
+}
+
+// silentWAV builds a mono 16-bit PCM WAV file containing only silence
+func silentWAV(sampleRate, samples int) []byte {
+	dataSize := samples * 2
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))           // fmt chunk size
+	binary.Write(&buf, binary.LittleEndian, uint16(1))            // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(1))            // mono
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))   // sample rate
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2)) // byte rate
+	binary.Write(&buf, binary.LittleEndian, uint16(2))            // block align
+	binary.Write(&buf, binary.LittleEndian, uint16(16))           // bits per sample
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	buf.Write(make([]byte, dataSize))
+	return buf.Bytes()
+}
+
+// AudioFile is a synthesized audio file stored in the audio cache
+type AudioFile struct {
+	Path        string
+	ContentType string
+	// Hash is the SHA-256 of the audio content, it doubles as an ETag
+	Hash string
+}
+
+// audioExtensions maps audio content types to file extensions
+var audioExtensions = map[string]string{
+	"audio/mpeg": ".mp3",
+	"audio/wav":  ".wav",
+}
+
+// AudioService synthesizes pronunciation audio and caches it on disk.
+//
+// Audio is stored content-addressed under objects/ by the SHA-256 of its
+// bytes, and refs/ maps each synthesizer, language and text to an object.
+type AudioService struct {
+	synthesizer SpeechSynthesizer
+	cacheDir    string
+	// Concurrent requests for the same word only synthesize it once
+	locks fileLocks
+}
+
+// NewAudioService creates a new audio service
+func NewAudioService(synthesizer SpeechSynthesizer, cacheDir string) *AudioService {
+	return &AudioService{
+		synthesizer: synthesizer,
+		cacheDir:    cacheDir,
+	}
+}
+
+// GetAudio returns the audio file for the text, synthesizing it on a cache miss
+func (s *AudioService) GetAudio(ctx context.Context, text, language string) (*AudioFile, error) {
+	text = strings.TrimSpace(text)
+	language = strings.ToLower(language)
+
+	refPath := s.refPath(text, language)
+	if file, err := s.readRef(refPath); err == nil {
+		debugLogger.Printf("Audio cache hit for %q (%s)", text, language)
+		return file, nil
+	}
+
+	// Another request may have synthesized the word while this one waited for the lock
+	unlock := s.locks.lock(refPath)
+	defer unlock()
+	if file, err := s.readRef(refPath); err == nil {
+		return file, nil
+	}
+
+	debugLogger.Printf("Audio cache miss for %q (%s), synthesizing with %s", text, language, s.synthesizer.Name())
+	audio, contentType, err := s.synthesizer.Synthesize(ctx, text, language)
+	if err != nil {
+		return nil, err
+	}
+
+	ext, ok := audioExtensions[contentType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported audio content type: %s", contentType)
+	}
+
+	sum := sha256.Sum256(audio)
+	hash := hex.EncodeToString(sum[:])
+	objectName := hash + ext
+	objectPath := s.objectPath(objectName)
+
+	if err := writeFileAtomic(objectPath, audio); err != nil {
+		return nil, fmt.Errorf("error writing audio file: %w", err)
+	}
+	if err := writeFileAtomic(refPath, []byte(objectName)); err != nil {
+		return nil, fmt.Errorf("error writing audio reference: %w", err)
+	}
+
+	return &AudioFile{Path: objectPath, ContentType: contentType, Hash: hash}, nil
+}
+
+// refPath returns the path of the reference file for a synthesis request
+func (s *AudioService) refPath(text, language string) string {
+	sum := sha256.Sum256([]byte(s.synthesizer.Name() + "\x00" + language + "\x00" + text))
+	return filepath.Join(s.cacheDir, "refs", hex.EncodeToString(sum[:]))
+}
+
+// objectPath returns the path of a content-addressed audio object
+func (s *AudioService) objectPath(objectName string) string {
+	return filepath.Join(s.cacheDir, "objects", objectName[:2], objectName)
+}
+
+// readRef resolves a reference file to its audio object
+func (s *AudioService) readRef(refPath string) (*AudioFile, error) {
+	data, err := os.ReadFile(refPath)
+	if err != nil {
+		return nil, err
+	}
+
+	objectName := strings.TrimSpace(string(data))
+	ext := filepath.Ext(objectName)
+	objectPath := s.objectPath(objectName)
+	if _, err := os.Stat(objectPath); err != nil {
+		return nil, err
+	}
+
+	contentType := ""
+	for ct, e := range audioExtensions {
+		if e == ext {
+			contentType = ct
+		}
+	}
+
+	return &AudioFile{
+		Path:        objectPath,
+		ContentType: contentType,
+		Hash:        strings.TrimSuffix(objectName, ext),
+	}, nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
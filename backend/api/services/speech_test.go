@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"os/exec"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCommandSpeechSynthesizerKeepsTextOutOfOptions(t *testing.T) {
+	for command, want := range map[string][]string{
+		"espeak-ng -v {lang} --stdout --stdin": {"-v", "nl", "--stdout", "--stdin"},
+		"espeak-ng -v {lang} --stdout {text}":  {"-v", "nl", "--stdout", "--", "-w/tmp/x"},
+		"say -v {lang} -- {text}":              {"-v", "nl", "--", "-w/tmp/x"},
+		"say --text={text}":                    {"--text={text}"},
+	} {
+		s, err := NewCommandSpeechSynthesizer(command)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.commandArgs("-w/tmp/x", "nl"); !slices.Equal(got, want) {
+			t.Errorf("%s: args = %q, want %q", command, got, want)
+		}
+	}
+}
+
+func TestCommandSpeechSynthesizerWritesTextToStdin(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat is not available")
+	}
+	s, err := NewCommandSpeechSynthesizer("cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audio, contentType, err := s.Synthesize(context.Background(), "-w/tmp/x", "dutch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(audio) != "-w/tmp/x" || contentType != "audio/wav" {
+		t.Errorf("got %q (%s), want the text from stdin", audio, contentType)
+	}
+}
+
+// blockingSynthesizer counts syntheses and holds those of one word until released
+type blockingSynthesizer struct {
+	word     string
+	started  chan struct{}
+	release  chan struct{}
+	requests atomic.Int32
+}
+
+func (s *blockingSynthesizer) Name() string {
+	return "blocking"
+}
+
+func (s *blockingSynthesizer) Synthesize(ctx context.Context, text, language string) ([]byte, string, error) {
+	s.requests.Add(1)
+	if text == s.word {
+		close(s.started)
+		<-s.release
+	}
+	return []byte("audio of " + text), "audio/mpeg", nil
+}
+
+func TestAudioServiceLocksPerWord(t *testing.T) {
+	synthesizer := &blockingSynthesizer{word: "bench", started: make(chan struct{}), release: make(chan struct{})}
+	s := NewAudioService(synthesizer, t.TempDir())
+	if _, err := s.GetAudio(context.Background(), "tree", "english"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two requests for the same slow word synthesize it once
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.GetAudio(context.Background(), "bench", "english"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	<-synthesizer.started
+
+	// Other words are served while it is being synthesized
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, word := range []string{"tree", "pond"} {
+			if _, err := s.GetAudio(context.Background(), word, "english"); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("other words waited for the synthesis of bench")
+	}
+
+	close(synthesizer.release)
+	wg.Wait()
+	if n := synthesizer.requests.Load(); n != 3 {
+		t.Errorf("synthesized %d times, want once per word", n)
+	}
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// hardestWordsLimit is the number of hardest words reported per theme
+const hardestWordsLimit = 5
+
+// counters holds running totals of reviews, known answers and answer times
+type counters struct {
+	seen        int
+	known       int
+	timeTotalMs int64
+	timeSamples int
+}
+
+// add applies the difference between two progress items to the counters.
+// A progress item only carries the time of its latest answer, so that time
+// stands in for every review in the delta.
+func (c *counters) add(seenDelta, knownDelta, timeTakenMs int) {
+	c.seen += seenDelta
+	c.known += knownDelta
+	if seenDelta > 0 && timeTakenMs > 0 {
+		c.timeTotalMs += int64(timeTakenMs) * int64(seenDelta)
+		c.timeSamples += seenDelta
+	}
+}
+
+// knownRatio returns the fraction of reviews answered as known
+func (c *counters) knownRatio() float64 {
+	if c.seen <= 0 {
+		return 0
+	}
+	return float64(c.known) / float64(c.seen)
+}
+
+// averageTimeMs returns the average answer time in milliseconds
+func (c *counters) averageTimeMs() float64 {
+	if c.timeSamples == 0 {
+		return 0
+	}
+	return float64(c.timeTotalMs) / float64(c.timeSamples)
+}
+
+// themeAggregate holds a learner's running totals for one theme
+type themeAggregate struct {
+	counters
+	words map[string]*counters
+	days  map[string]*models.DailyStats
+}
+
+// userAggregate holds a learner's running totals across all themes
+type userAggregate struct {
+	counters
+	themes map[string]*themeAggregate
+}
+
+// StatsService aggregates session progress into learner statistics.
+// Aggregates are updated incrementally from progress updates so reads never
+// scan the session store.
+type StatsService struct {
+	users map[string]*userAggregate
+	mu    sync.RWMutex
+}
+
+// NewStatsService creates a new stats service
+func NewStatsService() *StatsService {
+	return &StatsService{
+		users: make(map[string]*userAggregate),
+	}
+}
+
+// RecordProgress applies a progress update to the aggregates, it is a
+// ProgressListener. Counters never go down, regressions are ignored.
+func (s *StatsService) RecordProgress(update ProgressUpdate) {
+	var previous models.ProgressItem
+	if update.Previous != nil {
+		previous = *update.Previous
+	}
+	seenDelta := max(update.Current.SeenCount-previous.SeenCount, 0)
+	knownDelta := max(update.Current.KnownCount-previous.KnownCount, 0)
+	if seenDelta == 0 && knownDelta == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[update.UserID]
+	if !ok {
+		user = &userAggregate{themes: make(map[string]*themeAggregate)}
+		s.users[update.UserID] = user
+	}
+
+	theme, ok := user.themes[update.ThemeID]
+	if !ok {
+		theme = &themeAggregate{
+			words: make(map[string]*counters),
+			days:  make(map[string]*models.DailyStats),
+		}
+		user.themes[update.ThemeID] = theme
+	}
+
+	date := update.At.UTC().Format("2006-01-02")
+	day, ok := theme.days[date]
+	if !ok {
+		day = &models.DailyStats{Date: date}
+		theme.days[date] = day
+	}
+
+	word, ok := theme.words[update.Current.Word]
+	if !ok {
+		word = &counters{}
+		theme.words[update.Current.Word] = word
+		day.NewWords++
+	}
+
+	timeTaken := update.Current.TimeTaken
+	word.add(seenDelta, knownDelta, timeTaken)
+	theme.add(seenDelta, knownDelta, timeTaken)
+	user.add(seenDelta, knownDelta, timeTaken)
+	day.Reviews += seenDelta
+	day.Known += knownDelta
+}
+
+// GetStats returns the statistics of a user, optionally limited to one theme
+func (s *StatsService) GetStats(userID, themeID string) models.UserStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := models.UserStats{
+		UserID: userID,
+		Themes: []models.ThemeStats{},
+	}
+
+	user, ok := s.users[userID]
+	if !ok {
+		return stats
+	}
+
+	totals := user.counters
+	if themeID != "" {
+		totals = counters{}
+		if theme, ok := user.themes[themeID]; ok {
+			totals = theme.counters
+		}
+	}
+	stats.TotalReviews = totals.seen
+	stats.KnownRatio = totals.knownRatio()
+	stats.AverageTimeMs = totals.averageTimeMs()
+
+	for id, theme := range user.themes {
+		if themeID != "" && id != themeID {
+			continue
+		}
+		stats.WordsSeen += len(theme.words)
+		stats.Themes = append(stats.Themes, theme.stats(id))
+	}
+
+	sort.Slice(stats.Themes, func(i, j int) bool {
+		return stats.Themes[i].ThemeID < stats.Themes[j].ThemeID
+	})
+
+	return stats
+}
+
+// stats builds the API representation of a theme aggregate
+func (t *themeAggregate) stats(themeID string) models.ThemeStats {
+	stats := models.ThemeStats{
+		ThemeID:       themeID,
+		WordsSeen:     len(t.words),
+		TotalReviews:  t.seen,
+		KnownRatio:    t.knownRatio(),
+		AverageTimeMs: t.averageTimeMs(),
+		HardestWords:  make([]models.WordStats, 0, len(t.words)),
+		Timeline:      make([]models.DailyStats, 0, len(t.days)),
+	}
+
+	for word, c := range t.words {
+		if c.seen <= 0 {
+			continue
+		}
+		stats.HardestWords = append(stats.HardestWords, models.WordStats{
+			Word:       word,
+			SeenCount:  c.seen,
+			KnownCount: c.known,
+			KnownRatio: c.knownRatio(),
+		})
+	}
+	// Lowest known ratio first, words reviewed more often break ties
+	sort.Slice(stats.HardestWords, func(i, j int) bool {
+		a, b := stats.HardestWords[i], stats.HardestWords[j]
+		if a.KnownRatio != b.KnownRatio {
+			return a.KnownRatio < b.KnownRatio
+		}
+		if a.SeenCount != b.SeenCount {
+			return a.SeenCount > b.SeenCount
+		}
+		return a.Word < b.Word
+	})
+	if len(stats.HardestWords) > hardestWordsLimit {
+		stats.HardestWords = stats.HardestWords[:hardestWordsLimit]
+	}
+
+	for _, day := range t.days {
+		stats.Timeline = append(stats.Timeline, *day)
+	}
+	sort.Slice(stats.Timeline, func(i, j int) bool {
+		return stats.Timeline[i].Date < stats.Timeline[j].Date
+	})
+
+	return stats
+}
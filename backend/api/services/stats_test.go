@@ -0,0 +1,90 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// report records the change of the progress on a word of the park theme,
+// previous is nil for words seen for the first time
+func report(t *testing.T, s *StatsService, at string, previous *models.ProgressItem, current models.ProgressItem) {
+	t.Helper()
+	s.RecordProgress(ProgressUpdate{UserID: "u1", ThemeID: "park", Previous: previous, Current: current, At: mustTime(t, at)})
+}
+
+func TestStatsAppliesDeltas(t *testing.T) {
+	s := NewStatsService()
+
+	report(t, s, "2026-03-02T10:00:00Z", nil, models.ProgressItem{Word: "tree", SeenCount: 1, TimeTaken: 1000})
+	report(t, s, "2026-03-02T10:01:00Z",
+		&models.ProgressItem{Word: "tree", SeenCount: 1, TimeTaken: 1000},
+		models.ProgressItem{Word: "tree", SeenCount: 2, KnownCount: 1, TimeTaken: 3000})
+	// An update without a change is not a review
+	report(t, s, "2026-03-02T10:02:00Z",
+		&models.ProgressItem{Word: "tree", SeenCount: 2, KnownCount: 1},
+		models.ProgressItem{Word: "tree", SeenCount: 2, KnownCount: 1, TimeTaken: 9000})
+
+	stats := s.GetStats("u1", "")
+	if stats.WordsSeen != 1 || stats.TotalReviews != 2 || stats.KnownRatio != 0.5 || stats.AverageTimeMs != 2000 {
+		t.Errorf("stats = %+v, want 1 word, 2 reviews, ratio 0.5 and 2000ms", stats)
+	}
+	want := models.DailyStats{Date: "2026-03-02", Reviews: 2, Known: 1, NewWords: 1}
+	if timeline := stats.Themes[0].Timeline; len(timeline) != 1 || timeline[0] != want {
+		t.Errorf("timeline = %+v, want %+v", timeline, want)
+	}
+}
+
+func TestStatsIgnoresRegressions(t *testing.T) {
+	s := NewStatsService()
+
+	report(t, s, "2026-03-02T10:00:00Z", nil, models.ProgressItem{Word: "tree", SeenCount: 3, KnownCount: 2, TimeTaken: 1000})
+	report(t, s, "2026-03-02T10:01:00Z",
+		&models.ProgressItem{Word: "tree", SeenCount: 3, KnownCount: 2},
+		models.ProgressItem{Word: "tree", SeenCount: 2, KnownCount: 1, TimeTaken: 5000})
+	// Only the growing counter is applied
+	report(t, s, "2026-03-02T10:02:00Z",
+		&models.ProgressItem{Word: "tree", SeenCount: 3, KnownCount: 2},
+		models.ProgressItem{Word: "tree", SeenCount: 3, KnownCount: 3})
+
+	stats := s.GetStats("u1", "park")
+	if stats.TotalReviews != 3 || stats.KnownRatio != 1 || stats.AverageTimeMs != 1000 {
+		t.Errorf("stats = %+v, want 3 reviews, ratio 1 and 1000ms", stats)
+	}
+	if day := stats.Themes[0].Timeline[0]; day.Reviews != 3 || day.Known != 3 {
+		t.Errorf("day = %+v, want 3 reviews and 3 known", day)
+	}
+}
+
+func TestStatsAppliesMultiWordDeltas(t *testing.T) {
+	s := NewStatsService()
+
+	// One session update that reports several reviews on several words
+	report(t, s, "2026-03-02T10:00:00Z", nil, models.ProgressItem{Word: "tree", SeenCount: 3, KnownCount: 1, TimeTaken: 1000})
+	report(t, s, "2026-03-02T10:00:00Z", nil, models.ProgressItem{Word: "pond", SeenCount: 1, KnownCount: 1, TimeTaken: 5000})
+	report(t, s, "2026-03-03T10:00:00Z",
+		&models.ProgressItem{Word: "pond", SeenCount: 1, KnownCount: 1},
+		models.ProgressItem{Word: "pond", SeenCount: 3, KnownCount: 3, TimeTaken: 3000})
+
+	stats := s.GetStats("u1", "")
+	// Each review counts as one time sample: (3*1000 + 5000 + 2*3000) / 6
+	if stats.WordsSeen != 2 || stats.TotalReviews != 6 || stats.KnownRatio != 4.0/6 || stats.AverageTimeMs != 14000.0/6 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	theme := stats.Themes[0]
+	if hardest := theme.HardestWords; len(hardest) != 2 || hardest[0].Word != "tree" || hardest[0].SeenCount != 3 || hardest[0].KnownCount != 1 {
+		t.Errorf("hardest words = %+v, want tree first", hardest)
+	}
+	want := []models.DailyStats{
+		{Date: "2026-03-02", Reviews: 4, Known: 2, NewWords: 2},
+		{Date: "2026-03-03", Reviews: 2, Known: 2},
+	}
+	if len(theme.Timeline) != len(want) || theme.Timeline[0] != want[0] || theme.Timeline[1] != want[1] {
+		t.Errorf("timeline = %+v, want %+v", theme.Timeline, want)
+	}
+
+	if other := s.GetStats("u1", "space"); other.TotalReviews != 0 || len(other.Themes) != 0 {
+		t.Errorf("other theme stats = %+v, want none", other)
+	}
+}
@@ -1,35 +1,174 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/yourusername/picto-lingua-backend/api/models"
 )
 
 const (
-	unsplashBaseURL = "https://api.unsplash.com"
+	// defaultUnsplashBaseURL is the Unsplash API used when no other base URL is configured
+	defaultUnsplashBaseURL = "https://api.unsplash.com"
+	// downloadTrackingWindow is how long repeated selections of an image by
+	// the same learner count as one selection
+	downloadTrackingWindow = time.Hour
+	// downloadTrackingTimeout limits a download tracking request
+	downloadTrackingTimeout = 10 * time.Second
+	// unsplashRateLimitWindow is how often Unsplash refills its quota
+	unsplashRateLimitWindow = time.Hour
+	// randomImageCandidates is the number of random images fetched at once, so
+	// one that passes moderation can be picked
+	randomImageCandidates = 3
 )
 
+// unsplashPhoto is a photo as returned by the Unsplash API
+type unsplashPhoto struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	CreatedAt   string `json:"created_at"`
+	BlurHash    string `json:"blur_hash"`
+	Color       string `json:"color"`
+	// AltDescription and Tags are only used for moderation
+	AltDescription string `json:"alt_description"`
+	Tags           []struct {
+		Title string `json:"title"`
+	} `json:"tags"`
+	URLs struct {
+		Raw     string `json:"raw"`
+		Regular string `json:"regular"`
+		Small   string `json:"small"`
+	} `json:"urls"`
+	Links struct {
+		Download string `json:"download"`
+		HTML     string `json:"html"`
+	} `json:"links"`
+	User struct {
+		Name         string `json:"name"`
+		PortfolioURL string `json:"portfolio_url"`
+		Links        struct {
+			HTML string `json:"html"`
+		} `json:"links"`
+	} `json:"user"`
+}
+
+// toImage maps an Unsplash photo to our model
+func (p *unsplashPhoto) toImage() models.Image {
+	// Apply dynamic resizing parameters
+	resizedURL := p.URLs.Regular + "&w=800&h=600&fit=crop&crop=entropy"
+
+	// Create attribution string
+	attribution := fmt.Sprintf("Photo by %s on Unsplash", p.User.Name)
+
+	return models.Image{
+		ID:                p.ID,
+		URL:               resizedURL,
+		DownloadURL:       p.Links.Download,
+		Description:       p.Description,
+		Width:             p.Width,
+		Height:            p.Height,
+		CreatedAt:         p.CreatedAt,
+		BlurHash:          p.BlurHash,
+		Color:             p.Color,
+		Provider:          "unsplash",
+		SourceURL:         p.Links.HTML,
+		Photographer:      p.User.Name,
+		PhotographerURL:   p.User.Links.HTML,
+		UnsplashURL:       p.Links.HTML,
+		AttributionString: attribution,
+	}
+}
+
 // UnsplashService handles communication with the Unsplash API
 type UnsplashService struct {
-	apiKey string
-	client *http.Client
+	apiKey  string
+	baseURL string
+	client  *http.Client
+
+	// Images whose description or tags contain a blocked term are not shown
+	blocklist *Blocklist
+	// Quota reported by the rate limit headers
+	limits *rateLimit
+	// Download tracking by selector and image ID to the time it was sent
+	trackedDownloads map[string]time.Time
+	lastPruned       time.Time
+	tracking         sync.WaitGroup
+	mu               sync.RWMutex
 }
 
-// NewUnsplashService creates a new Unsplash service
-func NewUnsplashService(apiKey string) *UnsplashService {
+// NewUnsplashService creates a new Unsplash service that leaves out images
+// matching the blocklist. It uses the public API when baseURL is empty.
+func NewUnsplashService(apiKey, baseURL string, blocklist *Blocklist) *UnsplashService {
 	return &UnsplashService{
-		apiKey: apiKey,
-		client: &http.Client{},
+		apiKey:           apiKey,
+		baseURL:          apiBaseURL(baseURL, defaultUnsplashBaseURL),
+		client:           &http.Client{},
+		blocklist:        blocklist,
+		limits:           newRateLimit("unsplash", unsplashRateLimitWindow),
+		trackedDownloads: make(map[string]time.Time),
+	}
+}
+
+// Name returns the provider name
+func (s *UnsplashService) Name() string {
+	return "unsplash"
+}
+
+// Configured reports whether an API key is set
+func (s *UnsplashService) Configured() bool {
+	return s.apiKey != ""
+}
+
+// RateLimitRemaining returns how many requests are left in the current rate limit
+// window, as reported by the last response. It returns false before the first response.
+func (s *UnsplashService) RateLimitRemaining() (int, bool) {
+	return s.limits.remainingRequests()
+}
+
+// rateLimits returns the tracker of the Unsplash quota
+func (s *UnsplashService) rateLimits() *rateLimit {
+	return s.limits
+}
+
+// do sends an authorized request, records the rate limit headers and checks the status
+func (s *UnsplashService) do(req *http.Request) (*http.Response, error) {
+	// Add authorization header
+	req.Header.Add("Authorization", fmt.Sprintf("Client-ID %s", s.apiKey))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
 	}
+
+	s.limits.update(resp.Header)
+
+	// Check response status, Unsplash answers 403 once the hourly limit is used up
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusTooManyRequests ||
+			(resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-Ratelimit-Remaining") == "0") {
+			return nil, s.limits.exhausted(resp.Header)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("unsplash: %w", ErrImageNotFound)
+		}
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return resp, nil
 }
 
 // SearchImages searches for images based on a query
 func (s *UnsplashService) SearchImages(query string, count int) ([]models.Image, error) {
-	endpoint := fmt.Sprintf("%s/search/photos", unsplashBaseURL)
+	endpoint := fmt.Sprintf("%s/search/photos", s.baseURL)
 
 	// Build the URL with query parameters
 	u, err := url.Parse(endpoint)
@@ -41,6 +180,7 @@ func (s *UnsplashService) SearchImages(query string, count int) ([]models.Image,
 	q.Set("query", query)
 	q.Set("per_page", fmt.Sprintf("%d", count))
 	q.Set("orientation", "landscape") // Prefer landscape for better display
+	q.Set("content_filter", "high")   // Picto Lingua is used with children
 	u.RawQuery = q.Encode()
 
 	// Create the request
@@ -49,74 +189,29 @@ func (s *UnsplashService) SearchImages(query string, count int) ([]models.Image,
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
-	// Add authorization header
-	req.Header.Add("Authorization", fmt.Sprintf("Client-ID %s", s.apiKey))
-
 	// Perform the request
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
 	// Parse the response
 	var searchResponse struct {
-		Results []struct {
-			ID          string `json:"id"`
-			Description string `json:"description"`
-			Width       int    `json:"width"`
-			Height      int    `json:"height"`
-			CreatedAt   string `json:"created_at"`
-			URLs        struct {
-				Raw     string `json:"raw"`
-				Regular string `json:"regular"`
-				Small   string `json:"small"`
-			} `json:"urls"`
-			Links struct {
-				Download string `json:"download"`
-				HTML     string `json:"html"`
-			} `json:"links"`
-			User struct {
-				Name         string `json:"name"`
-				PortfolioURL string `json:"portfolio_url"`
-				Links        struct {
-					HTML string `json:"html"`
-				} `json:"links"`
-			} `json:"user"`
-		} `json:"results"`
+		Results []unsplashPhoto `json:"results"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&searchResponse); err != nil {
 		return nil, fmt.Errorf("error decoding response: %w", err)
 	}
 
-	// Map the response to our model
+	// Map the response to our model, leaving out images that are not suitable for children
 	images := make([]models.Image, 0, len(searchResponse.Results))
 	for _, result := range searchResponse.Results {
-		// Apply dynamic resizing parameters
-		resizedURL := result.URLs.Regular + "&w=800&h=600&fit=crop&crop=entropy"
-
-		// Create attribution string
-		attribution := fmt.Sprintf("Photo by %s on Unsplash", result.User.Name)
-
-		images = append(images, models.Image{
-			ID:                result.ID,
-			URL:               resizedURL,
-			DownloadURL:       result.Links.Download,
-			Description:       result.Description,
-			Width:             result.Width,
-			Height:            result.Height,
-			CreatedAt:         result.CreatedAt,
-			Photographer:      result.User.Name,
-			PhotographerURL:   result.User.Links.HTML,
-			UnsplashURL:       result.Links.HTML,
-			AttributionString: attribution,
-		})
+		if !s.suitable(&result) {
+			continue
+		}
+		images = append(images, result.toImage())
 	}
 
 	return images, nil
@@ -124,7 +219,7 @@ func (s *UnsplashService) SearchImages(query string, count int) ([]models.Image,
 
 // GetRandomImage gets a random image based on a theme
 func (s *UnsplashService) GetRandomImage(theme string) (*models.Image, error) {
-	endpoint := fmt.Sprintf("%s/photos/random", unsplashBaseURL)
+	endpoint := fmt.Sprintf("%s/photos/random", s.baseURL)
 
 	// Build the URL with query parameters
 	u, err := url.Parse(endpoint)
@@ -135,6 +230,8 @@ func (s *UnsplashService) GetRandomImage(theme string) (*models.Image, error) {
 	q := u.Query()
 	q.Set("query", theme)
 	q.Set("orientation", "landscape")
+	q.Set("content_filter", "high")
+	q.Set("count", strconv.Itoa(randomImageCandidates))
 	u.RawQuery = q.Encode()
 
 	// Create the request
@@ -143,69 +240,162 @@ func (s *UnsplashService) GetRandomImage(theme string) (*models.Image, error) {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
-	// Add authorization header
-	req.Header.Add("Authorization", fmt.Sprintf("Client-ID %s", s.apiKey))
-
 	// Perform the request
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	// Parse the response, with a count Unsplash returns a list of random images
+	var results []unsplashPhoto
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
 	}
 
-	// Parse the response
-	var result struct {
-		ID          string `json:"id"`
-		Description string `json:"description"`
-		Width       int    `json:"width"`
-		Height      int    `json:"height"`
-		CreatedAt   string `json:"created_at"`
-		URLs        struct {
-			Raw     string `json:"raw"`
-			Regular string `json:"regular"`
-			Small   string `json:"small"`
-		} `json:"urls"`
-		Links struct {
-			Download string `json:"download"`
-			HTML     string `json:"html"`
-		} `json:"links"`
-		User struct {
-			Name         string `json:"name"`
-			PortfolioURL string `json:"portfolio_url"`
-			Links        struct {
-				HTML string `json:"html"`
-			} `json:"links"`
-		} `json:"user"`
+	// Use the first image that is suitable for children
+	for _, result := range results {
+		if s.suitable(&result) {
+			image := result.toImage()
+			return &image, nil
+		}
+	}
+	return nil, fmt.Errorf("no suitable random image for %q: %w", theme, ErrImageNotFound)
+}
+
+// suitable reports whether a photo may be shown to children, the reason for
+// leaving it out is logged
+func (s *UnsplashService) suitable(p *unsplashPhoto) bool {
+	texts := []string{p.Description, p.AltDescription}
+	for _, tag := range p.Tags {
+		texts = append(texts, tag.Title)
+	}
+
+	if term, ok := s.blocklist.Match(texts...); ok {
+		debugLogger.Printf("Moderation rejected image %s: contains blocked term %q", p.ID, term)
+		return false
+	}
+	return true
+}
+
+// GetImage gets a single image by its Unsplash ID
+func (s *UnsplashService) GetImage(id string) (*models.Image, error) {
+	photo, err := s.getPhoto(id)
+	if err != nil {
+		return nil, err
+	}
+
+	image := photo.toImage()
+	return &image, nil
+}
+
+// ImageSourceURL returns the URL of a JPEG of the image that is at most
+// maxWidth pixels wide, for serving the image from our own servers
+func (s *UnsplashService) ImageSourceURL(id string, maxWidth int) (string, error) {
+	if !s.Configured() {
+		return "", fmt.Errorf("unsplash is not configured: %w", ErrImageNotFound)
+	}
+
+	photo, err := s.getPhoto(id)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s&w=%d&fit=max&fm=jpg&q=90", photo.URLs.Raw, maxWidth), nil
+}
+
+// getPhoto fetches a photo by its Unsplash ID. Photos that are not suitable
+// for children are not found, whoever asks for them.
+func (s *UnsplashService) getPhoto(id string) (*unsplashPhoto, error) {
+	endpoint := fmt.Sprintf("%s/photos/%s", s.baseURL, url.PathEscape(id))
+
+	// Create the request
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
+	// Perform the request
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Parse the response
+	var result unsplashPhoto
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, fmt.Errorf("error decoding response: %w", err)
 	}
+	if !s.suitable(&result) {
+		return nil, fmt.Errorf("unsplash photo %s: %w", id, ErrImageNotFound)
+	}
+	return &result, nil
+}
 
-	// Apply dynamic resizing parameters
-	resizedURL := result.URLs.Regular + "&w=800&h=600&fit=crop&crop=entropy"
+// TrackDownload tells Unsplash that a learner picked an image, as its API
+// guidelines require whenever a photo is used. The request is sent in the
+// background. selector identifies who picked the image, selections of the same
+// image by the same selector within downloadTrackingWindow are tracked once.
+// It reports whether a tracking request was started.
+func (s *UnsplashService) TrackDownload(imageID, selector string) bool {
+	if !s.Configured() {
+		return false
+	}
 
-	// Create attribution string
-	attribution := fmt.Sprintf("Photo by %s on Unsplash", result.User.Name)
+	key := selector + "/" + imageID
+	now := time.Now()
 
-	image := &models.Image{
-		ID:                result.ID,
-		URL:               resizedURL,
-		DownloadURL:       result.Links.Download,
-		Description:       result.Description,
-		Width:             result.Width,
-		Height:            result.Height,
-		CreatedAt:         result.CreatedAt,
-		Photographer:      result.User.Name,
-		PhotographerURL:   result.User.Links.HTML,
-		UnsplashURL:       result.Links.HTML,
-		AttributionString: attribution,
+	s.mu.Lock()
+	if now.Sub(s.lastPruned) > downloadTrackingWindow {
+		for k, tracked := range s.trackedDownloads {
+			if now.Sub(tracked) >= downloadTrackingWindow {
+				delete(s.trackedDownloads, k)
+			}
+		}
+		s.lastPruned = now
 	}
+	if tracked, ok := s.trackedDownloads[key]; ok && now.Sub(tracked) < downloadTrackingWindow {
+		s.mu.Unlock()
+		return false
+	}
+	s.trackedDownloads[key] = now
+	s.mu.Unlock()
+
+	s.tracking.Add(1)
+	go func() {
+		defer s.tracking.Done()
+
+		if err := s.trackDownload(imageID); err != nil {
+			debugLogger.Printf("Error tracking download of image %s: %v", imageID, err)
+			// Forget the selection so the next one is tracked again
+			s.mu.Lock()
+			delete(s.trackedDownloads, key)
+			s.mu.Unlock()
+		}
+	}()
+	return true
+}
+
+// trackDownload calls the download endpoint of an image
+func (s *UnsplashService) trackDownload(imageID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), downloadTrackingTimeout)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%s/photos/%s/download", s.baseURL, url.PathEscape(imageID))
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
 
-	return image, nil
+// Close waits for download tracking requests in flight
+func (s *UnsplashService) Close() {
+	s.tracking.Wait()
 }
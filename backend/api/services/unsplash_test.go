@@ -0,0 +1,151 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeUnsplash records the requests sent to the Unsplash API and answers them with status and body
+type fakeUnsplash struct {
+	status  int
+	body    string
+	header  http.Header
+	paths   []string
+	queries []url.Values
+	mu      sync.Mutex
+}
+
+func (f *fakeUnsplash) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paths = append(f.paths, req.URL.Path)
+	f.queries = append(f.queries, req.URL.Query())
+
+	body := f.body
+	if body == "" {
+		body = `{"url": "https://images.unsplash.com/photo"}`
+	}
+	header := f.header
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		StatusCode: f.status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func (f *fakeUnsplash) requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.paths...)
+}
+
+func newFakeUnsplashService(status int) (*UnsplashService, *fakeUnsplash) {
+	fake := &fakeUnsplash{status: status}
+	s := NewUnsplashService("test-key", "", NewBlocklist(nil))
+	s.client = &http.Client{Transport: fake}
+	return s, fake
+}
+
+func TestTrackDownloadDeduplicatesSelections(t *testing.T) {
+	s, fake := newFakeUnsplashService(http.StatusOK)
+
+	if !s.TrackDownload("abc-123", "user:1") {
+		t.Fatal("first selection was not tracked")
+	}
+	if s.TrackDownload("abc-123", "user:1") {
+		t.Error("repeated selection was tracked again")
+	}
+	if !s.TrackDownload("abc-123", "user:2") {
+		t.Error("selection by another learner was not tracked")
+	}
+	s.Close()
+
+	requests := fake.requests()
+	if len(requests) != 2 {
+		t.Fatalf("sent %d tracking requests, want 2", len(requests))
+	}
+	if requests[0] != "/photos/abc-123/download" {
+		t.Errorf("tracked %s, want /photos/abc-123/download", requests[0])
+	}
+}
+
+func TestTrackDownloadRetriesAfterFailure(t *testing.T) {
+	s, fake := newFakeUnsplashService(http.StatusInternalServerError)
+
+	s.TrackDownload("abc-123", "user:1")
+	s.Close()
+	if !s.TrackDownload("abc-123", "user:1") {
+		t.Error("selection was not tracked again after the tracking request failed")
+	}
+	s.Close()
+
+	if requests := fake.requests(); len(requests) != 2 {
+		t.Errorf("sent %d tracking requests, want 2", len(requests))
+	}
+}
+
+func TestTrackDownloadWithoutKey(t *testing.T) {
+	s := NewUnsplashService("", "", NewBlocklist(nil))
+	if s.TrackDownload("abc-123", "user:1") {
+		t.Error("tracked a download without an API key")
+	}
+}
+
+func TestSearchImagesLeavesOutBlockedImages(t *testing.T) {
+	s, fake := newFakeUnsplashService(http.StatusOK)
+	fake.body = `{"results": [
+		{"id": "ok", "description": "A bench in the park", "tags": [{"title": "park"}]},
+		{"id": "tagged", "description": "A park", "tags": [{"title": "Guns"}]},
+		{"id": "described", "alt_description": "people smoking a cigarette"}
+	]}`
+
+	images, err := s.SearchImages("park", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || images[0].ID != "ok" {
+		t.Errorf("got %+v, want only the image without blocked terms", images)
+	}
+	if got := fake.queries[0].Get("content_filter"); got != "high" {
+		t.Errorf("content_filter = %q, want high", got)
+	}
+}
+
+func TestGetRandomImagePicksSuitableImage(t *testing.T) {
+	s, fake := newFakeUnsplashService(http.StatusOK)
+	fake.body = `[{"id": "blocked", "tags": [{"title": "casino"}]}, {"id": "ok"}]`
+
+	image, err := s.GetRandomImage("city")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.ID != "ok" {
+		t.Errorf("got image %s, want ok", image.ID)
+	}
+
+	fake.body = `[{"id": "blocked", "tags": [{"title": "casino"}]}]`
+	if _, err := s.GetRandomImage("city"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("err = %v, want ErrImageNotFound", err)
+	}
+}
+
+func TestGetImageLeavesOutBlockedImages(t *testing.T) {
+	s, fake := newFakeUnsplashService(http.StatusOK)
+	fake.body = `{"id": "tagged", "description": "A park", "tags": [{"title": "Guns"}], "urls": {"raw": "https://images.unsplash.com/photo-1"}}`
+
+	if _, err := s.GetImage("tagged"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("err = %v, want ErrImageNotFound", err)
+	}
+	if _, err := s.ImageSourceURL("tagged", 1600); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("err = %v, want ErrImageNotFound for the source URL", err)
+	}
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// ErrBudgetExceeded is returned when vocabulary is not cached and the daily OpenAI budget has been spent
+var ErrBudgetExceeded = errors.New("daily OpenAI budget exceeded")
+
+// Over budget modes
+const (
+	// OverBudgetCacheOnly serves cached vocabulary only
+	OverBudgetCacheOnly = "cache-only"
+	// OverBudgetMock serves mock vocabulary when it is not cached
+	OverBudgetMock = "mock"
+)
+
+// usageTotals are the persisted token counts
+type usageTotals struct {
+	Total  models.TokenUsage             `json:"total"`
+	Days   map[string]*models.TokenUsage `json:"days"`
+	Models map[string]*models.TokenUsage `json:"models"`
+	Themes map[string]*models.ThemeUsage `json:"themes"` // by theme and language
+}
+
+// UsageTracker records the OpenAI tokens used to generate vocabulary and what
+// they cost, and enforces a daily budget. Totals are written to a JSON file
+// after every request, without a path they only live in memory. A nil
+// UsageTracker records nothing and has no budget.
+type UsageTracker struct {
+	path           string
+	pricing        map[string]models.ModelPrice
+	dailyBudget    float64
+	overBudgetMode string
+
+	totals usageTotals
+	mu     sync.RWMutex
+}
+
+// NewUsageTracker creates a usage tracker that prices tokens with pricing, by
+// model name or prefix, and persists the totals in path. With a dailyBudget
+// above zero, vocabulary is served as overBudgetMode once the day's cost reaches it.
+func NewUsageTracker(path string, pricing map[string]models.ModelPrice, dailyBudget float64, overBudgetMode string) *UsageTracker {
+	if overBudgetMode != OverBudgetMock {
+		overBudgetMode = OverBudgetCacheOnly
+	}
+
+	t := &UsageTracker{
+		path:           path,
+		pricing:        pricing,
+		dailyBudget:    dailyBudget,
+		overBudgetMode: overBudgetMode,
+		totals: usageTotals{
+			Days:   make(map[string]*models.TokenUsage),
+			Models: make(map[string]*models.TokenUsage),
+			Themes: make(map[string]*models.ThemeUsage),
+		},
+	}
+	t.load()
+	return t
+}
+
+// load reads the persisted totals, starting from zero when there are none
+func (t *UsageTracker) load() {
+	if t.path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			debugLogger.Printf("Error reading usage totals: %v", err)
+		}
+		return
+	}
+
+	var totals usageTotals
+	if err := json.Unmarshal(data, &totals); err != nil {
+		debugLogger.Printf("Error parsing usage totals %s, starting from zero: %v", t.path, err)
+		return
+	}
+	for name, usage := range totals.Days {
+		t.totals.Days[name] = usage
+	}
+	for name, usage := range totals.Models {
+		t.totals.Models[name] = usage
+	}
+	for name, usage := range totals.Themes {
+		t.totals.Themes[name] = usage
+	}
+	t.totals.Total = totals.Total
+}
+
+// price returns the price of a model. Models are matched by the longest
+// priced name they start with, so snapshots such as "gpt-4o-mini-2024-07-18"
+// get the price of "gpt-4o-mini".
+func (t *UsageTracker) price(model string) (models.ModelPrice, bool) {
+	var price models.ModelPrice
+	matched := ""
+	for name, p := range t.pricing {
+		if strings.HasPrefix(model, name) && len(name) > len(matched) {
+			price, matched = p, name
+		}
+	}
+	return price, matched != ""
+}
+
+// Record adds the tokens of a completion for a theme and language to the totals and persists them
+func (t *UsageTracker) Record(model, theme, language string, usage openai.Usage) {
+	if t == nil {
+		return
+	}
+
+	price, ok := t.price(model)
+	if !ok {
+		debugLogger.Printf("WARNING: No price for model %s, its tokens are recorded without cost", model)
+	}
+	tokens := models.TokenUsage{
+		Requests:         1,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Cost:             (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6,
+	}
+	debugLogger.Printf("OpenAI usage for %s in %s with %s: %d prompt and %d completion tokens, $%.6f",
+		theme, language, model, tokens.PromptTokens, tokens.CompletionTokens, tokens.Cost)
+
+	t.mu.Lock()
+	addUsage(&t.totals.Total, tokens)
+	addUsage(usageEntry(t.totals.Days, today()), tokens)
+	addUsage(usageEntry(t.totals.Models, model), tokens)
+
+	key := theme + "/" + language
+	themeUsage, ok := t.totals.Themes[key]
+	if !ok {
+		themeUsage = &models.ThemeUsage{Theme: theme, Language: language}
+		t.totals.Themes[key] = themeUsage
+	}
+	addUsage(&themeUsage.TokenUsage, tokens)
+
+	data, err := json.MarshalIndent(t.totals, "", "  ")
+	t.mu.Unlock()
+
+	if t.path == "" {
+		return
+	}
+	if err == nil {
+		err = writeFileAtomic(t.path, data)
+	}
+	if err != nil {
+		debugLogger.Printf("Error saving usage totals: %v", err)
+	}
+}
+
+// charsPerToken is the rough number of characters in a token of English text
+const charsPerToken = 4
+
+// estimateUsage estimates the tokens of a completion whose usage OpenAI did
+// not report, from the length of the prompt and of the completion received so
+// far. Bytes are counted rather than characters, which overestimates text
+// outside ASCII, so an estimate errs on the side of the budget.
+func estimateUsage(prompt Prompt, completion string) openai.Usage {
+	tokens := func(text string) int {
+		return (len(text) + charsPerToken - 1) / charsPerToken
+	}
+	usage := openai.Usage{
+		PromptTokens:     tokens(prompt.System) + tokens(prompt.User),
+		CompletionTokens: tokens(completion),
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// usageEntry returns the usage stored under key, adding it when it does not exist
+func usageEntry(usages map[string]*models.TokenUsage, key string) *models.TokenUsage {
+	usage, ok := usages[key]
+	if !ok {
+		usage = &models.TokenUsage{}
+		usages[key] = usage
+	}
+	return usage
+}
+
+// addUsage adds tokens to a usage
+func addUsage(usage *models.TokenUsage, tokens models.TokenUsage) {
+	usage.Requests += tokens.Requests
+	usage.PromptTokens += tokens.PromptTokens
+	usage.CompletionTokens += tokens.CompletionTokens
+	usage.Cost += tokens.Cost
+}
+
+// today returns the current UTC date, the budget is reset at midnight UTC
+func today() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+// OverBudget reports whether today's cost has reached the daily budget
+func (t *UsageTracker) OverBudget() bool {
+	if t == nil || t.dailyBudget <= 0 {
+		return false
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	usage, ok := t.totals.Days[today()]
+	return ok && usage.Cost >= t.dailyBudget
+}
+
+// OverBudgetMode returns how vocabulary is served once the budget is exceeded
+func (t *UsageTracker) OverBudgetMode() string {
+	if t == nil {
+		return OverBudgetCacheOnly
+	}
+	return t.overBudgetMode
+}
+
+// BudgetResetIn returns how long until the daily budget is reset
+func (t *UsageTracker) BudgetResetIn() time.Duration {
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return midnight.Sub(now)
+}
+
+// budgetError returns the error for vocabulary that cannot be generated within the budget
+func (t *UsageTracker) budgetError() error {
+	return fmt.Errorf("%w, resets in %s", ErrBudgetExceeded, t.BudgetResetIn().Round(time.Minute))
+}
+
+// Report returns the token totals and the state of the budget
+func (t *UsageTracker) Report() models.UsageReport {
+	report := models.UsageReport{
+		Days:   make(map[string]models.TokenUsage),
+		Models: make(map[string]models.TokenUsage),
+		Themes: []models.ThemeUsage{},
+	}
+	if t == nil {
+		return report
+	}
+
+	t.mu.RLock()
+	report.Total = t.totals.Total
+	for day, usage := range t.totals.Days {
+		report.Days[day] = *usage
+	}
+	for model, usage := range t.totals.Models {
+		report.Models[model] = *usage
+	}
+	for _, usage := range t.totals.Themes {
+		report.Themes = append(report.Themes, *usage)
+	}
+	t.mu.RUnlock()
+
+	report.Today = report.Days[today()]
+	sort.Slice(report.Themes, func(i, j int) bool {
+		if report.Themes[i].Cost != report.Themes[j].Cost {
+			return report.Themes[i].Cost > report.Themes[j].Cost
+		}
+		return report.Themes[i].Theme+report.Themes[i].Language < report.Themes[j].Theme+report.Themes[j].Language
+	})
+
+	report.DailyBudget = t.dailyBudget
+	if t.dailyBudget > 0 {
+		report.BudgetExceeded = t.OverBudget()
+		report.OverBudgetMode = t.overBudgetMode
+	}
+	return report
+}
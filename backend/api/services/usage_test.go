@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+var testPricing = map[string]models.ModelPrice{
+	"gpt-3.5-turbo": {Prompt: 0.5, Completion: 1.5},
+	"gpt-4o":        {Prompt: 2.5, Completion: 10},
+	"gpt-4o-mini":   {Prompt: 0.15, Completion: 0.6},
+}
+
+func TestUsageTrackerPricesAndPersistsTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	tracker := NewUsageTracker(path, testPricing, 0, "")
+
+	tracker.Record("gpt-4o-mini-2024-07-18", "park", "english", openai.Usage{PromptTokens: 1_000_000, CompletionTokens: 500_000})
+	tracker.Record("gpt-3.5-turbo", "park", "dutch", openai.Usage{PromptTokens: 2000, CompletionTokens: 1000})
+	tracker.Record("unpriced-model", "cafe", "english", openai.Usage{PromptTokens: 10, CompletionTokens: 10})
+
+	report := NewUsageTracker(path, testPricing, 0, "").Report()
+	if report.Total.Requests != 3 || report.Total.PromptTokens != 1_002_010 || report.Total.CompletionTokens != 501_010 {
+		t.Errorf("total = %+v", report.Total)
+	}
+	// gpt-4o-mini is priced as itself, not as gpt-4o
+	if cost := report.Models["gpt-4o-mini-2024-07-18"].Cost; !closeTo(cost, 0.45) {
+		t.Errorf("gpt-4o-mini cost = %f, want 0.45", cost)
+	}
+	if cost := report.Models["gpt-3.5-turbo"].Cost; !closeTo(cost, 0.0025) {
+		t.Errorf("gpt-3.5-turbo cost = %f, want 0.0025", cost)
+	}
+	if report.Models["unpriced-model"].Cost != 0 {
+		t.Errorf("unpriced model cost %f", report.Models["unpriced-model"].Cost)
+	}
+	if report.Today.Requests != 3 {
+		t.Errorf("today = %+v, want 3 requests", report.Today)
+	}
+
+	if len(report.Themes) != 3 {
+		t.Fatalf("got %d themes, want 3", len(report.Themes))
+	}
+	if top := report.Themes[0]; top.Theme != "park" || top.Language != "english" {
+		t.Errorf("most expensive theme is %s in %s, want park in english", top.Theme, top.Language)
+	}
+}
+
+func closeTo(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
+
+// newBudgetedOpenAIService returns a service with an API key whose daily budget has been spent
+func newBudgetedOpenAIService(mode string) *OpenAIService {
+	usage := NewUsageTracker("", testPricing, 0.01, mode)
+	usage.Record("gpt-3.5-turbo", "park", "english", openai.Usage{PromptTokens: 10_000, CompletionTokens: 10_000})
+
+	s := &OpenAIService{
+		client:     openai.NewClient("test-key"),
+		mockThemes: make(map[string][]models.VocabularyItem),
+		cache:      NewCache("").Namespace("vocabulary", 0),
+		usage:      usage,
+	}
+	s.initMockData()
+	return s
+}
+
+func TestOverBudgetServesCacheOnly(t *testing.T) {
+	s := newBudgetedOpenAIService(OverBudgetCacheOnly)
+	if !s.usage.OverBudget() {
+		t.Fatal("budget of $0.01 is not exceeded after $0.02")
+	}
+
+	_, err := s.GetVocabularyForLanguage("park", 2, "english")
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("err = %v, want ErrBudgetExceeded", err)
+	}
+
+	cached := []models.VocabularyItem{{Word: "bench"}}
+	prompt, err := s.vocabularyPrompt("park", 1, "english")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cacheVocabulary(s.vocabularyCacheKey("park", 1, "english"), prompt.Version, cached)
+	vocabulary, err := s.GetVocabularyForLanguage("park", 1, "english")
+	if err != nil || len(vocabulary) != 1 || vocabulary[0].Word != "bench" {
+		t.Errorf("got %v, %v, want the cached vocabulary", vocabulary, err)
+	}
+
+	report := s.usage.Report()
+	if !report.BudgetExceeded || report.OverBudgetMode != OverBudgetCacheOnly {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestOverBudgetServesMock(t *testing.T) {
+	s := newBudgetedOpenAIService(OverBudgetMock)
+
+	vocabulary, err := s.GetVocabularyForLanguage("park", 2, "english")
+	if err != nil || len(vocabulary) != 2 {
+		t.Fatalf("got %v, %v, want 2 mock items", vocabulary, err)
+	}
+	if s.IsVocabularyCached("park", 2, "english") {
+		t.Error("mock vocabulary was cached as generated vocabulary")
+	}
+}
+
+func TestStreamVocabularyRecordsUsage(t *testing.T) {
+	s := newStreamingServer(t, streamedResponse)
+	s.usage = NewUsageTracker("", testPricing, 0, "")
+
+	if _, err := s.StreamVocabulary(context.Background(), "stream-usage", 3, "english", func(models.VocabularyItem) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	usage := s.usage.Report().Models["gpt-3.5-turbo-0125"]
+	if usage.Requests != 1 || usage.PromptTokens != 120 || usage.CompletionTokens != 80 {
+		t.Errorf("recorded %+v, want the usage of the last chunk", usage)
+	}
+}
+
+func TestStreamVocabularyEstimatesUsageOfAbortedStreams(t *testing.T) {
+	s := newStreamingServer(t, streamedResponse)
+	s.usage = NewUsageTracker("", testPricing, 0, "")
+
+	// The client goes away after the first item, before the usage chunk arrives
+	aborted := errors.New("client went away")
+	if _, err := s.StreamVocabulary(context.Background(), "stream-aborted", 3, "english", func(models.VocabularyItem) error { return aborted }); !errors.Is(err, aborted) {
+		t.Fatalf("err = %v, want %v", err, aborted)
+	}
+
+	report := s.usage.Report()
+	if len(report.Models) != 1 {
+		t.Fatalf("recorded %+v, want one estimate", report.Models)
+	}
+	for model, usage := range report.Models {
+		if model != openai.GPT3Dot5Turbo || usage.Requests != 1 || usage.PromptTokens == 0 || usage.CompletionTokens == 0 || usage.Cost == 0 {
+			t.Errorf("recorded %+v for %s, want an estimate of the prompt and the streamed tokens", usage, model)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// The vocabulary evaluation runs the generator against recorded completions and
+// scores what learners would get. Scores are compared against golden files, so
+// a prompt or model change that makes the vocabulary worse fails the tests.
+//
+//	go test ./api/services -run TestVocabularyEval                  # compare with the golden files
+//	go test ./api/services -run TestVocabularyEval -eval.update     # accept the current scores
+//	OPENAI_API_KEY=... go test ./api/services -run TestVocabularyEval -eval.record
+//
+// Recordings are tied to the prompt version and model. After changing either,
+// record the completions again with -eval.record, which is the only step that
+// needs network access, and commit them with the golden files they score.
+var (
+	evalUpdate = flag.Bool("eval.update", false, "write the vocabulary evaluation scores to the golden files")
+	evalRecord = flag.Bool("eval.record", false, "record vocabulary completions from OpenAI, needs OPENAI_API_KEY")
+)
+
+// evalDir holds the evaluation cases, recorded completions and golden scores
+const evalDir = "testdata/eval"
+
+// evalCase is vocabulary to generate and the keywords that relate words to its theme
+type evalCase struct {
+	Name     string   `json:"name"`
+	Theme    string   `json:"theme"`
+	Language string   `json:"language"`
+	Count    int      `json:"count"`
+	Keywords []string `json:"keywords"`
+}
+
+// evalRecording is a completion recorded for the prompt version and model that requested it
+type evalRecording struct {
+	Model         string `json:"model"`
+	PromptVersion string `json:"prompt_version"`
+	RecordedAt    string `json:"recorded_at"`
+	Content       string `json:"content"`
+}
+
+// vocabularyScore rates generated vocabulary. Fractions are between 0 and 1,
+// higher is better.
+type vocabularyScore struct {
+	ValidJSON bool `json:"valid_json"`
+	Words     int  `json:"words"`
+	// WordCount is 1 when exactly the requested number of words was generated
+	WordCount float64 `json:"word_count"`
+	// ThemeRelevance is the fraction of words that mention a keyword of the theme
+	ThemeRelevance float64 `json:"theme_relevance"`
+	// Translations is the fraction of words with a translation, definition and
+	// example in the second language, 1 when there is no second language
+	Translations float64 `json:"translations"`
+	Duplicates   int     `json:"duplicates"`
+}
+
+func TestVocabularyEval(t *testing.T) {
+	var cases []evalCase
+	readEvalJSON(t, filepath.Join(evalDir, "cases.json"), &cases)
+	if len(cases) == 0 {
+		t.Fatal("no evaluation cases")
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			prompt, err := (*PromptLibrary)(nil).Render("vocabulary", c.Language, vocabularyPromptData{Theme: c.Theme, Count: c.Count, Language: c.Language})
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := vocabularyRequest(prompt)
+
+			recordingPath := filepath.Join(evalDir, "recordings", c.Name+".json")
+			if *evalRecord {
+				recordCompletion(t, recordingPath, request, prompt)
+			}
+			var recording evalRecording
+			readEvalJSON(t, recordingPath, &recording)
+			if recording.PromptVersion != prompt.Version || recording.Model != request.Model {
+				t.Fatalf("recording is for prompt %s with %s, not %s with %s, record it again with -eval.record",
+					recording.PromptVersion, recording.Model, prompt.Version, request.Model)
+			}
+
+			vocabulary, err := newRecordedOpenAIService(t, recording).GetVocabularyForLanguage(c.Theme, c.Count, c.Language)
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if err != nil && !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+				t.Fatal(err)
+			}
+			score := scoreVocabulary(c, vocabulary, err == nil)
+			t.Logf("valid JSON %t, %d/%d words, theme relevance %.3f, translations %.3f, %d duplicates",
+				score.ValidJSON, score.Words, c.Count, score.ThemeRelevance, score.Translations, score.Duplicates)
+
+			goldenPath := filepath.Join(evalDir, "golden", c.Name+".json")
+			if *evalUpdate {
+				writeEvalJSON(t, goldenPath, score)
+				return
+			}
+			if _, err := os.Stat(goldenPath); os.IsNotExist(err) {
+				t.Fatalf("no golden file for %s, create it with -eval.update", c.Name)
+			}
+			var golden vocabularyScore
+			readEvalJSON(t, goldenPath, &golden)
+			for _, regression := range compareScores(score, golden) {
+				t.Error(regression)
+			}
+			if score != golden && !t.Failed() {
+				t.Logf("scores improved on the golden file, accept them with -eval.update")
+			}
+		})
+	}
+}
+
+// newRecordedOpenAIService returns a service whose completions are served from a recording
+func newRecordedOpenAIService(t *testing.T, recording evalRecording) *OpenAIService {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Model != recording.Model {
+			http.Error(w, `{"error": {"message": "request does not match the recording"}}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Model: recording.Model,
+			Choices: []openai.ChatCompletionChoice{{
+				Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: recording.Content},
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	// Moderate as the server does without an OpenAI key, so rejected words count as missing
+	blocklist := NewBlocklist(nil)
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL
+	return &OpenAIService{
+		client:     openai.NewClientWithConfig(config),
+		cache:      NewCache("").Namespace("vocabulary", time.Hour),
+		moderation: NewModerationService(NewBlocklistContentModerator(blocklist), blocklist),
+	}
+}
+
+// recordCompletion asks OpenAI for a completion and saves it as a recording
+func recordCompletion(t *testing.T, path string, request openai.ChatCompletionRequest, prompt Prompt) {
+	t.Helper()
+
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		t.Fatal("recording completions needs OPENAI_API_KEY")
+	}
+	resp, err := openai.NewClient(apiKey).CreateChatCompletion(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEvalJSON(t, path, evalRecording{
+		Model:         request.Model,
+		PromptVersion: prompt.Version,
+		RecordedAt:    time.Now().UTC().Format(time.RFC3339),
+		Content:       resp.Choices[0].Message.Content,
+	})
+}
+
+// scoreVocabulary scores the vocabulary generated for a case
+func scoreVocabulary(c evalCase, vocabulary []models.VocabularyItem, validJSON bool) vocabularyScore {
+	score := vocabularyScore{ValidJSON: validJSON, Words: len(vocabulary)}
+	if !validJSON || len(vocabulary) == 0 {
+		return score
+	}
+
+	score.WordCount = math.Max(0, 1-math.Abs(float64(len(vocabulary)-c.Count))/float64(c.Count))
+
+	relevant, translated := 0, 0
+	seen := make(map[string]bool)
+	for _, item := range vocabulary {
+		text := strings.Join([]string{item.Word, item.Definition, item.Example, item.DutchWord, item.DutchDefinition, item.DutchExample}, " ")
+		if mentionsKeyword(text, c.Keywords) {
+			relevant++
+		}
+		if item.DutchWord != "" && item.DutchDefinition != "" && item.DutchExample != "" {
+			translated++
+		}
+
+		word := strings.ToLower(strings.TrimSpace(item.Word))
+		if seen[word] {
+			score.Duplicates++
+		}
+		seen[word] = true
+	}
+
+	score.ThemeRelevance = roundScore(float64(relevant) / float64(len(vocabulary)))
+	score.Translations = 1
+	if c.Language == "dutch" {
+		score.Translations = roundScore(float64(translated) / float64(len(vocabulary)))
+	}
+	score.WordCount = roundScore(score.WordCount)
+	return score
+}
+
+// mentionsKeyword reports whether a word of text starts with one of the keywords,
+// so "trees" mentions "tree"
+func mentionsKeyword(text string, keywords []string) bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, word := range words {
+		for _, keyword := range keywords {
+			if strings.HasPrefix(word, strings.ToLower(keyword)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// roundScore rounds a fraction to three decimals, so golden files stay readable
+func roundScore(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
+
+// compareScores describes how a score is worse than its golden score
+func compareScores(score, golden vocabularyScore) []string {
+	var regressions []string
+	if golden.ValidJSON && !score.ValidJSON {
+		regressions = append(regressions, "the completion is no longer valid JSON")
+	}
+	for _, metric := range []struct {
+		name         string
+		score, floor float64
+	}{
+		{"word count", score.WordCount, golden.WordCount},
+		{"theme relevance", score.ThemeRelevance, golden.ThemeRelevance},
+		{"translations", score.Translations, golden.Translations},
+	} {
+		if metric.score < metric.floor {
+			regressions = append(regressions, fmt.Sprintf("%s dropped from %.3f to %.3f", metric.name, metric.floor, metric.score))
+		}
+	}
+	if score.Duplicates > golden.Duplicates {
+		regressions = append(regressions, fmt.Sprintf("duplicates rose from %d to %d", golden.Duplicates, score.Duplicates))
+	}
+	return regressions
+}
+
+// readEvalJSON decodes an evaluation file
+func readEvalJSON(t *testing.T, path string, v any) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+}
+
+// writeEvalJSON encodes an evaluation file
+func writeEvalJSON(t *testing.T, path string, v any) {
+	t.Helper()
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScoreVocabulary(t *testing.T) {
+	c := evalCase{Theme: "park", Language: "dutch", Count: 4, Keywords: []string{"park", "tree"}}
+	vocabulary := []models.VocabularyItem{
+		{Word: "tree", Definition: "A tall plant", DutchWord: "boom", DutchDefinition: "Een hoge plant", DutchExample: "De boom is groot."},
+		{Word: "bench", Definition: "A seat", Example: "We sit in the park.", DutchWord: "bank"},
+		{Word: "Tree", Definition: "Trees grow", DutchWord: "boom", DutchDefinition: "Groeit", DutchExample: "Bomen groeien."},
+	}
+
+	got := scoreVocabulary(c, vocabulary, true)
+	want := vocabularyScore{ValidJSON: true, Words: 3, WordCount: 0.75, ThemeRelevance: 1, Translations: 0.667, Duplicates: 1}
+	if got != want {
+		t.Errorf("score = %+v, want %+v", got, want)
+	}
+
+	if regressions := compareScores(vocabularyScore{ValidJSON: true, WordCount: 1, ThemeRelevance: 0.5, Translations: 1}, got); len(regressions) != 1 {
+		t.Errorf("regressions = %v, want theme relevance only", regressions)
+	}
+	if got := scoreVocabulary(c, nil, false); got.ValidJSON || got.WordCount != 0 {
+		t.Errorf("score of invalid JSON = %+v", got)
+	}
+}
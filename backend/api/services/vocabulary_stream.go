@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// vocabularyStreamParser extracts vocabulary items from a JSON array that
+// arrives in pieces. Every object in the array is decoded as soon as its
+// closing brace has been seen, text around the array such as markdown code
+// fences is ignored.
+type vocabularyStreamParser struct {
+	buf         []byte
+	pos         int  // next byte to scan
+	inArray     bool // the opening bracket has been seen
+	done        bool // the closing bracket has been seen
+	depth       int  // nesting depth inside the array
+	inString    bool
+	escaped     bool
+	objectStart int // start of the current top-level object
+}
+
+// Feed adds a chunk of the response and returns the items it completed
+func (p *vocabularyStreamParser) Feed(chunk string) ([]models.VocabularyItem, error) {
+	p.buf = append(p.buf, chunk...)
+
+	var items []models.VocabularyItem
+	for ; p.pos < len(p.buf) && !p.done; p.pos++ {
+		c := p.buf[p.pos]
+
+		if !p.inArray {
+			if c == '[' {
+				p.inArray = true
+			}
+			continue
+		}
+
+		if p.inString {
+			switch {
+			case p.escaped:
+				p.escaped = false
+			case c == '\\':
+				p.escaped = true
+			case c == '"':
+				p.inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			p.inString = true
+		case '{', '[':
+			if p.depth == 0 {
+				p.objectStart = p.pos
+			}
+			p.depth++
+		case '}', ']':
+			if p.depth == 0 {
+				// The end of the array
+				p.done = true
+				continue
+			}
+			p.depth--
+			if p.depth == 0 {
+				var item models.VocabularyItem
+				if err := json.Unmarshal(p.buf[p.objectStart:p.pos+1], &item); err != nil {
+					return items, fmt.Errorf("error parsing vocabulary item: %w", err)
+				}
+				items = append(items, item)
+			}
+		}
+	}
+
+	// Drop what has been parsed, but keep the current object
+	if p.depth > 0 {
+		p.buf = p.buf[p.objectStart:]
+		p.pos -= p.objectStart
+		p.objectStart = 0
+	} else {
+		p.buf = p.buf[p.pos:]
+		p.pos = 0
+	}
+
+	return items, nil
+}
+
+// Complete reports whether the whole array has been parsed
+func (p *vocabularyStreamParser) Complete() bool {
+	return p.done
+}
+
+// StreamVocabulary generates vocabulary for a theme in a language like GetVocabularyForLanguage,
+// but calls onItem with every item as soon as it has passed moderation. Cached
+// vocabulary is replayed, otherwise the completion is streamed and parsed
+// incrementally, and the full list is cached once the stream has finished.
+// Generation stops when ctx is cancelled or onItem returns an error.
+func (s *OpenAIService) StreamVocabulary(ctx context.Context, theme string, count int, language string, onItem func(models.VocabularyItem) error) ([]models.VocabularyItem, error) {
+	language = strings.ToLower(language)
+	cacheKey := s.vocabularyCacheKey(theme, count, language)
+
+	prompt, err := s.vocabularyPrompt(theme, count, language)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := s.cachedVocabulary(cacheKey, prompt.Version); ok {
+		debugLogger.Printf("Cache hit for key: %v, streaming %d vocabulary items", cacheKey, len(cached))
+		for _, item := range cached {
+			if err := onItem(item); err != nil {
+				return nil, err
+			}
+		}
+		return cached, nil
+	}
+
+	// The mock has nothing to stream, generate the list and replay it. Once the
+	// daily budget is spent, GetVocabularyForLanguage serves what the budget allows.
+	if s.useMock || s.client == nil || s.usage.OverBudget() {
+		vocabulary, err := s.GetVocabularyForLanguage(theme, count, language)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range vocabulary {
+			if err := onItem(item); err != nil {
+				return nil, err
+			}
+		}
+		return vocabulary, nil
+	}
+
+	debugLogger.Printf("Streaming vocabulary for theme: %s, count: %d, language: %s", theme, count, language)
+
+	request := vocabularyRequest(prompt)
+	// Streamed completions only report their token usage when asked
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	stream, err := s.client.CreateChatCompletionStream(ctx, request)
+	if err != nil {
+		debugLogger.Printf("Error starting vocabulary stream: %v", err)
+		return nil, fmt.Errorf("error generating vocabulary: %w", err)
+	}
+	defer stream.Close()
+
+	// The usage arrives in the last chunk. A stream that ends before it, because
+	// the client went away or the connection failed, is billed all the same, so
+	// an estimate is counted against the budget instead.
+	var completion strings.Builder
+	usageRecorded := false
+	defer func() {
+		if !usageRecorded {
+			s.usage.Record(request.Model, theme, language, estimateUsage(prompt, completion.String()))
+		}
+	}()
+
+	var parser vocabularyStreamParser
+	vocabulary := make([]models.VocabularyItem, 0, count)
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			debugLogger.Printf("Error reading vocabulary stream: %v", err)
+			return nil, fmt.Errorf("error generating vocabulary: %w", err)
+		}
+		// The usage arrives in a last chunk without choices, after the array is complete
+		if response.Usage != nil {
+			s.usage.Record(usageModel(response.Model, request.Model), theme, language, *response.Usage)
+			usageRecorded = true
+		}
+		if len(response.Choices) == 0 {
+			continue
+		}
+		completion.WriteString(response.Choices[0].Delta.Content)
+		if parser.Complete() {
+			continue
+		}
+
+		items, err := parser.Feed(response.Choices[0].Delta.Content)
+		if err != nil {
+			debugLogger.Printf("Error parsing vocabulary stream: %v", err)
+			return nil, err
+		}
+
+		// Drop transcriptions that are not valid IPA and words that are not suitable for children
+		sanitizeIPA(items)
+		items = s.moderation.FilterVocabulary(ctx, items)
+		for _, item := range items {
+			vocabulary = append(vocabulary, item)
+			if err := onItem(item); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if !parser.Complete() {
+		return nil, errors.New("error parsing vocabulary response: incomplete JSON array")
+	}
+
+	s.cacheVocabulary(cacheKey, prompt.Version, vocabulary)
+	debugLogger.Printf("Streamed and cached %d vocabulary items for key: %v", len(vocabulary), cacheKey)
+
+	return vocabulary, nil
+}
+
+// vocabularyRequest builds the chat completion request that generates vocabulary with a rendered prompt
+func vocabularyRequest(prompt Prompt) openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Model: openai.GPT3Dot5Turbo,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: prompt.System,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt.User,
+			},
+		},
+		Temperature: 0.7,
+	}
+}
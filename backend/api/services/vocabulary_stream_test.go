@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// streamedResponse is a completion as models tend to send it, with a code
+// fence and characters in strings that look like JSON structure
+const streamedResponse = "```json\n[\n" +
+	`  {"word": "bench", "definition": "A seat {for} two", "ipa": "/bɛntʃ/"},` + "\n" +
+	`  {"word": "sign", "definition": "Says \"keep off the [grass]\"", "example": "A \\ sign"},` + "\n" +
+	`  {"word": "tree", "definition": "A tall plant", "ipa": "not ipa!"}` + "\n" +
+	"]\n```"
+
+func TestVocabularyStreamParserHandlesAnySplit(t *testing.T) {
+	for size := 1; size <= len(streamedResponse); size++ {
+		var parser vocabularyStreamParser
+		var words []string
+
+		for start := 0; start < len(streamedResponse); start += size {
+			end := min(start+size, len(streamedResponse))
+			items, err := parser.Feed(streamedResponse[start:end])
+			if err != nil {
+				t.Fatalf("chunk size %d: %v", size, err)
+			}
+			for _, item := range items {
+				words = append(words, item.Word)
+			}
+		}
+
+		if !parser.Complete() {
+			t.Errorf("chunk size %d: array not complete", size)
+		}
+		if got := strings.Join(words, ","); got != "bench,sign,tree" {
+			t.Fatalf("chunk size %d: words = %s", size, got)
+		}
+	}
+}
+
+func TestVocabularyStreamParserDecodesItems(t *testing.T) {
+	var parser vocabularyStreamParser
+	items, err := parser.Feed(streamedResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("got %d items, want 3", len(items))
+	}
+	if want := `Says "keep off the [grass]"`; items[1].Definition != want {
+		t.Errorf("definition = %q, want %q", items[1].Definition, want)
+	}
+	if want := `A \ sign`; items[1].Example != want {
+		t.Errorf("example = %q, want %q", items[1].Example, want)
+	}
+}
+
+func TestVocabularyStreamParserRejectsInvalidItems(t *testing.T) {
+	var parser vocabularyStreamParser
+	if _, err := parser.Feed(`[{"word": 42}]`); err == nil {
+		t.Error("expected an error for an item with the wrong types")
+	}
+}
+
+// newStreamingServer fakes the chat completions API, streaming the content in small deltas
+func newStreamingServer(t *testing.T, content string) *OpenAIService {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for start := 0; start < len(content); start += 7 {
+			chunk := openai.ChatCompletionStreamResponse{
+				Choices: []openai.ChatCompletionStreamChoice{{
+					Delta: openai.ChatCompletionStreamChoiceDelta{Content: content[start:min(start+7, len(content))]},
+				}},
+			}
+			data, _ := json.Marshal(chunk)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			w.(http.Flusher).Flush()
+		}
+		// The usage chunk that is sent when include_usage is set
+		data, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			Model: "gpt-3.5-turbo-0125",
+			Usage: &openai.Usage{PromptTokens: 120, CompletionTokens: 80, TotalTokens: 200},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL
+	return &OpenAIService{
+		client: openai.NewClientWithConfig(config),
+		cache:  NewCache("").Namespace("vocabulary", time.Hour),
+	}
+}
+
+func TestStreamVocabularyPushesItemsAndCaches(t *testing.T) {
+	s := newStreamingServer(t, streamedResponse)
+	theme := "stream-test"
+
+	var pushed []models.VocabularyItem
+	vocabulary, err := s.StreamVocabulary(context.Background(), theme, 3, "english", func(item models.VocabularyItem) error {
+		pushed = append(pushed, item)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pushed) != 3 || len(vocabulary) != 3 {
+		t.Fatalf("pushed %d and returned %d items, want 3", len(pushed), len(vocabulary))
+	}
+	if pushed[2].IPA != "" {
+		t.Errorf("invalid IPA %q was not dropped", pushed[2].IPA)
+	}
+
+	version, err := s.prompts.Version("vocabulary", "english")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, ok := s.cachedVocabulary(s.vocabularyCacheKey(theme, 3, "english"), version)
+	if !ok || len(cached) != 3 {
+		t.Fatalf("cached %d items, want 3", len(cached))
+	}
+}
+
+func TestStreamVocabularyDoesNotCacheIncompleteResponses(t *testing.T) {
+	s := newStreamingServer(t, `[{"word": "bench", "definition": "A seat"}, {"word": "tr`)
+	theme := "stream-test-incomplete"
+
+	pushed := 0
+	_, err := s.StreamVocabulary(context.Background(), theme, 2, "english", func(models.VocabularyItem) error {
+		pushed++
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected an error for a truncated response")
+	}
+	if pushed != 1 {
+		t.Errorf("pushed %d items before the error, want 1", pushed)
+	}
+	if s.IsVocabularyCached(theme, 2, "english") {
+		t.Error("a truncated response was cached")
+	}
+}
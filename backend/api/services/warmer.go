@@ -0,0 +1,333 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+// ErrRateLimited is returned when a provider rejected a request because of its rate limit
+var ErrRateLimited = errors.New("rate limited")
+
+// IsRateLimited reports whether an error means a provider's rate limit was hit
+func IsRateLimited(err error) bool {
+	if errors.Is(err, ErrRateLimited) {
+		return true
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusTooManyRequests
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.HTTPStatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+const (
+	// minImagesRemaining keeps some of the hourly quota of the first image provider for learners
+	minImagesRemaining = 10
+	// rateLimitBackoff is how long a provider is left alone after it rate limited
+	// the warmer, when it did not tell when to retry
+	rateLimitBackoff = 15 * time.Minute
+)
+
+// WarmerOptions configures what the warmer keeps warm and how fast
+type WarmerOptions struct {
+	Languages []string
+	// Levels are the vocabulary sizes to warm, vocabulary is cached per word count
+	Levels []int
+	// ImagesPerTheme is the number of images searched for each theme
+	ImagesPerTheme int
+	// Concurrency limits the number of provider requests in flight
+	Concurrency int
+	// Interval between runs
+	Interval time.Duration
+}
+
+// warmOutcome is the result of the last attempt to warm one cache entry
+type warmOutcome struct {
+	err string
+}
+
+// Warmer fills the vocabulary and image caches in the background, so the
+// first learner on a theme does not wait for OpenAI and the image providers
+type Warmer struct {
+	themes     *ThemeService
+	vocabulary *OpenAIService
+	images     *ImageChain
+	options    WarmerOptions
+
+	outcomes     map[string]warmOutcome // job key to the last outcome
+	running      bool
+	lastStarted  time.Time
+	lastFinished time.Time
+	nextRun      time.Time
+	backoff      map[string]time.Time // provider to the time it may be used again
+	mu           sync.RWMutex
+
+	stop      chan struct{}
+	loop      sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewWarmer creates a new cache warmer
+func NewWarmer(themes *ThemeService, vocabulary *OpenAIService, images *ImageChain, options WarmerOptions) *Warmer {
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+	return &Warmer{
+		themes:     themes,
+		vocabulary: vocabulary,
+		images:     images,
+		options:    options,
+		outcomes:   make(map[string]warmOutcome),
+		backoff:    make(map[string]time.Time),
+		stop:       make(chan struct{}),
+	}
+}
+
+// Start warms the caches right away and then every interval until Close is called
+func (w *Warmer) Start() {
+	w.loop.Add(1)
+	go func() {
+		defer w.loop.Done()
+
+		ticker := time.NewTicker(w.options.Interval)
+		defer ticker.Stop()
+
+		for {
+			w.Run()
+
+			w.mu.Lock()
+			w.nextRun = time.Now().Add(w.options.Interval)
+			w.mu.Unlock()
+
+			select {
+			case <-ticker.C:
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the warmer and waits for the current run to finish its requests in flight
+func (w *Warmer) Close() {
+	w.closeOnce.Do(func() {
+		close(w.stop)
+	})
+	w.loop.Wait()
+}
+
+// warmJob is one cache entry to warm
+type warmJob struct {
+	key      string
+	provider string // "openai" or "images"
+	warm     func() error
+}
+
+// Run warms every cold cache entry once, with at most Concurrency requests in flight
+func (w *Warmer) Run() {
+	w.mu.Lock()
+	if w.running {
+		w.mu.Unlock()
+		return
+	}
+	w.running = true
+	w.lastStarted = time.Now()
+	w.mu.Unlock()
+
+	defer func() {
+		w.mu.Lock()
+		w.running = false
+		w.lastFinished = time.Now()
+		w.mu.Unlock()
+	}()
+
+	jobs := w.coldJobs()
+	debugLogger.Printf("Cache warmer found %d cold entries", len(jobs))
+
+	slots := make(chan struct{}, w.options.Concurrency)
+	var inFlight sync.WaitGroup
+	for _, job := range jobs {
+		select {
+		case <-w.stop:
+			inFlight.Wait()
+			return
+		case slots <- struct{}{}:
+		}
+
+		// Leave providers alone while they are rate limiting us
+		if !w.available(job.provider) {
+			<-slots
+			w.record(job.key, fmt.Errorf("skipped: %s %w", job.provider, ErrRateLimited))
+			continue
+		}
+
+		inFlight.Add(1)
+		go func(job warmJob) {
+			defer func() {
+				<-slots
+				inFlight.Done()
+			}()
+
+			err := job.warm()
+			if IsRateLimited(err) {
+				// Image providers tell when their quota is refilled
+				backoff, ok := RetryAfter(err)
+				if !ok {
+					backoff = rateLimitBackoff
+				}
+				w.mu.Lock()
+				w.backoff[job.provider] = time.Now().Add(backoff)
+				w.mu.Unlock()
+				debugLogger.Printf("Cache warmer backing off %s for %s", job.provider, backoff.Round(time.Second))
+			}
+			w.record(job.key, err)
+		}(job)
+	}
+	inFlight.Wait()
+}
+
+// coldJobs lists the cache entries that are not warm yet
+func (w *Warmer) coldJobs() []warmJob {
+	var jobs []warmJob
+	for _, theme := range w.themes.GetAllThemes() {
+		themeID := theme.ID
+
+		for _, language := range w.options.Languages {
+			for _, level := range w.options.Levels {
+				if w.vocabulary.IsVocabularyCached(themeID, level, language) {
+					continue
+				}
+				jobs = append(jobs, warmJob{
+					key:      vocabularyJobKey(themeID, language, level),
+					provider: "openai",
+					warm: func() error {
+						_, err := w.vocabulary.GetVocabularyForLanguage(themeID, level, language)
+						return err
+					},
+				})
+			}
+		}
+
+		if w.images.Configured() && !w.images.IsSearchCached(themeID, w.options.ImagesPerTheme) {
+			jobs = append(jobs, warmJob{
+				key:      imageJobKey(themeID),
+				provider: "images",
+				warm: func() error {
+					_, err := w.images.SearchImages(themeID, w.options.ImagesPerTheme)
+					return err
+				},
+			})
+		}
+	}
+	return jobs
+}
+
+// available reports whether a provider may be used for warming
+func (w *Warmer) available(provider string) bool {
+	w.mu.RLock()
+	until := w.backoff[provider]
+	w.mu.RUnlock()
+	if time.Now().Before(until) {
+		return false
+	}
+
+	// The first image provider may report its remaining hourly quota, keep some for learners
+	if provider == "images" {
+		if remaining, ok := w.images.RateLimitRemaining(); ok && remaining < minImagesRemaining {
+			return false
+		}
+	}
+	return true
+}
+
+// record remembers the outcome of warming a cache entry
+func (w *Warmer) record(key string, err error) {
+	var outcome warmOutcome
+	if err != nil {
+		outcome.err = err.Error()
+		debugLogger.Printf("Cache warmer failed to warm %s: %v", key, err)
+	}
+
+	w.mu.Lock()
+	w.outcomes[key] = outcome
+	w.mu.Unlock()
+}
+
+// Status reports for every theme whether its vocabulary and images are warm
+func (w *Warmer) Status() models.WarmerStatus {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	status := models.WarmerStatus{
+		Running:      w.running,
+		LastStarted:  formatTime(w.lastStarted),
+		LastFinished: formatTime(w.lastFinished),
+		NextRun:      formatTime(w.nextRun),
+		Themes:       make([]models.ThemeWarmth, 0),
+	}
+
+	for _, theme := range w.themes.GetAllThemes() {
+		warmth := models.ThemeWarmth{
+			ThemeID:    theme.ID,
+			Warm:       true,
+			Vocabulary: make([]models.VocabularyWarmth, 0, len(w.options.Languages)*len(w.options.Levels)),
+		}
+
+		for _, language := range w.options.Languages {
+			for _, level := range w.options.Levels {
+				entry := models.VocabularyWarmth{
+					Language: language,
+					Level:    level,
+					Warm:     w.vocabulary.IsVocabularyCached(theme.ID, level, language),
+				}
+				if !entry.Warm {
+					warmth.Warm = false
+					entry.Error = w.outcomes[vocabularyJobKey(theme.ID, language, level)].err
+				}
+				warmth.Vocabulary = append(warmth.Vocabulary, entry)
+			}
+		}
+
+		warmth.Images = models.ImageWarmth{Warm: w.images.IsSearchCached(theme.ID, w.options.ImagesPerTheme)}
+		if !warmth.Images.Warm {
+			warmth.Warm = false
+			warmth.Images.Error = w.outcomes[imageJobKey(theme.ID)].err
+			if !w.images.Configured() {
+				warmth.Images.Error = "no image provider is configured"
+			}
+		}
+
+		status.Themes = append(status.Themes, warmth)
+	}
+
+	return status
+}
+
+// vocabularyJobKey identifies the job that warms vocabulary
+func vocabularyJobKey(themeID, language string, level int) string {
+	return fmt.Sprintf("vocabulary:%s:%s:%d", themeID, language, level)
+}
+
+// imageJobKey identifies the job that warms images
+func imageJobKey(themeID string) string {
+	return "images:" + themeID
+}
+
+// formatTime formats a time as RFC 3339, or returns an empty string for the zero time
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
+)
+
+const (
+	// defaultWikimediaBaseURL is the Wikimedia Commons API used when no other base URL is configured
+	defaultWikimediaBaseURL = "https://commons.wikimedia.org/w/api.php"
+	// wikimediaUserAgent identifies us to Wikimedia, which requires a descriptive user agent
+	wikimediaUserAgent = "PictoLingua/1.0 (https://github.com/yourusername/picto-lingua)"
+	// wikimediaImageWidth is the width of the thumbnails shown in the gallery
+	wikimediaImageWidth = 800
+	// wikimediaRandomCandidates is the number of search results a random image is picked from
+	wikimediaRandomCandidates = 15
+)
+
+var (
+	// htmlTagPattern matches HTML tags in Commons metadata
+	htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+	// htmlLinkPattern matches the target of the first link in Commons metadata
+	htmlLinkPattern = regexp.MustCompile(`href="([^"]+)"`)
+)
+
+// wikimediaPage is a file page as returned by the Commons API
+type wikimediaPage struct {
+	PageID    int    `json:"pageid"`
+	Title     string `json:"title"`
+	Index     int    `json:"index"`
+	ImageInfo []struct {
+		URL            string `json:"url"`
+		ThumbURL       string `json:"thumburl"`
+		DescriptionURL string `json:"descriptionurl"`
+		Width          int    `json:"width"`
+		Height         int    `json:"height"`
+		Mime           string `json:"mime"`
+		ExtMetadata    map[string]struct {
+			Value string `json:"value"`
+		} `json:"extmetadata"`
+	} `json:"imageinfo"`
+}
+
+// metadata returns a metadata field of the file as plain text
+func (p *wikimediaPage) metadata(field string) string {
+	if len(p.ImageInfo) == 0 {
+		return ""
+	}
+	return stripHTML(p.ImageInfo[0].ExtMetadata[field].Value)
+}
+
+// toImage maps a Commons file to our model
+func (p *wikimediaPage) toImage() models.Image {
+	info := p.ImageInfo[0]
+
+	description := p.metadata("ImageDescription")
+	if description == "" {
+		description = p.name()
+	}
+
+	artist := p.metadata("Artist")
+	if artist == "" {
+		artist = "Unknown author"
+	}
+	license := p.metadata("LicenseShortName")
+
+	var artistURL string
+	if match := htmlLinkPattern.FindStringSubmatch(info.ExtMetadata["Artist"].Value); match != nil {
+		artistURL = html.UnescapeString(match[1])
+		if strings.HasPrefix(artistURL, "//") {
+			artistURL = "https:" + artistURL
+		}
+	}
+
+	attribution := fmt.Sprintf("Photo by %s via Wikimedia Commons", artist)
+	if license != "" {
+		attribution = fmt.Sprintf("Photo by %s, %s, via Wikimedia Commons", artist, license)
+	}
+
+	imageURL := info.ThumbURL
+	if imageURL == "" {
+		imageURL = info.URL
+	}
+
+	return models.Image{
+		ID:                ProviderImageID("wikimedia", strconv.Itoa(p.PageID)),
+		URL:               imageURL,
+		DownloadURL:       info.URL,
+		Description:       description,
+		Width:             info.Width,
+		Height:            info.Height,
+		Provider:          "wikimedia",
+		SourceURL:         info.DescriptionURL,
+		License:           license,
+		Photographer:      artist,
+		PhotographerURL:   artistURL,
+		AttributionString: attribution,
+	}
+}
+
+// name returns the file name without the namespace and extension, such as "Red apple"
+func (p *wikimediaPage) name() string {
+	name := strings.TrimPrefix(p.Title, "File:")
+	if i := strings.LastIndex(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// stripHTML turns an HTML fragment into plain text
+func stripHTML(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(htmlTagPattern.ReplaceAllString(s, " "))), " ")
+}
+
+// WikimediaService finds images on Wikimedia Commons. It needs no API key, so
+// it is always configured.
+type WikimediaService struct {
+	baseURL string
+	client  *http.Client
+	// Images whose title or description contains a blocked term are not shown
+	blocklist *Blocklist
+}
+
+// NewWikimediaService creates a new Wikimedia Commons service that leaves out
+// images matching the blocklist. It uses the public API when baseURL is empty.
+func NewWikimediaService(baseURL string, blocklist *Blocklist) *WikimediaService {
+	return &WikimediaService{
+		baseURL:   apiBaseURL(baseURL, defaultWikimediaBaseURL),
+		client:    &http.Client{},
+		blocklist: blocklist,
+	}
+}
+
+// Name returns the provider name
+func (s *WikimediaService) Name() string {
+	return "wikimedia"
+}
+
+// Configured reports whether the provider can be used, which it always can
+func (s *WikimediaService) Configured() bool {
+	return true
+}
+
+// query runs a query for file pages with their image info and returns the pages in result order
+func (s *WikimediaService) query(params url.Values, thumbWidth int) ([]wikimediaPage, error) {
+	params.Set("action", "query")
+	params.Set("format", "json")
+	params.Set("formatversion", "2")
+	params.Set("prop", "imageinfo")
+	params.Set("iiprop", "url|size|mime|extmetadata")
+	params.Set("iiextmetadatafilter", "Artist|LicenseShortName|ImageDescription")
+	params.Set("iiextmetadatalanguage", "en")
+	params.Set("iiurlwidth", strconv.Itoa(thumbWidth))
+
+	req, err := http.NewRequest("GET", s.baseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", wikimediaUserAgent)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests:
+		return nil, fmt.Errorf("wikimedia: %w", ErrRateLimited)
+	default:
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Error *struct {
+			Code string `json:"code"`
+			Info string `json:"info"`
+		} `json:"error"`
+		Query struct {
+			Pages []wikimediaPage `json:"pages"`
+		} `json:"query"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	// The API reports errors such as invalid parameters with status 200
+	if response.Error != nil {
+		if response.Error.Code == "ratelimited" {
+			return nil, fmt.Errorf("wikimedia: %w", ErrRateLimited)
+		}
+		return nil, fmt.Errorf("wikimedia error %s: %s", response.Error.Code, response.Error.Info)
+	}
+
+	// Generated pages are not returned in search order
+	pages := response.Query.Pages
+	sort.SliceStable(pages, func(i, j int) bool { return pages[i].Index < pages[j].Index })
+	return pages, nil
+}
+
+// suitable reports whether a file is a photo that may be shown to children,
+// the reason for leaving out a photo is logged
+func (s *WikimediaService) suitable(p *wikimediaPage) bool {
+	if len(p.ImageInfo) == 0 {
+		return false
+	}
+	// Commons also hosts drawings, scans and documents
+	if mime := p.ImageInfo[0].Mime; mime != "image/jpeg" && mime != "image/png" {
+		return false
+	}
+
+	if term, ok := s.blocklist.Match(p.Title, p.metadata("ImageDescription")); ok {
+		debugLogger.Printf("Moderation rejected image wikimedia:%d: contains blocked term %q", p.PageID, term)
+		return false
+	}
+	return true
+}
+
+// search returns the photos found for a query that are suitable for children
+func (s *WikimediaService) search(query string, count int) ([]wikimediaPage, error) {
+	pages, err := s.query(url.Values{
+		"generator":    {"search"},
+		"gsrsearch":    {query + " filetype:bitmap"},
+		"gsrnamespace": {"6"}, // the File namespace
+		// Ask for more files than needed, as some are left out
+		"gsrlimit": {strconv.Itoa(min(count*2, 50))},
+	}, wikimediaImageWidth)
+	if err != nil {
+		return nil, err
+	}
+
+	photos := make([]wikimediaPage, 0, count)
+	for _, page := range pages {
+		if len(photos) == count {
+			break
+		}
+		if s.suitable(&page) {
+			photos = append(photos, page)
+		}
+	}
+	return photos, nil
+}
+
+// SearchImages searches for images based on a query
+func (s *WikimediaService) SearchImages(query string, count int) ([]models.Image, error) {
+	photos, err := s.search(query, count)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]models.Image, 0, len(photos))
+	for _, photo := range photos {
+		images = append(images, photo.toImage())
+	}
+	return images, nil
+}
+
+// GetRandomImage picks a random image from the search results for a query
+func (s *WikimediaService) GetRandomImage(query string) (*models.Image, error) {
+	photos, err := s.search(query, wikimediaRandomCandidates)
+	if err != nil {
+		return nil, err
+	}
+	if len(photos) == 0 {
+		return nil, fmt.Errorf("no wikimedia image for %q: %w", query, ErrImageNotFound)
+	}
+
+	image := photos[rand.Intn(len(photos))].toImage()
+	return &image, nil
+}
+
+// getPage fetches a file page by its image ID, with a thumbnail of thumbWidth
+// pixels. Files that are not photos suitable for children are not found,
+// whoever asks for them.
+func (s *WikimediaService) getPage(id string, thumbWidth int) (*wikimediaPage, error) {
+	_, pageID := SplitImageID(id)
+	if _, err := strconv.Atoi(pageID); err != nil {
+		return nil, fmt.Errorf("invalid wikimedia page id %q: %w", pageID, ErrImageNotFound)
+	}
+
+	pages, err := s.query(url.Values{"pageids": {pageID}}, thumbWidth)
+	if err != nil {
+		return nil, err
+	}
+	// Missing pages are returned without image info
+	if len(pages) == 0 || !s.suitable(&pages[0]) {
+		return nil, fmt.Errorf("wikimedia page %s: %w", pageID, ErrImageNotFound)
+	}
+	return &pages[0], nil
+}
+
+// GetImage gets a single image by its ID
+func (s *WikimediaService) GetImage(id string) (*models.Image, error) {
+	page, err := s.getPage(id, wikimediaImageWidth)
+	if err != nil {
+		return nil, err
+	}
+
+	image := page.toImage()
+	return &image, nil
+}
+
+// ImageSourceURL returns the URL of the image that is at most maxWidth pixels
+// wide. Commons serves JPEG thumbnails of JPEG files and PNG thumbnails of PNG files.
+func (s *WikimediaService) ImageSourceURL(id string, maxWidth int) (string, error) {
+	page, err := s.getPage(id, maxWidth)
+	if err != nil {
+		return "", err
+	}
+
+	info := page.ImageInfo[0]
+	if info.ThumbURL != "" {
+		return info.ThumbURL, nil
+	}
+	return info.URL, nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func newFixtureWikimediaService(fixture string) (*WikimediaService, *fixtureTransport) {
+	transport := &fixtureTransport{fixture: fixture}
+	s := NewWikimediaService("", NewBlocklist(nil))
+	s.client = &http.Client{Transport: transport}
+	return s, transport
+}
+
+func TestWikimediaSearchImages(t *testing.T) {
+	s, transport := newFixtureWikimediaService("wikimedia_search.json")
+
+	images, err := s.SearchImages("apple", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := transport.lastRequest(t)
+	query := req.URL.Query()
+	if query.Get("generator") != "search" || query.Get("gsrsearch") != "apple filetype:bitmap" || query.Get("gsrnamespace") != "6" {
+		t.Errorf("requested %s", req.URL)
+	}
+	if req.Header.Get("User-Agent") != wikimediaUserAgent {
+		t.Errorf("User-Agent = %q", req.Header.Get("User-Agent"))
+	}
+
+	// The diagram is not a photo and the photo with a pistol is left out, the
+	// rest is in search order
+	if len(images) != 2 {
+		t.Fatalf("got %d images, want 2: %+v", len(images), images)
+	}
+
+	image := images[0]
+	if image.ID != "wikimedia:4466547" || image.Provider != "wikimedia" {
+		t.Errorf("got ID %q from %q", image.ID, image.Provider)
+	}
+	if image.Description != "A red apple & its leaf" {
+		t.Errorf("description = %q", image.Description)
+	}
+	if image.Photographer != "Abhijit Tembhekar" || image.PhotographerURL != "https://commons.wikimedia.org/wiki/User:Abhijit_Tembhekar" {
+		t.Errorf("photographer %q at %q", image.Photographer, image.PhotographerURL)
+	}
+	if image.License != "CC BY 2.0" {
+		t.Errorf("license = %q", image.License)
+	}
+	if image.AttributionString != "Photo by Abhijit Tembhekar, CC BY 2.0, via Wikimedia Commons" {
+		t.Errorf("attribution = %q", image.AttributionString)
+	}
+	if image.URL != "https://upload.wikimedia.org/wikipedia/commons/thumb/1/15/Red_Apple.jpg/800px-Red_Apple.jpg" {
+		t.Errorf("URL = %q", image.URL)
+	}
+	if image.SourceURL != "https://commons.wikimedia.org/wiki/File:Red_Apple.jpg" {
+		t.Errorf("source URL = %q", image.SourceURL)
+	}
+
+	// Without a description the file name is used
+	if images[1].Description != "Green apple" || images[1].Photographer != "Photographer unknown" {
+		t.Errorf("got description %q by %q", images[1].Description, images[1].Photographer)
+	}
+}
+
+func TestWikimediaGetImage(t *testing.T) {
+	s, transport := newFixtureWikimediaService("wikimedia_page.json")
+
+	url, err := s.ImageSourceURL("wikimedia:4466547", 1600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := transport.lastRequest(t).URL.Query()
+	if query.Get("pageids") != "4466547" || query.Get("iiurlwidth") != "1600" {
+		t.Errorf("requested %v", query)
+	}
+	if url != "https://upload.wikimedia.org/wikipedia/commons/thumb/1/15/Red_Apple.jpg/1600px-Red_Apple.jpg" {
+		t.Errorf("source URL = %s", url)
+	}
+
+	image, err := s.GetImage("wikimedia:4466547")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.License != "CC BY 2.0" {
+		t.Errorf("license = %q", image.License)
+	}
+}
+
+func TestWikimediaMissingImage(t *testing.T) {
+	s, _ := newFixtureWikimediaService("wikimedia_missing.json")
+
+	if _, err := s.GetImage("wikimedia:999999999"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("err = %v, want ErrImageNotFound", err)
+	}
+	if _, err := s.GetImage("wikimedia:abc"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("err = %v, want ErrImageNotFound for a malformed ID", err)
+	}
+}
+
+func TestWikimediaGetImageLeavesOutUnsuitableFiles(t *testing.T) {
+	// Files served by ID are moderated like search results
+	s, _ := newFixtureWikimediaService("wikimedia_page.json")
+	s.blocklist = NewBlocklist([]string{"apple"})
+	if _, err := s.GetImage("wikimedia:4466547"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("err = %v, want ErrImageNotFound for a blocked photo", err)
+	}
+	if _, err := s.ImageSourceURL("wikimedia:4466547", 1600); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("err = %v, want ErrImageNotFound for the source of a blocked photo", err)
+	}
+
+	s, _ = newFixtureWikimediaService("wikimedia_diagram.json")
+	if _, err := s.ImageSourceURL("wikimedia:4466547", 1600); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("err = %v, want ErrImageNotFound for a file that is not a photo", err)
+	}
+}
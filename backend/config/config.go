@@ -1,22 +1,121 @@
 package config
 
 import (
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourusername/picto-lingua-backend/api/models"
 )
 
+// defaultOpenAIPricing holds the prices of the models vocabulary may be generated
+// with, in US dollars per million prompt and completion tokens
+var defaultOpenAIPricing = map[string]models.ModelPrice{
+	"gpt-3.5-turbo": {Prompt: 0.50, Completion: 1.50},
+	"gpt-4o":        {Prompt: 2.50, Completion: 10.00},
+	"gpt-4o-mini":   {Prompt: 0.15, Completion: 0.60},
+}
+
 // Config holds the application configuration
 type Config struct {
 	UnsplashAccessKey string
+	PexelsAPIKey      string
 	OpenAIAPIKey      string
 	Port              string
+	// Base URLs of the external APIs, the public APIs are used when they are empty
+	UnsplashBaseURL  string
+	PexelsBaseURL    string
+	WikimediaBaseURL string
+	OpenAIBaseURL    string
+	// Text-to-speech settings
+	TTSProvider   string // "openai", "command" or "mock"
+	TTSCommand    string
+	AudioCacheDir string
+	// Durable cache of generated vocabulary and image searches, in memory only when the directory is empty
+	CacheDir string
+	// Image providers asked in order, the next one is tried when a provider fails or finds nothing
+	ImageProviders []string
+	// Requests of a provider's rate limit kept in reserve, below it cached and fallback images are served
+	ImageQuotaThreshold int
+	// Directory where the image proxy keeps originals and resized variants
+	ImageDir           string
+	VocabularyCacheTTL time.Duration
+	ImageCacheTTL      time.Duration
+	// Lifetime of access tokens issued at login, and how often expired tokens
+	// and anonymous accounts without a token are removed
+	AuthTokenTTL        time.Duration
+	AuthJanitorInterval time.Duration
+	// Session expiry settings
+	SessionIdleTimeout     time.Duration
+	SessionMaxLifetime     time.Duration
+	SessionJanitorInterval time.Duration
+	// Moderation of generated vocabulary and images
+	ModerationProvider  string   // "openai", "blocklist" or "mock"
+	ModerationBlocklist []string // terms blocked in addition to the built-in list
+	// Directory of prompt templates that replace the built-in ones, and how
+	// often it is checked for changes, never when zero
+	PromptDir            string
+	PromptReloadInterval time.Duration
+	// OpenAI token accounting, prices are matched by model name prefix
+	OpenAIPricing  map[string]models.ModelPrice
+	UsageFile      string  // where token totals are kept, in memory only when empty
+	DailyBudget    float64 // US dollars per UTC day, no budget when zero
+	OverBudgetMode string  // "cache-only" or "mock"
+	// File the requests to OpenAI and the image providers are logged to, nothing is logged when it is empty
+	DebugLogFile string
+	// Key required by the admin endpoints, they are disabled when it is empty
+	AdminAPIKey string
+	// Background cache warming, disabled when the interval is zero
+	WarmerInterval    time.Duration
+	WarmerLanguages   []string
+	WarmerLevels      []int // vocabulary sizes in words
+	WarmerConcurrency int
 }
 
 // LoadConfig loads the configuration from environment variables
 func LoadConfig() (*Config, error) {
 	config := &Config{
 		UnsplashAccessKey: getEnv("UNSPLASH_ACCESS_KEY", ""),
+		PexelsAPIKey:      getEnv("PEXELS_API_KEY", ""),
 		OpenAIAPIKey:      getEnv("OPENAI_API_KEY", ""),
 		Port:              getEnv("PORT", "8080"),
+		UnsplashBaseURL:   getEnv("UNSPLASH_BASE_URL", ""),
+		PexelsBaseURL:     getEnv("PEXELS_BASE_URL", ""),
+		WikimediaBaseURL:  getEnv("WIKIMEDIA_BASE_URL", ""),
+		OpenAIBaseURL:     getEnv("OPENAI_BASE_URL", ""),
+		TTSProvider:       getEnv("TTS_PROVIDER", ""),
+		TTSCommand:        getEnv("TTS_COMMAND", "espeak-ng -v {lang} --stdout --stdin"),
+		AudioCacheDir:     getEnv("AUDIO_CACHE_DIR", "data/audio"),
+		CacheDir:          getEnv("CACHE_DIR", "data/cache"),
+		ImageProviders:    getEnvList("IMAGE_PROVIDERS", []string{"unsplash", "pexels", "wikimedia"}),
+		ImageDir:          getEnv("IMAGE_DIR", "data/images"),
+		// The warmer stops earlier, at 10 requests left, so learners get the rest
+		ImageQuotaThreshold: getEnvInt("IMAGE_QUOTA_THRESHOLD", 5),
+		// Vocabulary barely changes, image search results are refreshed daily
+		VocabularyCacheTTL:  getEnvDuration("VOCABULARY_CACHE_TTL", 30*24*time.Hour),
+		ImageCacheTTL:       getEnvDuration("IMAGE_CACHE_TTL", 24*time.Hour),
+		AuthTokenTTL:        getEnvDuration("AUTH_TOKEN_TTL", 30*24*time.Hour),
+		AuthJanitorInterval: getEnvDuration("AUTH_JANITOR_INTERVAL", time.Hour),
+		// Sessions expire after a day without activity and a week after they started
+		SessionIdleTimeout:     getEnvDuration("SESSION_IDLE_TIMEOUT", 24*time.Hour),
+		SessionMaxLifetime:     getEnvDuration("SESSION_MAX_LIFETIME", 7*24*time.Hour),
+		SessionJanitorInterval: getEnvDuration("SESSION_JANITOR_INTERVAL", time.Minute),
+		ModerationProvider:     getEnv("MODERATION_PROVIDER", ""),
+		ModerationBlocklist:    getEnvList("MODERATION_BLOCKLIST", nil),
+		PromptDir:              getEnv("PROMPT_DIR", ""),
+		PromptReloadInterval:   getEnvDuration("PROMPT_RELOAD_INTERVAL", 5*time.Second),
+		OpenAIPricing:          getEnvPricing("OPENAI_PRICING", defaultOpenAIPricing),
+		UsageFile:              getEnv("USAGE_FILE", "data/usage.json"),
+		DailyBudget:            getEnvFloat("OPENAI_DAILY_BUDGET", 0),
+		OverBudgetMode:         getEnv("OPENAI_OVER_BUDGET_MODE", "cache-only"),
+		DebugLogFile:           getEnv("DEBUG_LOG_FILE", "openai_debug.log"),
+		AdminAPIKey:            getEnv("ADMIN_API_KEY", ""),
+		WarmerInterval:         getEnvDuration("WARMER_INTERVAL", 6*time.Hour),
+		WarmerLanguages:        getEnvList("WARMER_LANGUAGES", []string{"english", "dutch"}),
+		WarmerLevels:           getEnvIntList("WARMER_LEVELS", []int{10}),
+		WarmerConcurrency:      getEnvInt("WARMER_CONCURRENCY", 2),
 	}
 
 	return config, nil
@@ -30,3 +129,103 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvDuration gets a duration such as "30m" from an environment variable or returns a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("WARNING: Invalid duration for %s: %q, using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+// getEnvInt gets an integer from an environment variable or returns a default value
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("WARNING: Invalid integer for %s: %q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvList gets a comma separated list from an environment variable or returns a default value
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvIntList gets a comma separated list of integers from an environment variable or returns a default value
+func getEnvIntList(key string, defaultValue []int) []int {
+	items := getEnvList(key, nil)
+	if items == nil {
+		return defaultValue
+	}
+
+	list := make([]int, 0, len(items))
+	for _, item := range items {
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			log.Printf("WARNING: Invalid integer list for %s: %q, using default %v", key, os.Getenv(key), defaultValue)
+			return defaultValue
+		}
+		list = append(list, n)
+	}
+	return list
+}
+
+// getEnvFloat gets a number from an environment variable or returns a default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("WARNING: Invalid number for %s: %q, using default %g", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvPricing gets model prices such as "gpt-4o-mini=0.15/0.60" from a comma
+// separated environment variable, the prompt and completion price per million
+// tokens. They are added to the default prices, replacing those of the same model.
+func getEnvPricing(key string, defaultValue map[string]models.ModelPrice) map[string]models.ModelPrice {
+	pricing := make(map[string]models.ModelPrice, len(defaultValue))
+	for model, price := range defaultValue {
+		pricing[model] = price
+	}
+
+	for _, item := range getEnvList(key, nil) {
+		model, prices, ok := strings.Cut(item, "=")
+		prompt, completion, ok2 := strings.Cut(prices, "/")
+		promptPrice, err := strconv.ParseFloat(strings.TrimSpace(prompt), 64)
+		completionPrice, err2 := strconv.ParseFloat(strings.TrimSpace(completion), 64)
+		if !ok || !ok2 || err != nil || err2 != nil {
+			log.Printf("WARNING: Invalid price for %s: %q, expected model=prompt/completion", key, item)
+			continue
+		}
+		pricing[strings.TrimSpace(model)] = models.ModelPrice{Prompt: promptPrice, Completion: completionPrice}
+	}
+	return pricing
+}
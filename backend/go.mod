@@ -5,9 +5,13 @@ go 1.23.0
 toolchain go1.24.0
 
 require (
+	github.com/HugoSmits86/nativewebp v1.2.0
 	github.com/gin-contrib/cors v1.7.4
 	github.com/gin-gonic/gin v1.10.0
+	github.com/gorilla/websocket v1.5.3
 	github.com/sashabaranov/go-openai v1.38.0
+	golang.org/x/crypto v0.36.0
+	golang.org/x/image v0.24.0
 )
 
 require (
@@ -32,7 +36,6 @@ require (
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.12 // indirect
 	golang.org/x/arch v0.12.0 // indirect
-	golang.org/x/crypto v0.36.0 // indirect
 	golang.org/x/net v0.37.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
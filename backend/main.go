@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata" // learner timezones must resolve in minimal containers
 
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
-	"github.com/yourusername/picto-lingua-backend/api/handlers"
 	"github.com/yourusername/picto-lingua-backend/config"
 )
 
@@ -17,38 +21,10 @@ func main() {
 	}
 
 	// Initialize handlers with services
-	handlers.InitImageHandler(cfg)
-	handlers.InitVocabularyHandler(cfg)
-	handlers.InitSessionHandler()
+	initHandlers(cfg)
 
 	// Set up the router
-	router := gin.Default()
-
-	// Configure CORS
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST"},
-		AllowHeaders:     []string{"Origin", "Content-Type"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-	}))
-
-	// Set up the API routes
-	api := router.Group("/api")
-	{
-		// Image routes
-		api.GET("/images", handlers.GetImages)
-
-		// Vocabulary routes
-		api.GET("/vocabulary", handlers.GetVocabulary)
-
-		// Session routes
-		api.POST("/session", handlers.SaveSession)
-		api.GET("/session", handlers.GetSession)
-
-		// Theme routes
-		api.GET("/themes", handlers.GetThemes)
-	}
+	router := newRouter()
 
 	// Start the server
 	port := cfg.Port
@@ -56,8 +32,31 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Starting server on port %s...", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
 	}
+
+	// Shut down cleanly on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Printf("Starting server on port %s...", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("Shutting down server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+
+	// Stop background workers after the last request has finished
+	closeHandlers()
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"log"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/picto-lingua-backend/api/classroom"
+	"github.com/yourusername/picto-lingua-backend/api/handlers"
+	"github.com/yourusername/picto-lingua-backend/api/race"
+	"github.com/yourusername/picto-lingua-backend/api/services"
+	"github.com/yourusername/picto-lingua-backend/config"
+)
+
+// allowedOrigins are the origins of the frontend, shared by CORS and the race WebSockets
+var allowedOrigins = []string{"http://localhost:3000"}
+
+// initHandlers initializes the handlers and the services they use
+func initHandlers(cfg *config.Config) {
+	if err := services.OpenDebugLog(cfg.DebugLogFile); err != nil {
+		log.Printf("WARNING: Failed to open debug log %s, not logging requests: %v", cfg.DebugLogFile, err)
+	}
+
+	handlers.InitAuthHandler(cfg)
+	handlers.InitCacheHandler(cfg)
+	handlers.InitModerationHandler(cfg)
+	handlers.InitImageHandler(cfg)
+	handlers.InitVocabularyHandler(cfg)
+	handlers.InitSessionHandler(cfg)
+	handlers.InitStatsHandler()
+	handlers.InitGamificationHandler()
+	handlers.InitAudioHandler(cfg)
+	handlers.InitAdminHandler(cfg)
+	handlers.InitWarmerHandler(cfg)
+	classroom.Init(handlers.Sessions(), handlers.Themes(), handlers.Content())
+	race.Init(handlers.Content(), handlers.Themes(), allowedOrigins)
+}
+
+// closeHandlers stops the background work of the handlers. WebSockets are not
+// tracked by http.Server.Shutdown, so their races are closed here.
+func closeHandlers() {
+	race.Close()
+	handlers.CloseWarmerHandler()
+	handlers.CloseImageHandler()
+	handlers.CloseVocabularyHandler()
+	handlers.CloseSessionHandler()
+	handlers.CloseAuthHandler()
+}
+
+// newRouter sets up the router with its middleware and the API routes
+func newRouter() *gin.Engine {
+	router := gin.Default()
+	router.Use(corsMiddleware())
+	registerRoutes(router)
+	return router
+}
+
+// corsMiddleware lets the frontend call the API from the browser
+func corsMiddleware() gin.HandlerFunc {
+	return cors.New(cors.Config{
+		AllowOrigins:     allowedOrigins,
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "If-Match"},
+		ExposeHeaders:    []string{"Content-Length", "ETag"},
+		AllowCredentials: true,
+	})
+}
+
+// registerRoutes adds the API routes to a router
+func registerRoutes(router gin.IRouter) {
+	api := router.Group("/api")
+	{
+		// Image routes
+		api.GET("/images", handlers.GetImages)
+		api.GET("/images/:id/file", handlers.GetImageFile)
+		api.GET("/images/:id/placeholder", handlers.GetImagePlaceholder)
+		api.POST("/images/:id/download", handlers.TrackImageDownload)
+
+		// Vocabulary routes
+		api.GET("/vocabulary", handlers.GetVocabulary)
+		api.GET("/vocabulary/stream", handlers.StreamVocabulary)
+		api.PUT("/vocabulary/pronunciation", handlers.AdminRequired(), handlers.SetPronunciation)
+
+		// Audio routes
+		api.GET("/audio", handlers.GetAudio)
+
+		// Auth routes
+		api.POST("/auth/register", handlers.Register)
+		api.POST("/auth/login", handlers.Login)
+		api.POST("/auth/anonymous", handlers.LoginAnonymous)
+		api.POST("/auth/logout", handlers.AuthRequired(), handlers.Logout)
+		api.GET("/me", handlers.AuthRequired(), handlers.GetMe)
+		api.GET("/me/gamification", handlers.AuthRequired(), handlers.GetGamification)
+		api.PUT("/me/gamification", handlers.AuthRequired(), handlers.UpdateGamification)
+
+		// Session routes
+		api.POST("/session", handlers.AuthRequired(), handlers.SaveSession)
+		api.GET("/session", handlers.AuthRequired(), handlers.GetSession)
+		api.GET("/session/events", handlers.AuthRequired(), handlers.GetSessionEvents)
+		api.GET("/sessions", handlers.AuthRequired(), handlers.ListSessions)
+		api.POST("/sessions/:id/resume", handlers.AuthRequired(), handlers.ResumeSession)
+
+		// Stats routes
+		api.GET("/stats", handlers.AuthRequired(), handlers.GetStats)
+
+		// Theme routes
+		api.GET("/themes", handlers.GetThemes)
+
+		// Classroom routes
+		classrooms := api.Group("/classrooms", handlers.AuthRequired())
+		{
+			teacher := classroom.RequireRole(classroom.RoleTeacher)
+			member := classroom.RequireRole(classroom.RoleTeacher, classroom.RoleStudent)
+
+			classrooms.POST("", classroom.CreateClassroom)
+			classrooms.GET("", classroom.ListClassrooms)
+			classrooms.POST("/join", classroom.JoinClassroom)
+			classrooms.GET("/:id", member, classroom.GetClassroom)
+			classrooms.POST("/:id/themes", teacher, classroom.AssignTheme)
+			classrooms.DELETE("/:id/themes/:theme_id", teacher, classroom.UnassignTheme)
+			classrooms.GET("/:id/progress", teacher, classroom.GetProgress)
+			classrooms.POST("/:id/assignments", teacher, classroom.CreateAssignment)
+			classrooms.GET("/:id/assignments", member, classroom.ListAssignments)
+			classrooms.GET("/:id/assignments/:assignment_id", member, classroom.GetAssignment)
+			classrooms.DELETE("/:id/assignments/:assignment_id", teacher, classroom.DeleteAssignment)
+			classrooms.POST("/:id/assignments/:assignment_id/start", member, classroom.StartAssignment)
+			classrooms.GET("/:id/assignments/:assignment_id/report", teacher, classroom.GetAssignmentReport)
+		}
+
+		// Race routes
+		api.GET("/race/ws", race.ServeWS)
+
+		// Admin routes
+		admin := api.Group("/admin", handlers.AdminRequired())
+		{
+			admin.GET("/warmer", handlers.GetWarmerStatus)
+			admin.GET("/cache", handlers.GetCacheStats)
+			admin.DELETE("/cache", handlers.PurgeCache)
+			admin.GET("/quotas", handlers.GetImageQuotas)
+			admin.GET("/usage", handlers.GetUsage)
+		}
+	}
+}
@@ -0,0 +1,951 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/yourusername/picto-lingua-backend/api/fakes"
+	"github.com/yourusername/picto-lingua-backend/api/handlers"
+	"github.com/yourusername/picto-lingua-backend/api/models"
+	"github.com/yourusername/picto-lingua-backend/config"
+)
+
+// The tests in this file drive every route through the router, with the
+// external APIs replaced by the fakes in api/fakes, so they need no network
+// access and no API keys.
+
+const (
+	testUnsplashKey = "test-unsplash-key"
+	testAdminKey    = "test-admin-key"
+)
+
+var (
+	unsplash *fakes.Unsplash
+	openAI   *fakes.OpenAI
+	testCfg  *config.Config
+	router   *gin.Engine
+
+	// hitRoutes records the routes requests were matched to, as "METHOD path"
+	hitRoutes   = make(map[string]bool)
+	hitRoutesMu sync.Mutex
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+
+	unsplash = fakes.NewUnsplash(testUnsplashKey)
+	openAI = fakes.NewOpenAI()
+
+	dataDir, err := os.MkdirTemp("", "picto-lingua-test-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	testCfg, err = config.LoadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	testCfg.UnsplashAccessKey = testUnsplashKey
+	testCfg.UnsplashBaseURL = unsplash.URL
+	testCfg.OpenAIAPIKey = "sk-test-key"
+	testCfg.OpenAIBaseURL = openAI.BaseURL()
+	testCfg.ImageProviders = []string{"unsplash"}
+	testCfg.TTSProvider = ""
+	testCfg.ModerationProvider = ""
+	testCfg.CacheDir = dataDir + "/cache"
+	testCfg.ImageDir = dataDir + "/images"
+	testCfg.AudioCacheDir = dataDir + "/audio"
+	testCfg.UsageFile = dataDir + "/usage.json"
+	testCfg.PromptDir = ""
+	testCfg.DailyBudget = 0
+	testCfg.AdminAPIKey = testAdminKey
+	testCfg.WarmerInterval = 0
+	testCfg.DebugLogFile = ""
+
+	initHandlers(testCfg)
+
+	// Build the router like newRouter does, with a middleware in front that
+	// records which routes were exercised
+	router = gin.New()
+	router.Use(func(c *gin.Context) {
+		hitRoutesMu.Lock()
+		hitRoutes[c.Request.Method+" "+c.FullPath()] = true
+		hitRoutesMu.Unlock()
+		c.Next()
+	})
+	router.Use(corsMiddleware())
+	registerRoutes(router)
+
+	code := m.Run()
+
+	// Every route must be covered by a test, unless only some tests were run
+	if code == 0 && flag.Lookup("test.run").Value.String() == "" {
+		for _, route := range router.Routes() {
+			if !hitRoutes[route.Method+" "+route.Path] {
+				fmt.Fprintf(os.Stderr, "route %s %s is not covered by the end-to-end tests\n", route.Method, route.Path)
+				code = 1
+			}
+		}
+	}
+
+	closeHandlers()
+	unsplash.Close()
+	openAI.Close()
+	os.RemoveAll(dataDir)
+	os.Exit(code)
+}
+
+// request sends a request through the router. The body is encoded as JSON
+// unless it is nil, headers are given as name and value pairs.
+func request(t *testing.T, method, target string, body any, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// expectStatus fails the test unless the response has the status, and decodes its JSON body into v
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int, v any) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d, body: %s", w.Code, status, w.Body.String())
+	}
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("invalid JSON response %q: %v", w.Body.String(), err)
+		}
+	}
+}
+
+// bearer returns the Authorization header pair for a token
+func bearer(token string) []string {
+	return []string{"Authorization", "Bearer " + token}
+}
+
+// anonymousToken logs in as a new device account and returns its token
+func anonymousToken(t *testing.T) string {
+	t.Helper()
+	var response struct {
+		Token string `json:"token"`
+	}
+	expectStatus(t, request(t, "POST", "/api/auth/anonymous", nil), http.StatusCreated, &response)
+	return response.Token
+}
+
+// registeredToken registers a user and returns its token
+func registeredToken(t *testing.T, username string) string {
+	t.Helper()
+	credentials := gin.H{"username": username, "password": "correct horse"}
+	expectStatus(t, request(t, "POST", "/api/auth/register", credentials), http.StatusCreated, nil)
+
+	var response struct {
+		Token string `json:"token"`
+	}
+	expectStatus(t, request(t, "POST", "/api/auth/login", credentials), http.StatusOK, &response)
+	return response.Token
+}
+
+// resetImageProviders starts the image handler afresh when the test ends, so
+// rate limits a test ran into do not throttle the next tests
+func resetImageProviders(t *testing.T) {
+	t.Cleanup(func() {
+		unsplash.SetRateLimit(50, 50)
+		unsplash.FailWith(0)
+		handlers.CloseImageHandler()
+		handlers.InitImageHandler(testCfg)
+	})
+}
+
+// resetOpenAI restores the fake OpenAI API when the test ends
+func resetOpenAI(t *testing.T) {
+	t.Cleanup(func() {
+		openAI.FailWith(0)
+		openAI.RateLimit(0)
+		openAI.SetContent("")
+		openAI.SetVocabulary(fakes.DefaultVocabulary)
+		openAI.Flag()
+	})
+}
+
+func TestThemes(t *testing.T) {
+	var response struct {
+		Themes []models.Theme `json:"themes"`
+	}
+	expectStatus(t, request(t, "GET", "/api/themes", nil), http.StatusOK, &response)
+
+	if !slices.ContainsFunc(response.Themes, func(theme models.Theme) bool { return theme.ID == "park" }) {
+		t.Errorf("themes = %+v, want park among them", response.Themes)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	token := registeredToken(t, "ada")
+
+	var me struct {
+		User models.User `json:"user"`
+	}
+	expectStatus(t, request(t, "GET", "/api/me", nil, bearer(token)...), http.StatusOK, &me)
+	if me.User.Username != "ada" || me.User.Anonymous {
+		t.Errorf("user = %+v", me.User)
+	}
+
+	credentials := gin.H{"username": "ada", "password": "correct horse"}
+	expectStatus(t, request(t, "POST", "/api/auth/register", credentials), http.StatusConflict, nil)
+	credentials["password"] = "wrong horse"
+	expectStatus(t, request(t, "POST", "/api/auth/login", credentials), http.StatusUnauthorized, nil)
+
+	expectStatus(t, request(t, "POST", "/api/auth/logout", nil, bearer(token)...), http.StatusOK, nil)
+	expectStatus(t, request(t, "GET", "/api/me", nil, bearer(token)...), http.StatusUnauthorized, nil)
+	expectStatus(t, request(t, "GET", "/api/me", nil), http.StatusUnauthorized, nil)
+
+	anonymous := anonymousToken(t)
+	expectStatus(t, request(t, "GET", "/api/me", nil, bearer(anonymous)...), http.StatusOK, &me)
+	if !me.User.Anonymous {
+		t.Errorf("user = %+v, want an anonymous user", me.User)
+	}
+}
+
+func TestImages(t *testing.T) {
+	resetImageProviders(t)
+
+	var response struct {
+		Theme  string         `json:"theme"`
+		Images []models.Image `json:"images"`
+	}
+	expectStatus(t, request(t, "GET", "/api/images?theme=park", nil), http.StatusOK, &response)
+	if len(response.Images) != 5 {
+		t.Fatalf("got %d images, want 5", len(response.Images))
+	}
+	first := response.Images[0]
+	if first.ID != "fake-bench" || first.Provider != "unsplash" || first.Photographer != "Fake Photographer" || first.Color == "" {
+		t.Errorf("image = %+v", first)
+	}
+
+	// Searches are cached
+	expectStatus(t, request(t, "GET", "/api/images?theme=park", nil), http.StatusOK, nil)
+	if n := unsplash.Requests("/search/photos"); n != 1 {
+		t.Errorf("Unsplash was searched %d times, want once", n)
+	}
+
+	expectStatus(t, request(t, "GET", "/api/images", nil), http.StatusBadRequest, nil)
+	expectStatus(t, request(t, "GET", "/api/images?theme=moon", nil), http.StatusBadRequest, nil)
+}
+
+func TestImagesFailures(t *testing.T) {
+	resetImageProviders(t)
+
+	unsplash.FailWith(http.StatusInternalServerError)
+	expectStatus(t, request(t, "GET", "/api/images?theme=city", nil), http.StatusInternalServerError, nil)
+
+	// Unsplash answers 403 once the hourly limit is used up
+	unsplash.FailWith(0)
+	unsplash.SetRateLimit(50, 0)
+	w := request(t, "GET", "/api/images?theme=city", nil)
+	expectStatus(t, w, http.StatusServiceUnavailable, nil)
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "3600" {
+		t.Errorf("Retry-After = %q, want an hour", retryAfter)
+	}
+
+	// Later requests are not sent to Unsplash until the quota is refilled
+	searches := unsplash.Requests("/search/photos")
+	expectStatus(t, request(t, "GET", "/api/images?theme=home", nil), http.StatusServiceUnavailable, nil)
+	if n := unsplash.Requests("/search/photos"); n != searches {
+		t.Errorf("Unsplash was searched while rate limited")
+	}
+
+	var quotas struct {
+		Quotas []models.ProviderQuota `json:"quotas"`
+	}
+	expectStatus(t, request(t, "GET", "/api/admin/quotas", nil, "X-Admin-Key", testAdminKey), http.StatusOK, &quotas)
+	if len(quotas.Quotas) != 1 || quotas.Quotas[0].Remaining != 0 || !quotas.Quotas[0].Throttled {
+		t.Errorf("quotas = %+v, want unsplash throttled", quotas.Quotas)
+	}
+}
+
+func TestImageFiles(t *testing.T) {
+	resetImageProviders(t)
+
+	// The width is rounded up to the next variant size
+	w := request(t, "GET", "/api/images/fake-pond/file?w=320", nil)
+	expectStatus(t, w, http.StatusOK, nil)
+	if contentType := w.Header().Get("Content-Type"); contentType != "image/jpeg" {
+		t.Fatalf("Content-Type = %q", contentType)
+	}
+	config, _, err := image.DecodeConfig(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != 400 {
+		t.Errorf("width = %d, want 400", config.Width)
+	}
+
+	// Variants are served from the image cache
+	lookups := unsplash.Requests("/photos/{id}")
+	w = request(t, "GET", "/api/images/fake-pond/file?w=320", nil, "If-None-Match", w.Header().Get("ETag"))
+	expectStatus(t, w, http.StatusNotModified, nil)
+	if n := unsplash.Requests("/photos/{id}"); n != lookups {
+		t.Errorf("Unsplash was asked for the photo again")
+	}
+
+	w = request(t, "GET", "/api/images/fake-pond/file?w=160&format=webp", nil)
+	expectStatus(t, w, http.StatusOK, nil)
+	if contentType := w.Header().Get("Content-Type"); contentType != "image/webp" {
+		t.Errorf("Content-Type = %q, want image/webp", contentType)
+	}
+
+	expectStatus(t, request(t, "GET", "/api/images/fake-pond/file?w=wide", nil), http.StatusBadRequest, nil)
+	expectStatus(t, request(t, "GET", "/api/images/fake-pond/file?format=gif", nil), http.StatusBadRequest, nil)
+	expectStatus(t, request(t, "GET", "/api/images/fake-missing/file", nil), http.StatusNotFound, nil)
+
+	var placeholder models.ImagePlaceholder
+	expectStatus(t, request(t, "GET", "/api/images/fake-pond/placeholder", nil), http.StatusOK, &placeholder)
+	if placeholder.BlurHash == "" || placeholder.Color != "#4070a0" {
+		t.Errorf("placeholder = %+v, want the color of the fake photo", placeholder)
+	}
+}
+
+func TestTrackImageDownload(t *testing.T) {
+	resetImageProviders(t)
+
+	var response struct {
+		Tracked bool `json:"tracked"`
+	}
+	// Only images shown to learners are tracked
+	expectStatus(t, request(t, "POST", "/api/images/fake-unseen/download", nil), http.StatusNotFound, nil)
+
+	expectStatus(t, request(t, "GET", "/api/images?theme=park", nil), http.StatusOK, nil)
+	expectStatus(t, request(t, "POST", "/api/images/fake-kite/download", nil), http.StatusAccepted, &response)
+	if !response.Tracked {
+		t.Error("first selection was not tracked")
+	}
+	expectStatus(t, request(t, "POST", "/api/images/fake-kite/download", nil), http.StatusAccepted, &response)
+	if response.Tracked {
+		t.Error("repeated selection was tracked again")
+	}
+
+	// Tracking runs in the background, closing the handler waits for it
+	handlers.CloseImageHandler()
+	if n := unsplash.Downloads("fake-kite"); n != 1 {
+		t.Errorf("Unsplash saw %d downloads, want 1", n)
+	}
+
+	expectStatus(t, request(t, "POST", "/api/images/pexels:123/download", nil), http.StatusAccepted, &response)
+	if response.Tracked {
+		t.Error("a Pexels image was tracked")
+	}
+	expectStatus(t, request(t, "POST", "/api/images/bad%20id/download", nil), http.StatusBadRequest, nil)
+}
+
+// vocabularyResponse is the response of the vocabulary endpoint
+type vocabularyResponse struct {
+	Theme      string                  `json:"theme"`
+	Count      int                     `json:"count"`
+	Language   string                  `json:"language"`
+	Vocabulary []models.VocabularyItem `json:"vocabulary"`
+}
+
+func TestVocabulary(t *testing.T) {
+	resetOpenAI(t)
+
+	var response vocabularyResponse
+	expectStatus(t, request(t, "GET", "/api/vocabulary?theme=park&count=3", nil), http.StatusOK, &response)
+	if response.Count != 3 || response.Vocabulary[0].Word != "bench" || response.Vocabulary[0].IPA != "/bɛntʃ/" {
+		t.Fatalf("response = %+v", response)
+	}
+
+	// The prompt asked for the theme and count, and the vocabulary is cached
+	requests := openAI.ChatRequests()
+	if len(requests) == 0 || !strings.Contains(requests[len(requests)-1].Messages[1].Content, `Generate 3 vocabulary words related to the theme "park"`) {
+		t.Fatalf("unexpected chat requests %+v", requests)
+	}
+	expectStatus(t, request(t, "GET", "/api/vocabulary?theme=park&count=3", nil), http.StatusOK, &response)
+	if n := len(openAI.ChatRequests()); n != len(requests) {
+		t.Errorf("cached vocabulary was generated again")
+	}
+
+	expectStatus(t, request(t, "GET", "/api/vocabulary?theme=park&count=2&language=dutch", nil), http.StatusOK, &response)
+	if response.Language != "dutch" || response.Vocabulary[0].DutchWord != "bank" {
+		t.Errorf("response = %+v, want Dutch vocabulary", response)
+	}
+
+	// Words the moderation flags are dropped
+	openAI.Flag("swing")
+	expectStatus(t, request(t, "GET", "/api/vocabulary?theme=park&count=5", nil), http.StatusOK, &response)
+	if response.Count != 4 || slices.ContainsFunc(response.Vocabulary, func(item models.VocabularyItem) bool { return item.Word == "swing" }) {
+		t.Errorf("vocabulary = %+v, want the flagged word removed", response.Vocabulary)
+	}
+
+	expectStatus(t, request(t, "GET", "/api/vocabulary", nil), http.StatusBadRequest, nil)
+	// Unsupported languages are rejected before they reach OpenAI or the cache
+	generated := len(openAI.ChatRequests())
+	expectStatus(t, request(t, "GET", "/api/vocabulary?theme=park&language=x1", nil), http.StatusBadRequest, nil)
+	expectStatus(t, request(t, "GET", "/api/vocabulary/stream?theme=park&language=x2", nil), http.StatusBadRequest, nil)
+	if n := len(openAI.ChatRequests()); n != generated {
+		t.Errorf("unsupported languages sent %d requests to OpenAI", n-generated)
+	}
+	expectStatus(t, request(t, "GET", "/api/vocabulary?theme=moon", nil), http.StatusBadRequest, nil)
+	expectStatus(t, request(t, "GET", "/api/vocabulary?theme=park&count=many", nil), http.StatusBadRequest, nil)
+}
+
+func TestVocabularyFailures(t *testing.T) {
+	resetOpenAI(t)
+
+	for name, fail := range map[string]func(){
+		"server error": func() { openAI.FailWith(http.StatusInternalServerError) },
+		"rate limit":   func() { openAI.RateLimit(20 * time.Second) },
+		"invalid JSON": func() { openAI.SetContent("Here are some words: bench, tree") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			resetOpenAI(t)
+			fail()
+			expectStatus(t, request(t, "GET", "/api/vocabulary?theme=airport&count=4", nil), http.StatusInternalServerError, nil)
+		})
+	}
+
+	// Failures are not cached
+	var response vocabularyResponse
+	expectStatus(t, request(t, "GET", "/api/vocabulary?theme=airport&count=4", nil), http.StatusOK, &response)
+	if response.Count != 4 {
+		t.Errorf("got %d words, want 4", response.Count)
+	}
+}
+
+func TestVocabularyLanguagesInParallel(t *testing.T) {
+	resetOpenAI(t)
+	before := len(openAI.ChatRequests())
+
+	// English and Dutch requests, plain and streamed, do not share a language setting
+	targets := []string{
+		"/api/vocabulary?theme=restaurant&count=2&language=english",
+		"/api/vocabulary?theme=restaurant&count=2&language=dutch",
+		"/api/vocabulary/stream?theme=restaurant&count=2&language=english",
+		"/api/vocabulary/stream?theme=restaurant&count=2&language=dutch",
+	}
+	responses := make([]*httptest.ResponseRecorder, 4*len(targets))
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = request(t, "GET", targets[i%len(targets)], nil)
+		}()
+	}
+	wg.Wait()
+
+	for i, w := range responses {
+		target := targets[i%len(targets)]
+		if strings.Contains(target, "stream") {
+			expectStatus(t, w, http.StatusOK, nil)
+			continue
+		}
+		var response vocabularyResponse
+		expectStatus(t, w, http.StatusOK, &response)
+		if want := target[strings.LastIndex(target, "=")+1:]; response.Language != want {
+			t.Errorf("%s: language = %q, want %s", target, response.Language, want)
+		}
+	}
+
+	// Every prompt matches the language of its request, so both are cached under their own key
+	for _, chat := range openAI.ChatRequests()[before:] {
+		dutch := strings.Contains(chat.Messages[1].Content, "in both English and Dutch")
+		english := strings.Contains(chat.Messages[1].Content, `related to the theme "restaurant".`)
+		if dutch == english {
+			t.Errorf("prompt is neither English nor Dutch: %s", chat.Messages[1].Content)
+		}
+	}
+	after := len(openAI.ChatRequests())
+	expectStatus(t, request(t, "GET", targets[0], nil), http.StatusOK, nil)
+	expectStatus(t, request(t, "GET", targets[1], nil), http.StatusOK, nil)
+	if n := len(openAI.ChatRequests()); n != after {
+		t.Errorf("%d more chat requests, want both languages cached", n-after)
+	}
+}
+
+// sseEvent is an event of a Server-Sent Events stream
+type sseEvent struct {
+	Name string
+	Data string
+}
+
+// parseSSE splits a Server-Sent Events stream into its events
+func parseSSE(body string) []sseEvent {
+	var events []sseEvent
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		var event sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event:"); ok {
+				event.Name = name
+			} else if data, ok := strings.CutPrefix(line, "data:"); ok {
+				event.Data = data
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestStreamVocabulary(t *testing.T) {
+	resetOpenAI(t)
+
+	w := request(t, "GET", "/api/vocabulary/stream?theme=kitchen&count=4&language=dutch", nil)
+	expectStatus(t, w, http.StatusOK, nil)
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+		t.Fatalf("Content-Type = %q", contentType)
+	}
+
+	events := parseSSE(w.Body.String())
+	if len(events) != 5 || events[4].Name != "done" {
+		t.Fatalf("events = %+v, want 4 words and done", events)
+	}
+	var item struct {
+		Index int                   `json:"index"`
+		Item  models.VocabularyItem `json:"item"`
+	}
+	if err := json.Unmarshal([]byte(events[1].Data), &item); err != nil {
+		t.Fatal(err)
+	}
+	if events[1].Name != "vocabulary" || item.Index != 1 || item.Item.DutchWord != "boom" {
+		t.Errorf("second event = %+v", events[1])
+	}
+
+	// Streamed vocabulary is cached, and its token usage is recorded
+	var response vocabularyResponse
+	requests := len(openAI.ChatRequests())
+	expectStatus(t, request(t, "GET", "/api/vocabulary?theme=kitchen&count=4&language=dutch", nil), http.StatusOK, &response)
+	if len(openAI.ChatRequests()) != requests || response.Count != 4 {
+		t.Errorf("streamed vocabulary was not cached")
+	}
+
+	var usage models.UsageReport
+	expectStatus(t, request(t, "GET", "/api/admin/usage", nil, "X-Admin-Key", testAdminKey), http.StatusOK, &usage)
+	if !slices.ContainsFunc(usage.Themes, func(theme models.ThemeUsage) bool {
+		return theme.Theme == "kitchen" && theme.Language == "dutch" && theme.CompletionTokens > 0
+	}) {
+		t.Errorf("usage = %+v, want the streamed completion recorded", usage.Themes)
+	}
+
+	openAI.FailWith(http.StatusServiceUnavailable)
+	events = parseSSE(request(t, "GET", "/api/vocabulary/stream?theme=kitchen&count=3", nil).Body.String())
+	if len(events) != 1 || events[0].Name != "error" {
+		t.Errorf("events = %+v, want an error", events)
+	}
+}
+
+func TestPronunciation(t *testing.T) {
+	resetOpenAI(t)
+	override := gin.H{"word": "tree", "ipa": "/tɹiː/"}
+
+	// Overrides change what every learner hears, only admins may set them
+	expectStatus(t, request(t, "PUT", "/api/vocabulary/pronunciation", override), http.StatusUnauthorized, nil)
+	teacher := bearer(registeredToken(t, "mr-dijkstra"))
+	expectStatus(t, request(t, "POST", "/api/classrooms", gin.H{"name": "Phonetics"}, teacher...), http.StatusCreated, nil)
+	expectStatus(t, request(t, "PUT", "/api/vocabulary/pronunciation", override, teacher...), http.StatusUnauthorized, nil)
+
+	admin := []string{"X-Admin-Key", testAdminKey}
+	t.Cleanup(func() {
+		request(t, "PUT", "/api/vocabulary/pronunciation", gin.H{"word": "tree"}, admin...)
+	})
+	expectStatus(t, request(t, "PUT", "/api/vocabulary/pronunciation", override, admin...), http.StatusOK, nil)
+
+	var response vocabularyResponse
+	expectStatus(t, request(t, "GET", "/api/vocabulary?theme=beach&count=2", nil), http.StatusOK, &response)
+	if response.Vocabulary[1].Word != "tree" || response.Vocabulary[1].IPA != "/tɹiː/" {
+		t.Errorf("vocabulary = %+v, want the overridden transcription", response.Vocabulary)
+	}
+
+	expectStatus(t, request(t, "PUT", "/api/vocabulary/pronunciation", gin.H{"word": "tree", "ipa": "tr33"}, admin...), http.StatusBadRequest, nil)
+	expectStatus(t, request(t, "PUT", "/api/vocabulary/pronunciation", gin.H{"ipa": "/triː/"}, admin...), http.StatusBadRequest, nil)
+}
+
+func TestAudio(t *testing.T) {
+	resetOpenAI(t)
+
+	w := request(t, "GET", "/api/audio?word=bench", nil)
+	expectStatus(t, w, http.StatusOK, nil)
+	if contentType := w.Header().Get("Content-Type"); contentType != "audio/mpeg" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	if body := w.Body.String(); body != "ID3 fake speech: bench" {
+		t.Errorf("audio = %q, want the fake speech", body)
+	}
+
+	// Cached audio is served while OpenAI is down
+	openAI.FailWith(http.StatusInternalServerError)
+	cached := request(t, "GET", "/api/audio?word=bench", nil)
+	expectStatus(t, cached, http.StatusOK, nil)
+	if cached.Header().Get("ETag") != w.Header().Get("ETag") {
+		t.Errorf("ETag changed from %q to %q", w.Header().Get("ETag"), cached.Header().Get("ETag"))
+	}
+
+	// The URL is not content-addressed, browsers revalidate it with the ETag
+	if cacheControl := w.Header().Get("Cache-Control"); cacheControl != "public, no-cache" {
+		t.Errorf("Cache-Control = %q, want revalidation", cacheControl)
+	}
+	expectStatus(t, request(t, "GET", "/api/audio?word=bench", nil, "If-None-Match", w.Header().Get("ETag")), http.StatusNotModified, nil)
+	expectStatus(t, request(t, "GET", "/api/audio?word=tree", nil), http.StatusInternalServerError, nil)
+
+	expectStatus(t, request(t, "GET", "/api/audio", nil), http.StatusBadRequest, nil)
+	expectStatus(t, request(t, "GET", "/api/audio?word=bench&language=klingon", nil), http.StatusBadRequest, nil)
+}
+
+// sessionResponse is the response to saving a session
+type sessionResponse struct {
+	SessionID string `json:"session_id"`
+	Version   int    `json:"version"`
+}
+
+func TestSessions(t *testing.T) {
+	resetOpenAI(t)
+	token := anonymousToken(t)
+	auth := bearer(token)
+
+	var created sessionResponse
+	w := request(t, "POST", "/api/session", gin.H{"theme_id": "office", "image_id": "fake-bench", "word_count": 3}, auth...)
+	expectStatus(t, w, http.StatusOK, &created)
+	if created.SessionID == "" || w.Header().Get("ETag") != `"1"` {
+		t.Fatalf("created = %+v, ETag %s", created, w.Header().Get("ETag"))
+	}
+
+	answers := gin.H{
+		"theme_id":   "office",
+		"image_id":   "fake-bench",
+		"session_id": created.SessionID,
+		"answers":    []gin.H{{"word": "bench", "result": "known", "duration_ms": 1200}},
+	}
+	var updated sessionResponse
+	expectStatus(t, request(t, "POST", "/api/session", answers, append(auth, "If-Match", `"1"`)...), http.StatusOK, &updated)
+	if updated.Version != 2 {
+		t.Errorf("version = %d, want 2", updated.Version)
+	}
+
+	// A client that missed the update is told about it
+	var conflict struct {
+		Session models.SessionData `json:"session"`
+	}
+	expectStatus(t, request(t, "POST", "/api/session", answers, append(auth, "If-Match", `"1"`)...), http.StatusConflict, &conflict)
+	if conflict.Session.Version != 2 {
+		t.Errorf("conflict = %+v, want the current session", conflict.Session)
+	}
+
+	// Progress on words the session does not practice is rejected
+	inflated := gin.H{
+		"theme_id":   "office",
+		"image_id":   "fake-bench",
+		"session_id": created.SessionID,
+		"progress":   gin.H{"x": gin.H{"seen_count": 1000000, "known_count": 1000000}},
+	}
+	expectStatus(t, request(t, "POST", "/api/session", inflated, auth...), http.StatusBadRequest, nil)
+
+	var session models.SessionData
+	expectStatus(t, request(t, "GET", "/api/session?session_id="+created.SessionID, nil, auth...), http.StatusOK, &session)
+	if session.Progress["bench"].Status != "known" {
+		t.Errorf("progress = %+v", session.Progress)
+	}
+	expectStatus(t, request(t, "GET", "/api/session?session_id="+created.SessionID, nil, bearer(anonymousToken(t))...), http.StatusForbidden, nil)
+
+	var events struct {
+		Events []models.SessionEvent `json:"events"`
+	}
+	expectStatus(t, request(t, "GET", "/api/session/events?session_id="+created.SessionID, nil, auth...), http.StatusOK, &events)
+	if len(events.Events) != 1 || events.Events[0].Sequence != 1 {
+		t.Errorf("events = %+v", events.Events)
+	}
+
+	var list struct {
+		Count int `json:"count"`
+	}
+	expectStatus(t, request(t, "GET", "/api/sessions?theme=office", nil, auth...), http.StatusOK, &list)
+	if list.Count != 1 {
+		t.Errorf("listed %d sessions, want 1", list.Count)
+	}
+
+	// Resuming picks up after the answered word, with the vocabulary and image of the session
+	var resumed struct {
+		Vocabulary     []models.VocabularyItem `json:"vocabulary"`
+		Image          *models.Image           `json:"image"`
+		NextIndex      int                     `json:"next_index"`
+		RemainingWords []string                `json:"remaining_words"`
+	}
+	expectStatus(t, request(t, "POST", "/api/sessions/"+created.SessionID+"/resume", nil, auth...), http.StatusOK, &resumed)
+	if len(resumed.Vocabulary) != 3 || resumed.NextIndex != 1 || !slices.Equal(resumed.RemainingWords, []string{"tree", "pond"}) {
+		t.Errorf("resumed = %+v", resumed)
+	}
+	if resumed.Image == nil || resumed.Image.ID != "fake-bench" {
+		t.Errorf("image = %+v, want the image of the session", resumed.Image)
+	}
+
+	var stats models.UserStats
+	expectStatus(t, request(t, "GET", "/api/stats", nil, auth...), http.StatusOK, &stats)
+	if stats.WordsSeen != 1 || stats.TotalReviews != 1 || stats.KnownRatio != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	expectStatus(t, request(t, "GET", "/api/stats?theme=moon", nil, auth...), http.StatusBadRequest, nil)
+
+	var status models.GamificationStatus
+	expectStatus(t, request(t, "GET", "/api/me/gamification", nil, auth...), http.StatusOK, &status)
+	if status.XP == 0 || status.WordsToday != 1 {
+		t.Errorf("gamification = %+v, want XP for the answer", status)
+	}
+	expectStatus(t, request(t, "PUT", "/api/me/gamification", gin.H{"daily_goal": 5, "timezone": "Europe/Amsterdam"}, auth...), http.StatusOK, &status)
+	if status.DailyGoal != 5 || status.Timezone != "Europe/Amsterdam" {
+		t.Errorf("gamification = %+v, want the new settings", status)
+	}
+	expectStatus(t, request(t, "PUT", "/api/me/gamification", gin.H{"timezone": "Mars/Olympus"}, auth...), http.StatusBadRequest, nil)
+
+	expectStatus(t, request(t, "GET", "/api/sessions", nil), http.StatusUnauthorized, nil)
+}
+
+func TestClassroom(t *testing.T) {
+	resetOpenAI(t)
+	resetImageProviders(t)
+	teacher := bearer(registeredToken(t, "ms-hopper"))
+	student := bearer(registeredToken(t, "grace"))
+
+	var created struct {
+		Classroom struct {
+			ID       string `json:"id"`
+			JoinCode string `json:"join_code"`
+		} `json:"classroom"`
+	}
+	expectStatus(t, request(t, "POST", "/api/classrooms", gin.H{"name": "Dutch 1A"}, teacher...), http.StatusCreated, &created)
+	classroom := "/api/classrooms/" + created.Classroom.ID
+	expectStatus(t, request(t, "POST", "/api/classrooms", gin.H{"name": "Mine"}, bearer(anonymousToken(t))...), http.StatusForbidden, nil)
+
+	expectStatus(t, request(t, "POST", "/api/classrooms/join", gin.H{"join_code": created.Classroom.JoinCode}, student...), http.StatusOK, nil)
+	expectStatus(t, request(t, "POST", "/api/classrooms/join", gin.H{"join_code": "NOPE"}, student...), http.StatusNotFound, nil)
+
+	var list struct {
+		Classrooms []struct {
+			JoinCode string `json:"join_code"`
+			Role     string `json:"role"`
+		} `json:"classrooms"`
+	}
+	expectStatus(t, request(t, "GET", "/api/classrooms", nil, student...), http.StatusOK, &list)
+	if len(list.Classrooms) != 1 || list.Classrooms[0].Role != "student" || list.Classrooms[0].JoinCode != "" {
+		t.Errorf("classrooms = %+v", list.Classrooms)
+	}
+
+	expectStatus(t, request(t, "POST", classroom+"/themes", gin.H{"theme_id": "grocery"}, teacher...), http.StatusOK, nil)
+	expectStatus(t, request(t, "POST", classroom+"/themes", gin.H{"theme_id": "grocery"}, student...), http.StatusForbidden, nil)
+
+	var details struct {
+		Themes  []json.RawMessage `json:"themes"`
+		Members []json.RawMessage `json:"members"`
+	}
+	expectStatus(t, request(t, "GET", classroom, nil, teacher...), http.StatusOK, &details)
+	if len(details.Themes) != 1 || len(details.Members) != 2 {
+		t.Errorf("classroom = %+v", details)
+	}
+
+	// The assignment freezes generated vocabulary and a random image
+	var assignment struct {
+		Assignment struct {
+			ID         string                  `json:"id"`
+			Vocabulary []models.VocabularyItem `json:"vocabulary"`
+			Image      *models.Image           `json:"image"`
+		} `json:"assignment"`
+	}
+	expectStatus(t, request(t, "POST", classroom+"/assignments", gin.H{"theme_id": "grocery", "count": 2}, teacher...), http.StatusCreated, &assignment)
+	if len(assignment.Assignment.Vocabulary) != 2 || assignment.Assignment.Image == nil {
+		t.Fatalf("assignment = %+v", assignment.Assignment)
+	}
+	if unsplash.Requests("/photos/random") == 0 {
+		t.Error("no random image was requested from Unsplash")
+	}
+	path := classroom + "/assignments/" + assignment.Assignment.ID
+
+	var assignments struct {
+		Assignments []json.RawMessage `json:"assignments"`
+	}
+	expectStatus(t, request(t, "GET", classroom+"/assignments", nil, student...), http.StatusOK, &assignments)
+	if len(assignments.Assignments) != 1 {
+		t.Errorf("listed %d assignments, want 1", len(assignments.Assignments))
+	}
+	expectStatus(t, request(t, "GET", path, nil, student...), http.StatusOK, nil)
+
+	// The student answers every word through the session endpoints
+	var started struct {
+		Session models.SessionData `json:"session"`
+	}
+	expectStatus(t, request(t, "POST", path+"/start", nil, student...), http.StatusCreated, &started)
+	var answers []gin.H
+	for _, item := range assignment.Assignment.Vocabulary {
+		answers = append(answers, gin.H{"word": item.Word, "result": "known"})
+	}
+	expectStatus(t, request(t, "POST", "/api/session", gin.H{
+		"theme_id":   started.Session.ThemeID,
+		"image_id":   started.Session.ImageID,
+		"session_id": started.Session.SessionID,
+		"answers":    answers,
+	}, student...), http.StatusOK, nil)
+
+	var report struct {
+		Completed int `json:"completed"`
+		Students  []struct {
+			Score int `json:"score"`
+		} `json:"students"`
+	}
+	expectStatus(t, request(t, "GET", path+"/report", nil, teacher...), http.StatusOK, &report)
+	if report.Completed != 1 || len(report.Students) != 1 || report.Students[0].Score != 100 {
+		t.Errorf("report = %+v", report)
+	}
+	expectStatus(t, request(t, "GET", path+"/report", nil, student...), http.StatusForbidden, nil)
+
+	var progress struct {
+		Themes []struct {
+			ThemeID  string `json:"theme_id"`
+			Students []struct {
+				WordsKnown int `json:"words_known"`
+			} `json:"students"`
+		} `json:"themes"`
+	}
+	expectStatus(t, request(t, "GET", classroom+"/progress", nil, teacher...), http.StatusOK, &progress)
+	if len(progress.Themes) != 1 || len(progress.Themes[0].Students) != 1 || progress.Themes[0].Students[0].WordsKnown != 2 {
+		t.Errorf("progress = %+v", progress)
+	}
+
+	expectStatus(t, request(t, "DELETE", path, nil, teacher...), http.StatusOK, nil)
+	expectStatus(t, request(t, "GET", path, nil, student...), http.StatusNotFound, nil)
+	expectStatus(t, request(t, "DELETE", classroom+"/themes/grocery", nil, teacher...), http.StatusOK, nil)
+	expectStatus(t, request(t, "DELETE", classroom+"/themes/grocery", nil, teacher...), http.StatusNotFound, nil)
+}
+
+func TestRace(t *testing.T) {
+	resetOpenAI(t)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/race/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(gin.H{"type": "create", "name": "host", "theme_id": "cafe", "questions": 3}); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var room struct {
+		Type      string `json:"type"`
+		Code      string `json:"code"`
+		ThemeID   string `json:"theme_id"`
+		Questions int    `json:"questions"`
+	}
+	if err := conn.ReadJSON(&room); err != nil {
+		t.Fatal(err)
+	}
+	if room.Type != "room" || room.Code == "" || room.ThemeID != "cafe" || room.Questions != 3 {
+		t.Errorf("room = %+v", room)
+	}
+
+	// Browsers on other origins may not connect
+	header := http.Header{"Origin": {"https://evil.example"}}
+	if _, resp, err := websocket.DefaultDialer.Dial(url, header); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("connection from another origin was not rejected: %v", err)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	admin := []string{"X-Admin-Key", testAdminKey}
+
+	expectStatus(t, request(t, "GET", "/api/admin/cache", nil), http.StatusUnauthorized, nil)
+	expectStatus(t, request(t, "GET", "/api/admin/cache", nil, "X-Admin-Key", "guess"), http.StatusUnauthorized, nil)
+
+	// Fill both caches
+	expectStatus(t, request(t, "GET", "/api/vocabulary?theme=city&count=1", nil), http.StatusOK, nil)
+	expectStatus(t, request(t, "GET", "/api/images?theme=beach", nil), http.StatusOK, nil)
+
+	var stats struct {
+		Namespaces []models.CacheStats `json:"namespaces"`
+	}
+	expectStatus(t, request(t, "GET", "/api/admin/cache", nil, admin...), http.StatusOK, &stats)
+	if len(stats.Namespaces) != 2 || !stats.Namespaces[0].Persisted || stats.Namespaces[0].Entries == 0 {
+		t.Errorf("cache stats = %+v", stats.Namespaces)
+	}
+
+	var purged struct {
+		Purged int `json:"purged"`
+	}
+	expectStatus(t, request(t, "DELETE", "/api/admin/cache?namespace=images", nil, admin...), http.StatusOK, &purged)
+	if purged.Purged == 0 {
+		t.Error("no cached images were purged")
+	}
+	expectStatus(t, request(t, "DELETE", "/api/admin/cache?namespace=sounds", nil, admin...), http.StatusNotFound, nil)
+
+	var warmer models.WarmerStatus
+	expectStatus(t, request(t, "GET", "/api/admin/warmer", nil, admin...), http.StatusOK, &warmer)
+	if warmer.Running || len(warmer.Themes) == 0 {
+		t.Errorf("warmer = %+v", warmer)
+	}
+
+	var quotas struct {
+		Quotas []models.ProviderQuota `json:"quotas"`
+	}
+	expectStatus(t, request(t, "GET", "/api/admin/quotas", nil, admin...), http.StatusOK, &quotas)
+	if len(quotas.Quotas) != 1 || quotas.Quotas[0].Provider != "unsplash" || quotas.Quotas[0].Limit != 50 {
+		t.Errorf("quotas = %+v", quotas.Quotas)
+	}
+
+	var usage models.UsageReport
+	expectStatus(t, request(t, "GET", "/api/admin/usage", nil, admin...), http.StatusOK, &usage)
+	if usage.Total.Requests == 0 || usage.Total.Cost == 0 {
+		t.Errorf("usage = %+v, want the completions of the tests", usage.Total)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	w := request(t, "OPTIONS", "/api/session", nil,
+		"Origin", "http://localhost:3000",
+		"Access-Control-Request-Method", "POST",
+		"Access-Control-Request-Headers", "Authorization, If-Match")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", w.Code)
+	}
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "http://localhost:3000" {
+		t.Errorf("Access-Control-Allow-Origin = %q", origin)
+	}
+
+	w = request(t, "GET", "/api/themes", nil, "Origin", "https://evil.example")
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q for another origin", origin)
+	}
+}
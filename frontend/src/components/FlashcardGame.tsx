@@ -109,7 +109,7 @@ const FlashcardGame: React.FC<FlashcardGameProps> = ({
           />
           <Box p={3} fontSize="sm" bg="gray.50">
             <Text fontStyle="italic" mb={1} color="gray.600">
-              Photo by {image.photographer} on Unsplash
+              {image.attribution_string || `Photo by ${image.photographer} on Unsplash`}
             </Text>
           </Box>
         </Box>
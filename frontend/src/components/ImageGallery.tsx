@@ -11,7 +11,7 @@ import {
   Link, 
   Flex
 } from '@chakra-ui/react';
-import { Image, Theme } from '../services/api';
+import { Image, Theme, imageProviderNames, trackImageDownload } from '../services/api';
 
 interface ImageGalleryProps {
   images: Image[];
@@ -28,6 +28,11 @@ const ImageGallery: React.FC<ImageGalleryProps> = ({
   onBack, 
   loading 
 }) => {
+  const handleSelect = (image: Image) => {
+    trackImageDownload(image.id);
+    onImageSelect(image);
+  };
+
   if (loading) {
     return (
       <Center py={10}>
@@ -62,9 +67,9 @@ const ImageGallery: React.FC<ImageGalleryProps> = ({
               transition="all 0.3s"
               _hover={{ transform: 'scale(1.02)', boxShadow: 'lg' }}
               cursor="pointer"
-              onClick={() => onImageSelect(image)}
+              onClick={() => handleSelect(image)}
             >
-              <Box position="relative">
+              <Box position="relative" bg={image.color || 'gray.100'}>
                 <ChakraImage 
                   src={image.url} 
                   alt={image.description || theme.name}
@@ -77,22 +82,25 @@ const ImageGallery: React.FC<ImageGalleryProps> = ({
               <Box p={3} fontSize="sm" bg="gray.50">
                 <Text fontStyle="italic" mb={1} color="gray.600">
                   Photo by{' '}
-                  <Link 
-                    href={image.photographer_url} 
-                    color="blue.500"
-                    target="_blank"
-                    rel="noopener noreferrer"
-                  >
-                    {image.photographer}
-                  </Link>
+                  {image.photographer_url ? (
+                    <Link 
+                      href={image.photographer_url} 
+                      color="blue.500"
+                      target="_blank"
+                      rel="noopener noreferrer"
+                    >
+                      {image.photographer}
+                    </Link>
+                  ) : image.photographer}
+                  {image.license && `, ${image.license},`}
                   {' '}on{' '}
                   <Link 
-                    href={image.unsplash_url} 
+                    href={image.source_url || image.unsplash_url} 
                     color="blue.500"
                     target="_blank"
                     rel="noopener noreferrer"
                   >
-                    Unsplash
+                    {imageProviderNames[image.provider] || 'Unsplash'}
                   </Link>
                 </Text>
                 {image.description && (
@@ -11,19 +11,33 @@ export interface Image {
   width: number;
   height: number;
   created_at: string;
+  blur_hash?: string;
+  color?: string; // dominant color, shown while the image loads
+  provider: string; // "unsplash", "pexels" or "wikimedia"
+  source_url: string; // page of the image at the provider
+  license?: string;
   photographer: string;
   photographer_url: string;
   unsplash_url: string;
   attribution_string: string;
 }
 
+// Display names of the image providers
+export const imageProviderNames: Record<string, string> = {
+  unsplash: 'Unsplash',
+  pexels: 'Pexels',
+  wikimedia: 'Wikimedia Commons',
+};
+
 export interface VocabularyItem {
   word: string;
   definition: string;
   example?: string;
+  ipa?: string;
   dutch_word?: string;
   dutch_definition?: string;
   dutch_example?: string;
+  dutch_ipa?: string;
 }
 
 export interface Theme {
@@ -62,6 +76,16 @@ export const getImages = async (theme: string): Promise<Image[]> => {
   return response.data.images;
 };
 
+// Tell Unsplash that the learner picked an image, as its API guidelines require.
+// Failures are ignored, tracking must never get in the way of learning.
+export const trackImageDownload = async (imageId: string): Promise<void> => {
+  try {
+    await axios.post(`${API_BASE_URL}/images/${encodeURIComponent(imageId)}/download`);
+  } catch (error) {
+    console.warn('Failed to track image download', error);
+  }
+};
+
 export const getVocabulary = async (
   theme: string, 
   count: number = 10, 